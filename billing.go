@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"jobseek-web-be/internal/billing"
+)
+
+const billingUsage = `usage: expatter-server billing <command> [flags]
+
+commands:
+  send-webhook   sign a fake subscription event with STRIPE_WEBHOOK_SECRET and
+                 post it to a running server, standing in for the provider`
+
+// runBilling implements the "billing" subcommand.
+func runBilling(args []string) {
+	if len(args) == 0 || args[0] != "send-webhook" {
+		fmt.Fprintln(os.Stderr, billingUsage)
+		os.Exit(2)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	cfg := billing.ConfigFromEnv()
+
+	fs := flag.NewFlagSet("send-webhook", flag.ExitOnError)
+	target := fs.String("url", "http://localhost:"+port+"/api/billing/webhook", "webhook endpoint")
+	eventType := fs.String("type", billing.EventSubscriptionCreated, "event type")
+	userID := fs.Int("user", 0, "user ID stored in the subscription metadata")
+	plan := fs.String("plan", "pro", "plan (basic or pro)")
+	status := fs.String("status", "", "subscription status (default active, or canceled for deletions)")
+	subID := fs.String("subscription", "", "subscription ID (default sub_test_<user>)")
+	secret := fs.String("secret", cfg.WebhookSecret, "signing secret")
+	fs.Parse(args[1:])
+
+	if *userID == 0 || *secret == "" {
+		fmt.Fprintln(os.Stderr, "send-webhook needs -user and a secret (-secret or STRIPE_WEBHOOK_SECRET)")
+		os.Exit(2)
+	}
+
+	now := time.Now()
+	event := billing.FakeEvent{Type: *eventType, UserID: *userID, Plan: *plan, Status: *status, SubscriptionID: *subID, Created: now}
+	payload, err := event.Payload(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	resp, err := billing.SendWebhook(context.Background(), http.DefaultClient, *target, *secret, payload, now)
+	if err != nil {
+		log.Fatalf("Sending webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Printf("%s %s\n", resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode != http.StatusOK {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,34 @@
+// Command oidc-mock-provider runs a local OpenID Connect provider that signs
+// in every visitor as -email without asking, for testing social login. It's
+// a separate binary so the server never ships with a provider that approves
+// everyone.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"jobseek-web-be/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9400", "listen address")
+	clientID := flag.String("client-id", "mock-client", "accepted client ID")
+	clientSecret := flag.String("client-secret", "mock-secret", "accepted client secret")
+	email := flag.String("email", "mock.user@example.com", "email of the signed-in user (a login_hint overrides it)")
+	name := flag.String("name", "Mock User", "name of the signed-in user")
+	unverified := flag.Bool("unverified", false, "report the email as unverified")
+	flag.Parse()
+
+	p, err := oidctest.NewProvider("http://"+*addr, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.Email = *email
+	p.Name = *name
+	p.EmailVerified = !*unverified
+
+	log.Printf("Mock OIDC provider at %s (client %s / %s)", p.Issuer, p.ClientID, p.ClientSecret)
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
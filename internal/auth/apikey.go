@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// API key scopes. A key can only be used on the routes its scopes cover.
+const (
+	ScopeSearchRead  = "search:read"  // run searches
+	ScopeAlertsRead  = "alerts:read"  // list saved searches
+	ScopeAlertsWrite = "alerts:write" // create and delete saved searches
+	ScopeCVAnalyze   = "cv:analyze"   // analyze CVs
+)
+
+// Scopes lists the scopes a key can be given.
+var Scopes = []string{ScopeSearchRead, ScopeAlertsRead, ScopeAlertsWrite, ScopeCVAnalyze}
+
+// APIKeyPrefix starts every API key, so they're told apart from access
+// tokens and easy to spot if leaked.
+const APIKeyPrefix = "jsk_"
+
+// MaxAPIKeys is how many unrevoked keys a user can have.
+const MaxAPIKeys = 10
+
+// apiKeyTouchInterval is how stale a key's last use may get before another
+// use is recorded.
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrInvalidScope   = errors.New("invalid scope")
+	ErrTooManyAPIKeys = errors.New("too many API keys")
+)
+
+// IsAPIKey reports whether a bearer credential is an API key rather than an
+// access token.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// CreateAPIKey issues a key with the scopes for the user. The full key is
+// only returned here; afterwards it's known by its prefix.
+func (s *Service) CreateAPIKey(ctx context.Context, userID int, name string, scopes []string) (*models.CreatedAPIKey, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one is required", ErrInvalidScope)
+	}
+	// Keep the scopes in a canonical order, without duplicates
+	var granted []string
+	for _, scope := range Scopes {
+		if slices.Contains(scopes, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidScope, scope)
+		}
+	}
+
+	active, err := s.APIKeys.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(active) >= MaxAPIKeys {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	prefix := APIKeyPrefix + hex.EncodeToString(id)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	k := models.APIKey{
+		UserID:    userID,
+		Name:      truncate(strings.TrimSpace(name), 100),
+		Prefix:    prefix,
+		Hash:      hashToken(key),
+		Scopes:    granted,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.APIKeys.Create(ctx, &k); err != nil {
+		return nil, err
+	}
+	log.Printf("[Auth] User %d created API key %s (%s)", userID, prefix, strings.Join(granted, " "))
+	return &models.CreatedAPIKey{APIKey: k, Key: key}, nil
+}
+
+// ListAPIKeys returns the user's unrevoked keys.
+func (s *Service) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	return s.APIKeys.ListActive(ctx, userID)
+}
+
+// RevokeAPIKey revokes one of the user's keys. It stops working right away.
+// Returns repository.ErrNotFound for keys that don't exist, aren't the
+// user's or were already revoked.
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, id int) error {
+	return s.APIKeys.Revoke(ctx, userID, id, time.Now())
+}
+
+// AuthenticateAPIKey resolves an API key to its user, recording the use.
+// Unknown keys get ErrInvalidToken and revoked ones ErrTokenRevoked, like
+// access tokens.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, key string) (*models.User, *models.APIKey, error) {
+	// jsk_<8 hex chars>_<secret>
+	n := len(APIKeyPrefix) + 8
+	if !IsAPIKey(key) || len(key) <= n+1 || key[n] != '_' {
+		return nil, nil, ErrInvalidToken
+	}
+	k, err := s.APIKeys.GetByPrefix(ctx, key[:n])
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashToken(key))) != 1 {
+		return nil, nil, ErrInvalidToken
+	}
+	if k.RevokedAt != nil {
+		return nil, nil, ErrTokenRevoked
+	}
+
+	user, err := s.Users.GetByID(ctx, k.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	if err := s.APIKeys.Touch(ctx, k.ID, now, now.Add(-apiKeyTouchInterval)); err != nil {
+		log.Printf("[Auth] Failed to record use of API key %s: %v", k.Prefix, err)
+	}
+	return user, k, nil
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MinKeyLength is the shortest accepted HS256 secret, in bytes.
+const MinKeyLength = 32
+
+// KeySet holds the HMAC secrets tokens are signed with, by key ID. The
+// signing key issues new tokens; the others are only accepted, so a rotated
+// key keeps working until the tokens signed with it expire.
+type KeySet struct {
+	signingID string
+	keys      map[string][]byte
+}
+
+// ParseKeys reads "kid:secret" entries separated by commas or newlines. The
+// first entry is the signing key. Blank lines and lines starting with # are
+// skipped, so the same format works for a keyfile.
+func ParseKeys(spec string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string][]byte)}
+	for _, line := range strings.Split(spec, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			kid, secret, ok := strings.Cut(entry, ":")
+			kid = strings.TrimSpace(kid)
+			if !ok || kid == "" {
+				return nil, errors.New("invalid key entry: want kid:secret")
+			}
+			if len(secret) < MinKeyLength {
+				return nil, fmt.Errorf("key %q is shorter than %d bytes", kid, MinKeyLength)
+			}
+			if _, dup := ks.keys[kid]; dup {
+				return nil, fmt.Errorf("duplicate key id %q", kid)
+			}
+			ks.keys[kid] = []byte(secret)
+			if ks.signingID == "" {
+				ks.signingID = kid
+			}
+		}
+	}
+	if ks.signingID == "" {
+		return nil, errors.New("no signing keys")
+	}
+	return ks, nil
+}
+
+// LoadKeys reads the key set from JWT_KEYS_FILE, or else JWT_SIGNING_KEYS
+// (both in the ParseKeys format), or else a single JWT_SECRET with key ID
+// "default". Without any of them it generates a random key, which is fine
+// for development but logs everyone out on restart.
+func LoadKeys() (*KeySet, error) {
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading JWT_KEYS_FILE: %w", err)
+		}
+		return ParseKeys(string(data))
+	}
+	if spec := os.Getenv("JWT_SIGNING_KEYS"); spec != "" {
+		return ParseKeys(spec)
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return ParseKeys("default:" + secret)
+	}
+
+	log.Println("[Auth] No JWT signing keys configured; using a random key. Tokens won't survive a restart.")
+	secret := make([]byte, MinKeyLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return ParseKeys("ephemeral:" + hex.EncodeToString(secret))
+}
+
+// SigningKeyID is the kid of the key new tokens are signed with.
+func (ks *KeySet) SigningKeyID() string {
+	return ks.signingID
+}
+
+// sign signs claims with the signing key, naming it in the kid header.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ks.signingID
+	return token.SignedString(ks.keys[ks.signingID])
+}
+
+// keyFunc picks the verification key by the token's kid. Tokens without a
+// known kid are rejected, including those signed before keys were
+// configurable.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
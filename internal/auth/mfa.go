@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+	"jobseek-web-be/internal/totp"
+)
+
+// PurposeMFAPending marks the token a 2FA login is finished with.
+const PurposeMFAPending = "mfa_pending"
+
+// MFATokenTTL is how long the user has to enter their code after the
+// password.
+const MFATokenTTL = 5 * time.Minute
+
+// RecoveryCodeCount is how many recovery codes are issued on activation.
+const RecoveryCodeCount = 10
+
+var (
+	ErrMFANotEnrolled = errors.New("two-factor authentication is not set up")
+	ErrInvalidMFACode = errors.New("invalid authentication code")
+)
+
+// MFARequiredError is returned by LoginUser for accounts with 2FA. The
+// password was right; Token finishes the login together with a code.
+type MFARequiredError struct {
+	Token string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "two-factor authentication required"
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollMFA starts setting up 2FA with a new secret. It isn't enforced until
+// ActivateMFA confirms the user's authenticator app produces valid codes.
+func (s *Service) EnrollMFA(ctx context.Context, userID int, email string) (*models.MFAEnrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.MFA.SavePending(ctx, userID, secret, time.Now()); err != nil {
+		return nil, err
+	}
+	issuer := os.Getenv("APP_NAME")
+	if issuer == "" {
+		issuer = "JobSeek"
+	}
+	return &models.MFAEnrollment{Secret: secret, URI: totp.URI(issuer, email, secret)}, nil
+}
+
+// ActivateMFA turns on a pending enrollment once code checks out, returning
+// the recovery codes. Only their hashes are stored, so they're shown once.
+func (s *Service) ActivateMFA(ctx context.Context, userID int, code string) ([]string, error) {
+	m, err := s.MFA.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrMFANotEnrolled
+	} else if err != nil {
+		return nil, err
+	}
+	if m.EnabledAt != nil {
+		return nil, repository.ErrMFAEnabled
+	}
+	counter, ok := totp.Validate(m.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		c := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		codes[i] = c[:4] + "-" + c[4:]
+		hashes[i] = hashToken(c)
+	}
+	if err := s.MFA.Enable(ctx, userID, counter, hashes, time.Now()); err != nil {
+		return nil, err
+	}
+	log.Printf("[Auth] User %d enabled two-factor authentication", userID)
+	return codes, nil
+}
+
+// CompleteMFALogin finishes a login with the token from LoginUser and an
+// authenticator or recovery code. Wrong codes count as failed logins, so
+// guessing them is throttled like guessing passwords. The token survives
+// wrong codes until it expires.
+func (s *Service) CompleteMFALogin(ctx context.Context, mfaToken, code string, client ClientInfo) (*models.User, *TokenPair, error) {
+	jti, userID, err := s.parseUserToken(mfaToken, PurposeMFAPending)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.Users.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, ErrInvalidUserToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.checkCode(ctx, user, code, client.IP); err != nil {
+		return nil, nil, err
+	}
+	if err := s.useUserToken(ctx, jti, userID, PurposeMFAPending); err != nil {
+		return nil, nil, err
+	}
+	return s.finishLogin(ctx, user, client)
+}
+
+// DisableMFA turns 2FA off after checking a current code.
+func (s *Service) DisableMFA(ctx context.Context, userID int, code, ip string) error {
+	if enabled, err := s.mfaEnabled(ctx, userID); err != nil {
+		return err
+	} else if !enabled {
+		return ErrMFANotEnrolled
+	}
+	user, err := s.Users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkCode(ctx, user, code, ip); err != nil {
+		return err
+	}
+	if err := s.MFA.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+	log.Printf("[Auth] User %d disabled two-factor authentication", user.ID)
+	return nil
+}
+
+// MFAStatus reports whether 2FA is on and how many recovery codes are left.
+func (s *Service) MFAStatus(ctx context.Context, userID int) (bool, int, error) {
+	enabled, err := s.mfaEnabled(ctx, userID)
+	if err != nil || !enabled {
+		return false, 0, err
+	}
+	left, err := s.MFA.RecoveryCodesLeft(ctx, userID)
+	return true, left, err
+}
+
+func (s *Service) mfaEnabled(ctx context.Context, userID int) (bool, error) {
+	m, err := s.MFA.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return m.EnabledAt != nil, nil
+}
+
+// checkCode accepts a current authenticator code not used before, or an
+// unused recovery code, under the same throttling as passwords.
+func (s *Service) checkCode(ctx context.Context, user *models.User, code, ip string) error {
+	account := accountSubject(user.Email)
+	now := time.Now().UTC()
+	if err := s.checkThrottle(ctx, ip, account, now); err != nil {
+		return err
+	}
+
+	ok, err := s.matchCode(ctx, user.ID, code, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := s.recordLoginFailure(ctx, ip, account, user, now); err != nil {
+			return err
+		}
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *Service) matchCode(ctx context.Context, userID int, code string, now time.Time) (bool, error) {
+	m, err := s.MFA.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if counter, ok := totp.Validate(m.Secret, code, now); ok {
+		return s.MFA.UseCounter(ctx, userID, counter)
+	}
+
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(normalized) != 8 {
+		return false, nil
+	}
+	used, err := s.MFA.UseRecoveryCode(ctx, userID, hashToken(normalized), now)
+	if used {
+		log.Printf("[Auth] User %d used a recovery code", userID)
+	}
+	return used, err
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/totp"
+)
+
+// enableMFA turns 2FA on for the user, returning the secret, the step the
+// activation code was for and the recovery codes.
+func enableMFA(t *testing.T, s *Service, user *models.User) (string, int64, []string) {
+	t.Helper()
+	ctx := context.Background()
+	enrollment, err := s.EnrollMFA(ctx, user.ID, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := totp.Counter(time.Now())
+	codes, err := s.ActivateMFA(ctx, user.ID, code(t, enrollment.Secret, counter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), RecoveryCodeCount)
+	}
+	return enrollment.Secret, counter, codes
+}
+
+func code(t *testing.T, secret string, counter int64) string {
+	t.Helper()
+	c, err := totp.Code(secret, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// mfaToken logs in with the password and returns the token to finish with.
+func mfaToken(t *testing.T, s *Service, email, password string) string {
+	t.Helper()
+	_, _, err := s.LoginUser(context.Background(), models.Credentials{Email: email, Password: password}, ClientInfo{IP: "198.51.100.7"})
+	var required *MFARequiredError
+	if !errors.As(err, &required) {
+		t.Fatalf("LoginUser: got %v, want an *MFARequiredError", err)
+	}
+	return required.Token
+}
+
+func TestMFALogin(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	client := ClientInfo{IP: "198.51.100.7"}
+	user := addUser(t, store, "jane@example.com", "correct horse")
+	secret, counter, recovery := enableMFA(t, s, user)
+
+	token := mfaToken(t, s, user.Email, "correct horse")
+	next := code(t, secret, counter+1)
+	got, pair, err := s.CompleteMFALogin(ctx, token, next, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != user.ID || pair == nil || pair.AccessToken == "" {
+		t.Errorf("CompleteMFALogin = %+v, %+v", got, pair)
+	}
+
+	// Each code is single-use, including those of earlier steps in the
+	// window
+	token = mfaToken(t, s, user.Email, "correct horse")
+	for _, c := range []string{next, code(t, secret, counter)} {
+		if _, _, err := s.CompleteMFALogin(ctx, token, c, client); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("replayed code: got %v, want ErrInvalidMFACode", err)
+		}
+	}
+	// Wrong codes don't use up the token, but logging in does
+	if _, _, err := s.CompleteMFALogin(ctx, token, recovery[0], client); err != nil {
+		t.Errorf("recovery code after wrong ones: %v", err)
+	}
+	if _, _, err := s.CompleteMFALogin(ctx, token, recovery[1], client); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("reused mfa token: got %v, want ErrInvalidUserToken", err)
+	}
+}
+
+func TestMFALoginRejectsOtherTokens(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	user := addUser(t, store, "jane@example.com", "correct horse")
+	secret, counter, _ := enableMFA(t, s, user)
+
+	other, err := s.issueUserToken(ctx, user.ID, PurposeUnlockAccount, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"garbage": "not-a-token", "other purpose": other} {
+		if _, _, err := s.CompleteMFALogin(ctx, token, code(t, secret, counter+1), ClientInfo{}); !errors.Is(err, ErrInvalidUserToken) {
+			t.Errorf("%s: got %v, want ErrInvalidUserToken", name, err)
+		}
+	}
+}
+
+func TestMFARecoveryCodes(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	client := ClientInfo{IP: "198.51.100.7"}
+	user := addUser(t, store, "jane@example.com", "correct horse")
+	_, _, recovery := enableMFA(t, s, user)
+
+	// Codes are accepted without the dash and in upper case
+	if _, _, err := s.CompleteMFALogin(ctx, mfaToken(t, s, user.Email, "correct horse"), recovery[0], client); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if _, left, err := s.MFAStatus(ctx, user.ID); err != nil || left != RecoveryCodeCount-1 {
+		t.Errorf("MFAStatus: %d left, %v; want %d", left, err, RecoveryCodeCount-1)
+	}
+	if _, _, err := s.CompleteMFALogin(ctx, mfaToken(t, s, user.Email, "correct horse"), recovery[0], client); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("reused recovery code: got %v, want ErrInvalidMFACode", err)
+	}
+	other := strings.ToUpper(strings.ReplaceAll(recovery[1], "-", ""))
+	if _, _, err := s.CompleteMFALogin(ctx, mfaToken(t, s, user.Email, "correct horse"), other, client); err != nil {
+		t.Errorf("recovery code %q: %v", other, err)
+	}
+}
+
+func TestMFALoginIsThrottled(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	client := ClientInfo{IP: "198.51.100.7"}
+	user := addUser(t, store, "jane@example.com", "correct horse")
+	secret, counter, _ := enableMFA(t, s, user)
+
+	token := mfaToken(t, s, user.Email, "correct horse")
+	policy := throttlePolicies[ScopeAccount]
+	for i := 0; i < policy.delayAfter; i++ {
+		if _, _, err := s.CompleteMFALogin(ctx, token, "000000", client); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: got %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+
+	// Wrong codes count against the account like wrong passwords, so the
+	// right code has to wait, and so does the password step
+	var tooMany *TooManyAttemptsError
+	if _, _, err := s.CompleteMFALogin(ctx, token, code(t, secret, counter+1), client); !errors.As(err, &tooMany) {
+		t.Errorf("right code while throttled: got %v, want a *TooManyAttemptsError", err)
+	}
+	creds := models.Credentials{Email: user.Email, Password: "correct horse"}
+	if _, _, err := s.LoginUser(ctx, creds, ClientInfo{IP: "203.0.113.9"}); !errors.As(err, &tooMany) {
+		t.Errorf("password login while throttled: got %v, want a *TooManyAttemptsError", err)
+	}
+}
+
+func TestDisableMFA(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	user := addUser(t, store, "jane@example.com", "correct horse")
+	secret, counter, _ := enableMFA(t, s, user)
+
+	if err := s.DisableMFA(ctx, user.ID, "000000", ""); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("wrong code: got %v, want ErrInvalidMFACode", err)
+	}
+	if err := s.DisableMFA(ctx, user.ID, code(t, secret, counter+1), ""); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, _, err := s.MFAStatus(ctx, user.ID); err != nil || enabled {
+		t.Errorf("MFAStatus after disabling: %v, %v", enabled, err)
+	}
+	// Logins go straight through again
+	creds := models.Credentials{Email: user.Email, Password: "correct horse"}
+	if _, pair, err := s.LoginUser(ctx, creds, ClientInfo{}); err != nil || pair == nil {
+		t.Errorf("LoginUser: %v", err)
+	}
+}
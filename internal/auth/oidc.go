@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/oidc"
+	"jobseek-web-be/internal/repository"
+)
+
+// PurposeOIDCState marks the state kept in the browser during a provider
+// login, and PurposeOIDCLogin the token the frontend trades for a session
+// afterwards.
+const (
+	PurposeOIDCState = "oidc_state"
+	PurposeOIDCLogin = "oidc_login"
+)
+
+const (
+	// OIDCStateTTL is how long the user has to sign in at the provider.
+	OIDCStateTTL = 10 * time.Minute
+	// OIDCLoginTTL is how long the frontend has to exchange the login token.
+	OIDCLoginTTL = 2 * time.Minute
+)
+
+var (
+	// ErrInvalidOIDCState means the callback doesn't belong to a login
+	// started in this browser, or it took too long.
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	// ErrOIDCEmailUnverified means the provider didn't vouch for the
+	// user's email, so it can't be used to find or create an account.
+	ErrOIDCEmailUnverified = errors.New("the provider didn't confirm the email address")
+	// ErrOIDCAccountUnverified means an account with the email exists but
+	// was never confirmed, so whoever registered it may not own the address.
+	ErrOIDCAccountUnverified = errors.New("an unconfirmed account already uses this email")
+)
+
+// BeginOIDCLogin starts a login at the provider. It returns the URL to send
+// the user to and a signed state to keep in their browser (as a cookie) until
+// the callback, which ties the callback to this browser.
+func (s *Service) BeginOIDCLogin(ctx context.Context, p *oidc.Provider) (string, string, error) {
+	var values [3]string // state, nonce, PKCE verifier
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			return "", "", err
+		}
+		values[i] = v
+	}
+	authURL, err := p.AuthURL(ctx, values[0], values[1], oidc.Challenge(values[2]))
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	cookie, err := s.Keys.sign(jwt.MapClaims{
+		"purpose":  PurposeOIDCState,
+		"provider": p.Name,
+		"state":    values[0],
+		"nonce":    values[1],
+		"verifier": values[2],
+		"iat":      now.Unix(),
+		"exp":      now.Add(OIDCStateTTL).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, cookie, nil
+}
+
+// FinishOIDCLogin handles the provider's callback: it checks state against
+// the cookie from BeginOIDCLogin, redeems the code and finds, links or
+// creates the user's account. It returns a single-use login token for
+// ExchangeOIDCLogin rather than a session, so no long-lived token ends up in
+// a redirect URL.
+func (s *Service) FinishOIDCLogin(ctx context.Context, p *oidc.Provider, cookie, state, code string) (string, error) {
+	token, err := jwt.Parse(cookie, s.Keys.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return "", ErrInvalidOIDCState
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != PurposeOIDCState || claims["provider"] != p.Name {
+		return "", ErrInvalidOIDCState
+	}
+	want, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+	if want == "" || subtle.ConstantTimeCompare([]byte(want), []byte(state)) != 1 {
+		return "", ErrInvalidOIDCState
+	}
+
+	identity, err := p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return "", err
+	}
+	user, err := s.linkIdentity(ctx, p.Name, identity)
+	if err != nil {
+		return "", err
+	}
+	return s.issueUserToken(ctx, user.ID, PurposeOIDCLogin, OIDCLoginTTL)
+}
+
+// ExchangeOIDCLogin trades a login token from FinishOIDCLogin for a session,
+// or an *MFARequiredError if the account has 2FA.
+func (s *Service) ExchangeOIDCLogin(ctx context.Context, loginToken string, client ClientInfo) (*models.User, *TokenPair, error) {
+	userID, err := s.consumeUserToken(ctx, loginToken, PurposeOIDCLogin)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.Users.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, ErrInvalidUserToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return s.completeLogin(ctx, user, client)
+}
+
+// linkIdentity returns the user a provider identity belongs to. Identities
+// seen before map to their user. New ones are linked to the account with the
+// same email if both the provider and the account confirmed it, or else get
+// a new account.
+func (s *Service) linkIdentity(ctx context.Context, provider string, c *oidc.Claims) (*models.User, error) {
+	now := time.Now().UTC()
+	identity, err := s.Identities.GetBySubject(ctx, provider, c.Subject)
+	if err == nil {
+		if err := s.Identities.RecordLogin(ctx, identity.ID, c.Email, now); err != nil {
+			return nil, err
+		}
+		return s.Users.GetByID(ctx, identity.UserID)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	if c.Email == "" || !c.EmailVerified {
+		return nil, ErrOIDCEmailUnverified
+	}
+	user, err := s.Users.GetByEmail(ctx, c.Email)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		if user, err = s.createOIDCUser(ctx, c, now); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case user.EmailVerifiedAt == nil:
+		// Linking would let whoever registered the address log in
+		// alongside its owner
+		return nil, ErrOIDCAccountUnverified
+	}
+
+	if err := s.Identities.Create(ctx, &models.Identity{
+		UserID:      user.ID,
+		Provider:    provider,
+		Subject:     c.Subject,
+		Email:       c.Email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}); err != nil {
+		return nil, err
+	}
+	log.Printf("[Auth] Linked %s login to user %d", provider, user.ID)
+	return user, nil
+}
+
+// createOIDCUser registers a trial account for a provider login. Its random
+// password is never shown; the user can set one through a password reset.
+func (s *Service) createOIDCUser(ctx context.Context, c *oidc.Claims, now time.Time) (*models.User, error) {
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	name := c.Name
+	if name == "" {
+		name, _, _ = strings.Cut(c.Email, "@")
+	}
+
+	user := &models.User{
+		Name:             name,
+		Email:            c.Email,
+		Password:         string(hash),
+		SubscriptionPlan: "basic",
+	}
+	if err := s.Users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.Users.MarkEmailVerified(ctx, user.ID, now); err != nil {
+		return nil, err
+	}
+	user.EmailVerifiedAt = &now
+	return user, nil
+}
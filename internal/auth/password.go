@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"jobseek-web-be/internal/email"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// PurposeResetPassword marks password reset tokens.
+const PurposeResetPassword = "reset_password"
+
+// ResetTokenTTL is how long a password reset link works.
+const ResetTokenTTL = time.Hour
+
+// MinPasswordLength applies to passwords chosen through reset or change.
+const MinPasswordLength = 8
+
+var (
+	ErrWrongPassword = errors.New("current password is incorrect")
+	ErrWeakPassword  = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+)
+
+// RequestPasswordReset emails a reset link if the address belongs to a user.
+// Unknown addresses and rate limited requests are only logged, so callers
+// can't tell whether an account exists.
+func (s *Service) RequestPasswordReset(ctx context.Context, address string) error {
+	user, err := s.Users.GetByEmail(ctx, address)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var tooMany *TooManyEmailsError
+	if err := s.checkEmailRate(ctx, user.ID, PurposeResetPassword); errors.As(err, &tooMany) {
+		log.Printf("[Auth] Skipping password reset for user %d: %v", user.ID, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := s.issueUserToken(ctx, user.ID, PurposeResetPassword, ResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	return email.SendPasswordReset(user.Email, user.Name, token)
+}
+
+// ResetPassword sets a new password with a token from a reset email. The
+// token also proves the user owns the address, so it counts as verified and
+// lifts any lockout of the account.
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	userID, err := s.consumeUserToken(ctx, token, PurposeResetPassword)
+	if err != nil {
+		return err
+	}
+	user, err := s.Users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.setPassword(ctx, user, password); err != nil {
+		return err
+	}
+	if err := s.UserTokens.Invalidate(ctx, user.ID, PurposeResetPassword, time.Now()); err != nil {
+		return err
+	}
+	if err := s.Users.MarkEmailVerified(ctx, user.ID, time.Now()); err != nil {
+		return err
+	}
+	if err := s.clearAccountLockout(ctx, user, UnlockedByPasswordReset); err != nil {
+		return err
+	}
+	log.Printf("[Auth] User %d reset their password", user.ID)
+	return nil
+}
+
+// ChangePassword replaces the password after checking the current one. Wrong
+// passwords count against the same throttle as failed logins, so a stolen
+// access token can't be used to guess the password. Every session ends, so
+// it starts a new one for the client that made the change.
+func (s *Service) ChangePassword(ctx context.Context, userID int, current, password string, client ClientInfo) (*models.User, *TokenPair, error) {
+	user, err := s.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	account := accountSubject(user.Email)
+	now := time.Now().UTC()
+	if err := s.checkThrottle(ctx, client.IP, account, now); err != nil {
+		return nil, nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)); err != nil {
+		if err := s.recordLoginFailure(ctx, client.IP, account, user, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrWrongPassword
+	}
+	if len(password) < MinPasswordLength {
+		return nil, nil, ErrWeakPassword
+	}
+
+	if err := s.setPassword(ctx, user, password); err != nil {
+		return nil, nil, err
+	}
+	log.Printf("[Auth] User %d changed their password", user.ID)
+
+	// The token version was bumped, so reload it before issuing new tokens
+	user, err = s.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.finishLogin(ctx, user, client)
+}
+
+// setPassword stores the new password, revokes every session and token of
+// the user and lets them know by email.
+func (s *Service) setPassword(ctx context.Context, user *models.User, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.Users.SetPassword(ctx, user.ID, string(hash)); err != nil {
+		return err
+	}
+	if err := s.RevokeAllTokens(ctx, user.ID, RevokedPassword); err != nil {
+		return err
+	}
+	if err := email.SendPasswordChanged(user.Email, user.Name); err != nil {
+		log.Printf("[Auth] Failed to send password change notice to user %d: %v", user.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/models"
+)
+
+// apiKey creates an API key for the user and returns it.
+func apiKey(t *testing.T, s *Service, userID int) string {
+	t.Helper()
+	key, err := s.CreateAPIKey(context.Background(), userID, "script", []string{ScopeSearchRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.Key
+}
+
+func TestRevokeAllTokensRevokesAPIKeys(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		revoke func(t *testing.T, s *Service, user *models.User)
+	}{
+		{"password change", func(t *testing.T, s *Service, user *models.User) {
+			if _, _, err := s.ChangePassword(context.Background(), user.ID, "correct horse", "battery staple", ClientInfo{}); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"password reset", func(t *testing.T, s *Service, user *models.User) {
+			token, err := s.issueUserToken(context.Background(), user.ID, PurposeResetPassword, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.ResetPassword(context.Background(), token, "battery staple"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"logout everywhere", func(t *testing.T, s *Service, user *models.User) {
+			if err := s.RevokeAllTokens(context.Background(), user.ID, RevokedLogoutAll); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, store := newTestService(t)
+			ctx := context.Background()
+			user := addUser(t, store, "jane@example.com", "correct horse")
+			other := addUser(t, store, "bob@example.com", "correct horse")
+			keys := []string{apiKey(t, s, user.ID), apiKey(t, s, user.ID)}
+			kept := apiKey(t, s, other.ID)
+
+			tc.revoke(t, s, user)
+
+			for _, key := range keys {
+				if _, _, err := s.AuthenticateAPIKey(ctx, key); !errors.Is(err, ErrTokenRevoked) {
+					t.Errorf("API key after revoking: got %v, want ErrTokenRevoked", err)
+				}
+			}
+			if _, _, err := s.AuthenticateAPIKey(ctx, kept); err != nil {
+				t.Errorf("another user's API key: %v", err)
+			}
+			// Keys created afterwards work
+			if _, _, err := s.AuthenticateAPIKey(ctx, apiKey(t, s, user.ID)); err != nil {
+				t.Errorf("new API key: %v", err)
+			}
+		})
+	}
+}
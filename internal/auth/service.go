@@ -1,39 +1,57 @@
 package auth
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"log"
 	"time"
 
-	"jobseek-web-be/internal/db"
 	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var SecretKey = []byte("super-secret-key-change-this-in-prod")
+// Service registers users, issues login tokens and validates them.
+type Service struct {
+	Users         repository.UserRepository
+	Revocations   repository.TokenRevocationRepository
+	Sessions      repository.SessionRepository
+	UserTokens    repository.UserTokenRepository
+	LoginAttempts repository.LoginAttemptRepository
+	MFA           repository.MFARepository
+	Identities    repository.IdentityRepository
+	APIKeys       repository.APIKeyRepository
+	Keys          *KeySet
+}
+
+func NewService(keys *KeySet, store *repository.Store) *Service {
+	return &Service{
+		Users:         store.Users,
+		Revocations:   store.Revocations,
+		Sessions:      store.Sessions,
+		UserTokens:    store.UserTokens,
+		LoginAttempts: store.LoginAttempts,
+		MFA:           store.MFA,
+		Identities:    store.Identities,
+		APIKeys:       store.APIKeys,
+		Keys:          keys,
+	}
+}
 
-func RegisterUser(req models.RegisterRequest) error {
+func (s *Service) RegisterUser(ctx context.Context, req models.RegisterRequest) error {
 	// 1. Check if user exists
-	var exists bool
-	err := db.DB.QueryRow("SELECT exists(SELECT 1 FROM users WHERE email=?)", req.Email).Scan(&exists)
-	if err != nil && err != sql.ErrNoRows {
+	exists, err := s.Users.EmailExists(ctx, req.Email)
+	if err != nil {
 		return err
 	}
 	if exists {
-		return errors.New("user already exists")
+		return repository.ErrEmailTaken
 	}
 
-	// 2. Mock payment verification for 'pro' plan
-	if req.Subscription == "pro" {
-		if req.PaymentToken == "" {
-			return errors.New("payment token required for pro plan")
-		}
-		// In a real app, verify Stripe token here
-		log.Printf("Verifying mocked payment token %s for user %s", req.PaymentToken, req.Email)
-	} else {
+	// 2. The chosen plan is only preselected; it's paid for through a
+	// billing checkout after registering
+	if req.Subscription != "pro" {
 		req.Subscription = "basic"
 	}
 
@@ -44,58 +62,84 @@ func RegisterUser(req models.RegisterRequest) error {
 	}
 
 	// 4. Insert user as trial user (paid = 0)
-	_, err = db.DB.Exec(
-		"INSERT INTO users(name, email, password, subscription_plan, paid) VALUES(?, ?, ?, ?, 0)",
-		req.Name, req.Email, string(hashedPassword), req.Subscription,
-	)
-	return err
-}
-
-func LoginUser(creds models.Credentials) (string, string, string, error) {
-	var storedPassword string
-	var subscription string
-	var name string
-	var createdAt time.Time
-	var paid bool
-
-	err := db.DB.QueryRow(
-		"SELECT password, subscription_plan, name, created_at, paid FROM users WHERE email=?",
-		creds.Email,
-	).Scan(&storedPassword, &subscription, &name, &createdAt, &paid)
-
-	if err == sql.ErrNoRows {
-		return "", "", "", errors.New("Invalid credentials")
-	} else if err != nil {
-		return "", "", "", err
+	user := &models.User{
+		Name:             req.Name,
+		Email:            req.Email,
+		Password:         string(hashedPassword),
+		SubscriptionPlan: req.Subscription,
+	}
+	if err := s.Users.Create(ctx, user); err != nil {
+		return err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(creds.Password)); err != nil {
-		return "", "", "", errors.New("Invalid credentials")
+	// 5. Ask them to confirm the address. Alerts wait until they do, and
+	// they can request another link if this one gets lost.
+	if err := s.SendVerification(ctx, user); err != nil {
+		log.Printf("[Auth] Failed to send verification email to user %d: %v", user.ID, err)
 	}
+	return nil
+}
 
-	// Calculate trial end date (7 days from account creation)
-	trialEndsAt := createdAt.Add(7 * 24 * time.Hour)
+// dummyHash is compared against when the account doesn't exist, so a login
+// takes as long either way and timing doesn't reveal registered addresses.
+const dummyHash = "$2a$10$X2/MHlK2ievzyRjLaBDMYOlKGCsm/pcQoZ///xKNW8UI589Ja7yAS"
+
+// LoginUser checks the credentials and starts a session on the client's
+// device. Failures are throttled per IP and account (see checkThrottle), and
+// while throttled it returns a *TooManyAttemptsError without checking the
+// password at all. Accounts with 2FA get an *MFARequiredError instead of a
+// session, carrying the token to finish with CompleteMFALogin.
+func (s *Service) LoginUser(ctx context.Context, creds models.Credentials, client ClientInfo) (*models.User, *TokenPair, error) {
+	account := accountSubject(creds.Email)
+	now := time.Now().UTC()
+	if err := s.checkThrottle(ctx, client.IP, account, now); err != nil {
+		return nil, nil, err
+	}
 
-	// Check if trial has expired (only for non-paid users)
-	if !paid && time.Now().After(trialEndsAt) {
-		return "", "", "", errors.New("Trial period has expired - please upgrade your subscription")
+	user, err := s.Users.GetByEmail(ctx, creds.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, err
 	}
 
-	// Generate JWT
-	claims := jwt.MapClaims{
-		"email": creds.Email,
-		"name":  name,
-		"sub":   subscription,
-		"paid":  paid,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
+	hash := dummyHash
+	if user != nil {
+		hash = user.Password
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(creds.Password)); err != nil || user == nil {
+		if err := s.recordLoginFailure(ctx, client.IP, account, user, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	// Add trial info for non-paid users
-	if !paid {
-		claims["trial_ends_at"] = trialEndsAt.Unix()
+	// Expired trials can still log in; entitlements restrict what they can do
+	client.Device = creds.Device
+	return s.completeLogin(ctx, user, client)
+}
+
+// completeLogin starts a session for a user who proved who they are, or
+// returns an *MFARequiredError if their account has 2FA.
+func (s *Service) completeLogin(ctx context.Context, user *models.User, client ClientInfo) (*models.User, *TokenPair, error) {
+	if enabled, err := s.mfaEnabled(ctx, user.ID); err != nil {
+		return nil, nil, err
+	} else if enabled {
+		token, err := s.issueUserToken(ctx, user.ID, PurposeMFAPending, MFATokenTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, &MFARequiredError{Token: token}
 	}
+	return s.finishLogin(ctx, user, client)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(SecretKey)
-	return tokenString, subscription, name, err
+// finishLogin forgets the account's failed logins and starts the session.
+func (s *Service) finishLogin(ctx context.Context, user *models.User, client ClientInfo) (*models.User, *TokenPair, error) {
+	if err := s.LoginAttempts.Clear(ctx, ScopeAccount, accountSubject(user.Email)); err != nil {
+		return nil, nil, err
+	}
+	pair, err := s.StartSession(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, pair, nil
 }
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestService returns a service with a signing key, backed by an
+// in-memory store.
+func newTestService(t *testing.T) (*Service, *repository.Store) {
+	t.Helper()
+	keys, err := ParseKeys("test:" + strings.Repeat("k", MinKeyLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := repository.NewMemoryStore()
+	return NewService(keys, store), store
+}
+
+// addUser stores a user who logs in with password.
+func addUser(t *testing.T, store *repository.Store, email, password string) *models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := models.User{Name: "Test User", Email: email, Password: string(hash)}
+	if err := store.Users.Create(context.Background(), &u); err != nil {
+		t.Fatal(err)
+	}
+	return &u
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// RefreshTokenTTL is how long a session survives without being refreshed.
+// Every refresh extends it.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// Reasons recorded when a session is revoked.
+const (
+	RevokedLogout     = "logout"
+	RevokedLogoutAll  = "logout_all"
+	RevokedByUser     = "revoked_by_user"
+	RevokedTokenReuse = "refresh_token_reuse"
+	RevokedPassword   = "password_changed"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused means an already rotated refresh token was
+	// presented, so it was probably stolen. The session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// ClientInfo describes the device a session was started from.
+type ClientInfo struct {
+	Device    string
+	UserAgent string
+	IP        string
+}
+
+// TokenPair is what a client holds for a session: a short-lived access token
+// and the refresh token that renews it.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	SessionID    int
+}
+
+// StartSession creates a session for the user and issues its first tokens.
+func (s *Service) StartSession(ctx context.Context, user *models.User, client ClientInfo) (*TokenPair, error) {
+	refresh, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	sess := &models.Session{
+		UserID:     user.ID,
+		TokenHash:  hash,
+		Device:     truncate(client.Device, 100),
+		UserAgent:  truncate(client.UserAgent, 300),
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+	if err := s.Sessions.Create(ctx, sess); err != nil {
+		return nil, err
+	}
+
+	access, err := s.IssueToken(user, sess.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: access, RefreshToken: refresh, SessionID: sess.ID}, nil
+}
+
+// Refresh rotates a session's refresh token and issues a new access token.
+// Presenting a refresh token that was already rotated revokes the session,
+// since either the client or an attacker holds a stale copy.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*models.User, *TokenPair, error) {
+	hash := hashToken(refreshToken)
+	now := time.Now().UTC()
+
+	sess, err := s.Sessions.GetByTokenHash(ctx, hash)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, s.checkReuse(ctx, hash, now)
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if sess.RevokedAt != nil || !sess.ExpiresAt.After(now) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.Users.GetByID(ctx, sess.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	refresh, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	rotated, err := s.Sessions.Rotate(ctx, sess.ID, hash, newHash, now, now.Add(RefreshTokenTTL))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !rotated {
+		// A concurrent refresh with the same token won the race
+		return nil, nil, s.checkReuse(ctx, hash, now)
+	}
+
+	access, err := s.IssueToken(user, sess.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, &TokenPair{AccessToken: access, RefreshToken: refresh, SessionID: sess.ID}, nil
+}
+
+// checkReuse revokes the session a rotated-out refresh token belonged to.
+func (s *Service) checkReuse(ctx context.Context, hash string, now time.Time) error {
+	sessionID, err := s.Sessions.FindRotated(ctx, hash)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidRefreshToken
+	} else if err != nil {
+		return err
+	}
+
+	sess, err := s.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if sess.RevokedAt == nil {
+		log.Printf("[Auth] Refresh token reuse on session %d of user %d; revoking it", sess.ID, sess.UserID)
+		if err := s.Sessions.Revoke(ctx, sess.UserID, sess.ID, RevokedTokenReuse, now); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+	}
+	return ErrRefreshTokenReused
+}
+
+// EndSession logs out of one session. The access token it was called with
+// is revoked too, since it would otherwise stay usable until it expires.
+func (s *Service) EndSession(ctx context.Context, userID int, t *Token) error {
+	if t.SessionID != 0 {
+		err := s.Sessions.Revoke(ctx, userID, t.SessionID, RevokedLogout, time.Now())
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+	}
+	return s.RevokeToken(ctx, userID, t)
+}
+
+// ListSessions returns the user's active sessions, flagging currentID.
+func (s *Service) ListSessions(ctx context.Context, userID, currentID int) ([]models.Session, error) {
+	sessions, err := s.Sessions.ListActive(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions. Its access tokens stop
+// working right away. Returns repository.ErrNotFound for sessions that don't
+// exist, aren't the user's or already ended.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID int) error {
+	return s.Sessions.Revoke(ctx, userID, sessionID, RevokedByUser, time.Now())
+}
+
+// RevokeOtherSessions ends all of the user's sessions except currentID.
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, currentID int) (int64, error) {
+	return s.Sessions.RevokeAll(ctx, userID, currentID, RevokedByUser, time.Now())
+}
+
+// newRefreshToken returns a random refresh token and the hash it's stored
+// as. Only the hash is kept, so a database leak doesn't expose sessions.
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken is how refresh tokens and emailed token IDs are stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate caps client-supplied metadata, dropping any rune cut in half.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return strings.ToValidUTF8(s[:n], "")
+	}
+	return s
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"jobseek-web-be/internal/email"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// Login failures are counted per client IP and per account email. After a
+// few failures each further attempt has to wait a doubling delay, and enough
+// failures lock the IP or account out for LockoutDuration. Counts are
+// forgotten FailureWindow after the last failure, and an account's count
+// when it logs in successfully.
+const (
+	ScopeIP      = "ip"
+	ScopeAccount = "account"
+
+	FailureWindow   = time.Hour
+	LockoutDuration = 15 * time.Minute
+	MaxLoginDelay   = 30 * time.Second
+)
+
+// PurposeUnlockAccount marks the tokens in lockout emails.
+const PurposeUnlockAccount = "unlock_account"
+
+// UnlockTokenTTL is how long the unlock link in a lockout email works.
+const UnlockTokenTTL = 24 * time.Hour
+
+// throttlePolicy is when delays and the lockout start, in failures.
+type throttlePolicy struct {
+	delayAfter int
+	lockAfter  int
+}
+
+// IPs get more leeway than accounts since offices and mobile carriers put
+// many users behind one address.
+var throttlePolicies = map[string]throttlePolicy{
+	ScopeIP:      {delayAfter: 10, lockAfter: 50},
+	ScopeAccount: {delayAfter: 3, lockAfter: 10},
+}
+
+// Unlock methods recorded in the lockout audit trail.
+const (
+	UnlockedByEmail         = "email"
+	UnlockedByPasswordReset = "password_reset"
+)
+
+var ErrInvalidCredentials = errors.New("Invalid credentials")
+
+// TooManyAttemptsError is returned by LoginUser and the other password and
+// code checks while the IP or account has to wait before trying again. It's
+// the same for accounts that don't exist.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("Too many failed login attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// loginDelay is how long to wait after the latest of failures.
+func (p throttlePolicy) loginDelay(failures int) time.Duration {
+	if failures < p.delayAfter {
+		return 0
+	}
+	if n := failures - p.delayAfter; n < 5 {
+		return min(time.Second<<n, MaxLoginDelay)
+	}
+	return MaxLoginDelay
+}
+
+// throttled is an IP or account that login failures are counted for.
+type throttled struct {
+	scope, subject string
+}
+
+func throttledBy(ip, account string) []throttled {
+	return []throttled{{ScopeIP, ip}, {ScopeAccount, account}}
+}
+
+// accountSubject normalizes an email for counting, so case variations share
+// one count.
+func accountSubject(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// checkThrottle returns a *TooManyAttemptsError if the IP or account is
+// locked out or still waiting out its delay.
+func (s *Service) checkThrottle(ctx context.Context, ip, account string, now time.Time) error {
+	var wait time.Duration
+	for _, t := range throttledBy(ip, account) {
+		if t.subject == "" {
+			continue
+		}
+		f, err := s.LoginAttempts.Get(ctx, t.scope, t.subject)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		until := f.LastFailedAt.Add(throttlePolicies[t.scope].loginDelay(f.Failures))
+		if f.LockedUntil != nil && f.LockedUntil.After(until) {
+			until = *f.LockedUntil
+		}
+		if d := until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return &TooManyAttemptsError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login for the IP and account, locking
+// out whichever reached its limit. user is nil for unknown accounts.
+func (s *Service) recordLoginFailure(ctx context.Context, ip, account string, user *models.User, now time.Time) error {
+	for _, t := range throttledBy(ip, account) {
+		if t.subject == "" {
+			continue
+		}
+		f, err := s.LoginAttempts.RecordFailure(ctx, t.scope, t.subject, now, now.Add(-FailureWindow))
+		if err != nil {
+			return err
+		}
+		if f.Failures < throttlePolicies[t.scope].lockAfter {
+			continue
+		}
+
+		// Only the request that actually set the lock records and
+		// reports it
+		until := now.Add(LockoutDuration)
+		locked, err := s.LoginAttempts.Lock(ctx, t.scope, t.subject, now, until)
+		if err != nil {
+			return err
+		}
+		if !locked {
+			continue
+		}
+		lockout := &models.Lockout{
+			Scope:       t.scope,
+			Subject:     t.subject,
+			IP:          ip,
+			Failures:    f.Failures,
+			LockedAt:    now,
+			LockedUntil: until,
+		}
+		if t.scope == ScopeAccount && user != nil {
+			lockout.UserID = user.ID
+		}
+		if err := s.LoginAttempts.RecordLockout(ctx, lockout); err != nil {
+			return err
+		}
+		log.Printf("[Auth] Locked out %s %s after %d failed logins (last from %s) until %s", t.scope, t.subject, f.Failures, ip, until.Format(time.RFC3339))
+
+		if lockout.UserID != 0 {
+			if err := s.sendUnlock(ctx, user, until); err != nil {
+				log.Printf("[Auth] Failed to send unlock email to user %d: %v", user.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sendUnlock tells the owner of a locked account and gives them a link to
+// unlock it right away.
+func (s *Service) sendUnlock(ctx context.Context, user *models.User, until time.Time) error {
+	if err := s.checkEmailRate(ctx, user.ID, PurposeUnlockAccount); err != nil {
+		return err
+	}
+	token, err := s.issueUserToken(ctx, user.ID, PurposeUnlockAccount, UnlockTokenTTL)
+	if err != nil {
+		return err
+	}
+	return email.SendAccountLocked(user.Email, user.Name, token, until)
+}
+
+// UnlockAccount lifts an account lockout with the token from a lockout
+// email. The IP lockouts of the attacker aren't affected.
+func (s *Service) UnlockAccount(ctx context.Context, token string) error {
+	userID, err := s.consumeUserToken(ctx, token, PurposeUnlockAccount)
+	if err != nil {
+		return err
+	}
+	user, err := s.Users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.clearAccountLockout(ctx, user, UnlockedByEmail); err != nil {
+		return err
+	}
+	log.Printf("[Auth] User %d unlocked their account by email", user.ID)
+	return nil
+}
+
+// clearAccountLockout forgets the account's failures, closing any lockout
+// still in force in the audit trail.
+func (s *Service) clearAccountLockout(ctx context.Context, user *models.User, method string) error {
+	subject := accountSubject(user.Email)
+	if err := s.LoginAttempts.MarkUnlocked(ctx, ScopeAccount, subject, method, time.Now()); err != nil {
+		return err
+	}
+	return s.LoginAttempts.Clear(ctx, ScopeAccount, subject)
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+func TestLoginDelay(t *testing.T) {
+	p := throttlePolicies[ScopeAccount]
+	for _, tc := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{7, 16 * time.Second},
+		{8, MaxLoginDelay},
+		{100, MaxLoginDelay},
+	} {
+		if got := p.loginDelay(tc.failures); got != tc.want {
+			t.Errorf("loginDelay(%d) = %s, want %s", tc.failures, got, tc.want)
+		}
+	}
+}
+
+// fail records n failed logins of the account at now.
+func fail(t *testing.T, s *Service, ip, account string, user *models.User, now time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := s.recordLoginFailure(context.Background(), ip, account, user, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// retryAfter returns how long checkThrottle makes the client wait at now.
+func retryAfter(t *testing.T, s *Service, ip, account string, now time.Time) time.Duration {
+	t.Helper()
+	err := s.checkThrottle(context.Background(), ip, account, now)
+	var throttled *TooManyAttemptsError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return 0
+}
+
+func TestThrottleDelay(t *testing.T) {
+	s, _ := newTestService(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	fail(t, s, "", "jane@example.com", nil, now, 2)
+	if d := retryAfter(t, s, "", "jane@example.com", now); d != 0 {
+		t.Errorf("throttled after 2 failures: %s", d)
+	}
+	fail(t, s, "", "jane@example.com", nil, now, 1)
+	if d := retryAfter(t, s, "", "jane@example.com", now); d != time.Second {
+		t.Errorf("wait after 3 failures = %s, want 1s", d)
+	}
+	if d := retryAfter(t, s, "", "jane@example.com", now.Add(time.Second)); d != 0 {
+		t.Errorf("still throttled once the delay passed: %s", d)
+	}
+	fail(t, s, "", "jane@example.com", nil, now.Add(time.Second), 1)
+	if d := retryAfter(t, s, "", "jane@example.com", now.Add(time.Second)); d != 2*time.Second {
+		t.Errorf("wait after 4 failures = %s, want 2s", d)
+	}
+
+	// Other accounts and IPs aren't affected
+	if d := retryAfter(t, s, "198.51.100.7", "bob@example.com", now); d != 0 {
+		t.Errorf("another account throttled: %s", d)
+	}
+}
+
+func TestThrottleLockout(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	user := addUser(t, store, "jane@example.com", "correct horse")
+	account := accountSubject(user.Email)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	fail(t, s, "198.51.100.7", account, user, now, throttlePolicies[ScopeAccount].lockAfter)
+	if d := retryAfter(t, s, "", account, now); d != LockoutDuration {
+		t.Errorf("wait after lockout = %s, want %s", d, LockoutDuration)
+	}
+	f, err := store.LoginAttempts.Get(ctx, ScopeAccount, account)
+	if err != nil || f.LockedUntil == nil || !f.LockedUntil.Equal(now.Add(LockoutDuration)) {
+		t.Fatalf("account failures = %+v, %v, want a lock until %s", f, err, now.Add(LockoutDuration))
+	}
+	// The IP has more leeway: it only starts its delays
+	if d := retryAfter(t, s, "198.51.100.7", "bob@example.com", now); d != time.Second {
+		t.Errorf("IP wait after %d failures = %s, want 1s", throttlePolicies[ScopeAccount].lockAfter, d)
+	}
+
+	// The lockout outlasts the longest delay and ends on time
+	if d := retryAfter(t, s, "", account, now.Add(MaxLoginDelay)); d != LockoutDuration-MaxLoginDelay {
+		t.Errorf("wait after the longest delay = %s", d)
+	}
+	if d := retryAfter(t, s, "", account, now.Add(LockoutDuration)); d != 0 {
+		t.Errorf("still throttled after the lockout: %s", d)
+	}
+
+	// Unlocking by email clears the count right away
+	fail(t, s, "", account, user, now.Add(LockoutDuration), 1)
+	if err := s.clearAccountLockout(ctx, user, UnlockedByEmail); err != nil {
+		t.Fatal(err)
+	}
+	if d := retryAfter(t, s, "", account, now.Add(LockoutDuration)); d != 0 {
+		t.Errorf("throttled after unlocking: %s", d)
+	}
+}
+
+func TestThrottleWindowExpiry(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	fail(t, s, "", "jane@example.com", nil, now, throttlePolicies[ScopeAccount].lockAfter-1)
+	later := now.Add(FailureWindow + time.Second)
+	if d := retryAfter(t, s, "", "jane@example.com", later); d != 0 {
+		t.Errorf("throttled after the window: %s", d)
+	}
+
+	// The next failure starts a new count instead of locking the account
+	fail(t, s, "", "jane@example.com", nil, later, 1)
+	f, err := store.LoginAttempts.Get(ctx, ScopeAccount, "jane@example.com")
+	if err != nil || f.Failures != 1 || f.LockedUntil != nil {
+		t.Errorf("failures after the window = %+v, %v, want a new count of 1", f, err)
+	}
+	if d := retryAfter(t, s, "", "jane@example.com", later); d != 0 {
+		t.Errorf("throttled after 1 failure: %s", d)
+	}
+}
+
+func TestChangePasswordIsThrottled(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	user := addUser(t, store, "Jane@example.com", "correct horse")
+	client := ClientInfo{IP: "198.51.100.7"}
+
+	for i := 0; i < throttlePolicies[ScopeAccount].delayAfter; i++ {
+		if _, _, err := s.ChangePassword(ctx, user.ID, "wrong", "battery staple", client); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("attempt %d: got %v, want ErrWrongPassword", i+1, err)
+		}
+	}
+
+	// Even the right password has to wait, and so does logging in
+	var throttled *TooManyAttemptsError
+	if _, _, err := s.ChangePassword(ctx, user.ID, "correct horse", "battery staple", client); !errors.As(err, &throttled) {
+		t.Errorf("ChangePassword after failures: got %v, want TooManyAttemptsError", err)
+	}
+	creds := models.Credentials{Email: "jane@example.com", Password: "correct horse"}
+	if _, _, err := s.LoginUser(ctx, creds, ClientInfo{IP: "203.0.113.9"}); !errors.As(err, &throttled) {
+		t.Errorf("LoginUser after failed password changes: got %v, want TooManyAttemptsError", err)
+	}
+
+}
+
+func TestChangePasswordClearsFailures(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	user := addUser(t, store, "jane@example.com", "correct horse")
+
+	if _, _, err := s.ChangePassword(ctx, user.ID, "wrong", "battery staple", ClientInfo{}); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("got %v, want ErrWrongPassword", err)
+	}
+	if _, pair, err := s.ChangePassword(ctx, user.ID, "correct horse", "battery staple", ClientInfo{}); err != nil || pair == nil {
+		t.Fatalf("ChangePassword = %+v, %v", pair, err)
+	}
+	if f, err := store.LoginAttempts.Get(ctx, ScopeAccount, "jane@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("failures after changing the password = %+v, %v, want none", f, err)
+	}
+}
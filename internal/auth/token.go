@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// TrialPeriod is how long an unpaid account has full access after signing up.
+const TrialPeriod = 7 * 24 * time.Hour
+
+// AccessTokenTTL is how long an access token stays valid. Clients renew it
+// with the session's refresh token.
+const AccessTokenTTL = 15 * time.Minute
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// TrialEnd returns when the trial of an account created at createdAt ends.
+func TrialEnd(createdAt time.Time) time.Time {
+	return createdAt.Add(TrialPeriod)
+}
+
+// Token is a validated token and the claims the server relies on.
+type Token struct {
+	ID        string // jti, the handle used to revoke it
+	Email     string
+	Version   int // the user's token version when it was issued
+	SessionID int // sid, the session it was issued for
+	ExpiresAt time.Time
+}
+
+// IssueToken signs an access token for the user's session with the current
+// signing key.
+func (s *Service) IssueToken(user *models.User, sessionID int) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"jti":   jti,
+		"sid":   sessionID,
+		"email": user.Email,
+		"name":  user.Name,
+		"sub":   user.SubscriptionPlan,
+		"paid":  user.Paid,
+		"ver":   user.TokenVersion,
+		"iat":   now.Unix(),
+		"exp":   now.Add(AccessTokenTTL).Unix(),
+	}
+
+	// Add trial info for non-paid users
+	if !user.Paid {
+		claims["trial_ends_at"] = TrialEnd(user.CreatedAt).Unix()
+	}
+	return s.Keys.sign(claims)
+}
+
+// ParseToken validates a token's signature, expiry and revocation status.
+// Only HS256 is accepted, so a token can't pick a weaker algorithm.
+func (s *Service) ParseToken(ctx context.Context, tokenString string) (*Token, error) {
+	token, err := jwt.Parse(tokenString, s.Keys.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	t := &Token{}
+	t.ID, _ = claims["jti"].(string)
+	t.Email, _ = claims["email"].(string)
+	if _, emailed := claims["purpose"]; emailed || t.ID == "" || t.Email == "" {
+		return nil, ErrInvalidToken
+	}
+	if ver, ok := claims["ver"].(float64); ok {
+		t.Version = int(ver)
+	}
+	if sid, ok := claims["sid"].(float64); ok {
+		t.SessionID = int(sid)
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	t.ExpiresAt = exp.Time
+
+	revoked, err := s.Revocations.IsRevoked(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return t, nil
+}
+
+// Authenticate resolves a bearer token to its user. Tokens issued before the
+// user's token version was bumped, or for a session that has since ended, are
+// treated as revoked.
+func (s *Service) Authenticate(ctx context.Context, tokenString string) (*models.User, *Token, error) {
+	t, err := s.ParseToken(ctx, tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.Users.GetByEmail(ctx, t.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.Version != user.TokenVersion {
+		return nil, nil, ErrTokenRevoked
+	}
+	if t.SessionID != 0 {
+		sess, err := s.Sessions.Get(ctx, t.SessionID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrTokenRevoked
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if sess.RevokedAt != nil || sess.UserID != user.ID {
+			return nil, nil, ErrTokenRevoked
+		}
+	}
+	return user, t, nil
+}
+
+// RevokeToken puts a single token on the revocation list, e.g. on logout.
+func (s *Service) RevokeToken(ctx context.Context, userID int, t *Token) error {
+	return s.Revocations.Revoke(ctx, t.ID, userID, t.ExpiresAt)
+}
+
+// RevokeAllTokens ends all of the user's sessions, revokes their API keys
+// and invalidates every token issued so far, e.g. when they log out
+// everywhere or change their password.
+func (s *Service) RevokeAllTokens(ctx context.Context, userID int, reason string) error {
+	now := time.Now()
+	if _, err := s.Sessions.RevokeAll(ctx, userID, 0, reason, now); err != nil {
+		return err
+	}
+	if n, err := s.APIKeys.RevokeAll(ctx, userID, now); err != nil {
+		return err
+	} else if n > 0 {
+		log.Printf("[Auth] Revoked %d API keys of user %d (%s)", n, userID, reason)
+	}
+	return s.Users.BumpTokenVersion(ctx, userID)
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// ErrInvalidUserToken is returned for emailed tokens that are malformed,
+// expired, already used or meant for something else.
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// Emailed tokens are limited per user and purpose: one per EmailCooldown and
+// MaxEmailsPerWindow per EmailWindow.
+const (
+	EmailCooldown      = time.Minute
+	EmailWindow        = 24 * time.Hour
+	MaxEmailsPerWindow = 5
+)
+
+// TooManyEmailsError is returned when a user asks for emails faster than
+// allowed.
+type TooManyEmailsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyEmailsError) Error() string {
+	return fmt.Sprintf("Too many emails requested, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// issueUserToken signs a single-use token, e.g. for an emailed link. It's signed
+// with the same keys as access tokens but carries a purpose claim and no
+// email, so neither kind is accepted in place of the other.
+func (s *Service) issueUserToken(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	if err := s.UserTokens.Create(ctx, &models.UserToken{
+		ID:        hashToken(jti),
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+	return s.Keys.sign(jwt.MapClaims{
+		"jti":     jti,
+		"uid":     userID,
+		"purpose": purpose,
+		"iat":     now.Unix(),
+		"exp":     now.Add(ttl).Unix(),
+	})
+}
+
+// checkEmailRate returns a *TooManyEmailsError if another token with the
+// purpose can't be sent to the user yet.
+func (s *Service) checkEmailRate(ctx context.Context, userID int, purpose string) error {
+	now := time.Now().UTC()
+	issued, err := s.UserTokens.IssuedSince(ctx, userID, purpose, now.Add(-EmailWindow))
+	if err != nil {
+		return err
+	}
+	n := len(issued)
+	if n == 0 {
+		return nil
+	}
+	var retryAt time.Time
+	if n >= MaxEmailsPerWindow {
+		retryAt = issued[n-MaxEmailsPerWindow].Add(EmailWindow)
+	}
+	if next := issued[n-1].Add(EmailCooldown); next.After(retryAt) {
+		retryAt = next
+	}
+	if retryAt.After(now) {
+		return &TooManyEmailsError{RetryAfter: retryAt.Sub(now)}
+	}
+	return nil
+}
+
+// parseUserToken checks a user token's signature, expiry and purpose without
+// using it up, returning its jti and user.
+func (s *Service) parseUserToken(tokenString, purpose string) (string, int, error) {
+	token, err := jwt.Parse(tokenString, s.Keys.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return "", 0, ErrInvalidUserToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", 0, ErrInvalidUserToken
+	}
+	jti, _ := claims["jti"].(string)
+	uid, _ := claims["uid"].(float64)
+	if jti == "" || uid == 0 || claims["purpose"] != purpose {
+		return "", 0, ErrInvalidUserToken
+	}
+	return jti, int(uid), nil
+}
+
+// useUserToken marks a parsed user token as used.
+func (s *Service) useUserToken(ctx context.Context, jti string, userID int, purpose string) error {
+	owner, err := s.UserTokens.Consume(ctx, hashToken(jti), purpose, time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidUserToken
+	} else if err != nil {
+		return err
+	}
+	if owner != userID {
+		return ErrInvalidUserToken
+	}
+	return nil
+}
+
+// consumeUserToken checks an emailed token's signature and purpose and marks
+// it used, returning the user it was issued to.
+func (s *Service) consumeUserToken(ctx context.Context, tokenString, purpose string) (int, error) {
+	jti, userID, err := s.parseUserToken(tokenString, purpose)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.useUserToken(ctx, jti, userID, purpose); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"jobseek-web-be/internal/email"
+	"jobseek-web-be/internal/models"
+)
+
+// PurposeVerifyEmail marks email verification tokens.
+const PurposeVerifyEmail = "verify_email"
+
+// VerificationTokenTTL is how long a verification link works.
+const VerificationTokenTTL = 48 * time.Hour
+
+// ErrAlreadyVerified is returned when resending to a confirmed address.
+var ErrAlreadyVerified = errors.New("email already verified")
+
+// SendVerification emails the user a link to confirm their address.
+func (s *Service) SendVerification(ctx context.Context, user *models.User) error {
+	token, err := s.issueUserToken(ctx, user.ID, PurposeVerifyEmail, VerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+	return email.SendVerification(user.Email, user.Name, token)
+}
+
+// ResendVerification sends a new verification link unless the user is
+// already verified or has asked for too many.
+func (s *Service) ResendVerification(ctx context.Context, userID int) error {
+	user, err := s.Users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+
+	if err := s.checkEmailRate(ctx, userID, PurposeVerifyEmail); err != nil {
+		return err
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// VerifyEmail consumes a verification token and marks the address confirmed.
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := s.consumeUserToken(ctx, token, PurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if err := s.Users.MarkEmailVerified(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+	log.Printf("[Auth] User %d verified their email address", userID)
+	return nil
+}
@@ -0,0 +1,157 @@
+// Package billing sells subscriptions through a Stripe-compatible API.
+// Checkout sessions are created over its REST API, and the resulting
+// subscriptions are kept in sync from signed webhooks, which also switch the
+// owner's paid flag and plan.
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/repository"
+)
+
+const DefaultAPIURL = "https://api.stripe.com"
+
+var (
+	// ErrNotConfigured is returned when the API key or webhook secret is
+	// missing.
+	ErrNotConfigured = errors.New("billing is not configured")
+	// ErrUnknownPlan is returned by Checkout for plans without a price.
+	ErrUnknownPlan = errors.New("plan is not available")
+)
+
+// Plans lists the plans that can be bought.
+var Plans = []string{string(entitlements.Basic), string(entitlements.Pro)}
+
+// Config holds the billing provider credentials and price IDs.
+type Config struct {
+	APIURL        string
+	SecretKey     string
+	WebhookSecret string
+	Prices        map[string]string // plan -> price ID
+	SuccessURL    string
+	CancelURL     string
+}
+
+// ConfigFromEnv reads STRIPE_* variables. The redirect URLs default to pages
+// under APP_DOMAIN.
+func ConfigFromEnv() Config {
+	domain := os.Getenv("APP_DOMAIN")
+	if domain == "" {
+		domain = "http://localhost:8080"
+	}
+	cfg := Config{
+		APIURL:        os.Getenv("STRIPE_API_URL"),
+		SecretKey:     os.Getenv("STRIPE_SECRET_KEY"),
+		WebhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		Prices: map[string]string{
+			string(entitlements.Basic): os.Getenv("STRIPE_PRICE_BASIC"),
+			string(entitlements.Pro):   os.Getenv("STRIPE_PRICE_PRO"),
+		},
+		SuccessURL: domain + "/billing/success?session_id={CHECKOUT_SESSION_ID}",
+		CancelURL:  domain + "/pricing",
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+	return cfg
+}
+
+// PlanForPrice maps a price ID back to its plan, or "" if it isn't ours.
+func (c Config) PlanForPrice(priceID string) string {
+	for plan, id := range c.Prices {
+		if id != "" && id == priceID {
+			return plan
+		}
+	}
+	return ""
+}
+
+// Service creates checkout sessions and applies webhook events.
+type Service struct {
+	Config        Config
+	Users         repository.UserRepository
+	Subscriptions repository.SubscriptionRepository
+	client        *http.Client
+}
+
+func NewService(cfg Config, store *repository.Store) *Service {
+	return &Service{
+		Config:        cfg,
+		Users:         store.Users,
+		Subscriptions: store.Subscriptions,
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// CheckoutSession is where the user is sent to pay.
+type CheckoutSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// Checkout starts a subscription checkout for the user. The user ID and
+// plan travel in the subscription metadata so webhooks can be matched back.
+func (s *Service) Checkout(ctx context.Context, userID int, email, plan string) (*CheckoutSession, error) {
+	if s.Config.SecretKey == "" {
+		return nil, ErrNotConfigured
+	}
+	price := s.Config.Prices[plan]
+	if price == "" {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPlan, plan)
+	}
+
+	id := strconv.Itoa(userID)
+	form := url.Values{
+		"mode":                                 {"subscription"},
+		"line_items[0][price]":                 {price},
+		"line_items[0][quantity]":              {"1"},
+		"success_url":                          {s.Config.SuccessURL},
+		"cancel_url":                           {s.Config.CancelURL},
+		"client_reference_id":                  {id},
+		"customer_email":                       {email},
+		"metadata[user_id]":                    {id},
+		"metadata[plan]":                       {plan},
+		"subscription_data[metadata][user_id]": {id},
+		"subscription_data[metadata][plan]":    {plan},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.Config.APIURL, "/")+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Config.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("creating checkout session: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("creating checkout session: %s: %s", resp.Status, apiErr.Error.Message)
+	}
+
+	var session CheckoutSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("decoding checkout session: %w", err)
+	}
+	return &session, nil
+}
@@ -0,0 +1,85 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// FakeEvent describes a subscription event to stand in for the billing
+// provider, from the "billing send-webhook" command and tests.
+type FakeEvent struct {
+	ID             string // default evt_test_<created>
+	Type           string
+	UserID         int
+	Plan           string
+	Status         string    // default active, or canceled for deletions
+	SubscriptionID string    // default sub_test_<user>
+	Created        time.Time // default now
+}
+
+// Payload returns the event as the provider would post it. The plan's price
+// from cfg, if any, is set on the subscription item like the provider does.
+func (e FakeEvent) Payload(cfg Config) ([]byte, error) {
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+	if e.ID == "" {
+		e.ID = "evt_test_" + strconv.FormatInt(e.Created.UnixNano(), 36)
+	}
+	if e.SubscriptionID == "" {
+		e.SubscriptionID = "sub_test_" + strconv.Itoa(e.UserID)
+	}
+	if e.Status == "" {
+		e.Status = "active"
+		if e.Type == EventSubscriptionDeleted {
+			e.Status = "canceled"
+		}
+	}
+
+	var object map[string]interface{}
+	if e.Type == EventPaymentFailed {
+		object = map[string]interface{}{
+			"object":       "invoice",
+			"id":           "in_test_" + strconv.FormatInt(e.Created.UnixNano(), 36),
+			"subscription": e.SubscriptionID,
+		}
+	} else {
+		object = map[string]interface{}{
+			"object":               "subscription",
+			"id":                   e.SubscriptionID,
+			"customer":             "cus_test_" + strconv.Itoa(e.UserID),
+			"status":               e.Status,
+			"current_period_end":   e.Created.AddDate(0, 1, 0).Unix(),
+			"cancel_at_period_end": false,
+			"metadata":             map[string]string{"user_id": strconv.Itoa(e.UserID), "plan": e.Plan},
+		}
+		if price := cfg.Prices[e.Plan]; price != "" {
+			object["items"] = map[string]interface{}{
+				"data": []interface{}{map[string]interface{}{"price": map[string]string{"id": price}}},
+			}
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":      e.ID,
+		"type":    e.Type,
+		"created": e.Created.Unix(),
+		"data":    map[string]interface{}{"object": object},
+	})
+}
+
+// SendWebhook posts a payload to a webhook endpoint, signed with secret as
+// if it was sent at t.
+func SendWebhook(ctx context.Context, client *http.Client, target, secret string, payload []byte, t time.Time) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(secret, payload, t))
+	return client.Do(req)
+}
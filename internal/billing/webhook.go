@@ -0,0 +1,300 @@
+package billing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// SignatureHeader carries the webhook signature: "t=<unix time>,v1=<hex
+// HMAC-SHA256 of "<t>.<payload>">".
+const SignatureHeader = "Stripe-Signature"
+
+// DefaultTolerance is how old a signed webhook may be, limiting replays.
+const DefaultTolerance = 5 * time.Minute
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// The webhook events that change a subscription.
+const (
+	EventSubscriptionCreated = "customer.subscription.created"
+	EventSubscriptionUpdated = "customer.subscription.updated"
+	EventSubscriptionDeleted = "customer.subscription.deleted"
+	EventPaymentFailed       = "invoice.payment_failed"
+)
+
+// Event is a webhook notification. Data.Object is a subscription or an
+// invoice depending on Type.
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// Sign returns the SignatureHeader value for a payload sent at t. Tests and
+// local fake senders use it to produce webhooks the receiver accepts.
+func Sign(secret string, payload []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + computeSignature(secret, ts, payload)
+}
+
+func computeSignature(secret, ts string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a SignatureHeader value against the payload. Any of
+// several v1 signatures may match, as happens while the secret is rolled.
+func VerifySignature(secret string, payload []byte, header string, tolerance time.Duration, now time.Time) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sigs = append(sigs, value)
+		}
+	}
+	if ts == "" || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	expected := []byte(computeSignature(secret, ts, payload))
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ParseEvent verifies a webhook's signature and decodes it.
+func (s *Service) ParseEvent(payload []byte, signature string) (*Event, error) {
+	if s.Config.WebhookSecret == "" {
+		return nil, ErrNotConfigured
+	}
+	if err := VerifySignature(s.Config.WebhookSecret, payload, signature, DefaultTolerance, time.Now()); err != nil {
+		return nil, err
+	}
+	var ev Event
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return nil, fmt.Errorf("decoding event: %w", err)
+	}
+	return &ev, nil
+}
+
+type subscriptionObject struct {
+	ID                string            `json:"id"`
+	Customer          string            `json:"customer"`
+	Status            string            `json:"status"`
+	Metadata          map[string]string `json:"metadata"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	Items             struct {
+		Data []struct {
+			Price struct {
+				ID string `json:"id"`
+			} `json:"price"`
+			// Newer API versions report the period per item
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+type invoiceObject struct {
+	Subscription string `json:"subscription"`
+	// Newer API versions moved the subscription under parent
+	Parent struct {
+		SubscriptionDetails struct {
+			Subscription string `json:"subscription"`
+		} `json:"subscription_details"`
+	} `json:"parent"`
+}
+
+// HandleEvent applies a verified event. Event types it doesn't act on are
+// ignored, so the provider can send everything.
+func (s *Service) HandleEvent(ctx context.Context, ev *Event) error {
+	at := time.Unix(ev.Created, 0).UTC()
+	switch ev.Type {
+	case EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionDeleted:
+		var obj subscriptionObject
+		if err := json.Unmarshal(ev.Data.Object, &obj); err != nil {
+			return fmt.Errorf("decoding subscription: %w", err)
+		}
+		return s.applySubscription(ctx, ev, obj, at)
+	case EventPaymentFailed:
+		var obj invoiceObject
+		if err := json.Unmarshal(ev.Data.Object, &obj); err != nil {
+			return fmt.Errorf("decoding invoice: %w", err)
+		}
+		subID := obj.Subscription
+		if subID == "" {
+			subID = obj.Parent.SubscriptionDetails.Subscription
+		}
+		return s.applyPaymentFailed(ctx, ev, subID, at)
+	default:
+		return nil
+	}
+}
+
+func (s *Service) applySubscription(ctx context.Context, ev *Event, obj subscriptionObject, at time.Time) error {
+	sub := models.Subscription{
+		ID:                obj.ID,
+		CustomerID:        obj.Customer,
+		Status:            obj.Status,
+		CancelAtPeriodEnd: obj.CancelAtPeriodEnd,
+		EventAt:           at,
+	}
+	periodEnd := obj.CurrentPeriodEnd
+	if len(obj.Items.Data) > 0 {
+		// The price is authoritative: plan changes made in the provider's
+		// portal swap it but leave the checkout metadata alone
+		sub.Plan = s.Config.PlanForPrice(obj.Items.Data[0].Price.ID)
+		if periodEnd == 0 {
+			periodEnd = obj.Items.Data[0].CurrentPeriodEnd
+		}
+	}
+	if periodEnd > 0 {
+		sub.CurrentPeriodEnd = time.Unix(periodEnd, 0).UTC()
+	}
+
+	existing, err := s.Subscriptions.Get(ctx, obj.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	if sub.Plan == "" {
+		sub.Plan = obj.Metadata["plan"]
+	}
+	if sub.Plan == "" && existing != nil {
+		sub.Plan = existing.Plan
+	}
+	if !validPlan(sub.Plan) {
+		log.Printf("[Billing] Ignoring event %s: subscription %s has unknown plan %q", ev.ID, obj.ID, sub.Plan)
+		return nil
+	}
+
+	if existing != nil {
+		sub.UserID = existing.UserID
+	} else if id, err := strconv.Atoi(obj.Metadata["user_id"]); err == nil {
+		if _, err := s.Users.GetByID(ctx, id); errors.Is(err, repository.ErrNotFound) {
+			log.Printf("[Billing] Ignoring event %s: user %d not found", ev.ID, id)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		sub.UserID = id
+	} else {
+		log.Printf("[Billing] Ignoring event %s: subscription %s isn't linked to a user", ev.ID, obj.ID)
+		return nil
+	}
+
+	return s.save(ctx, ev, sub)
+}
+
+func (s *Service) applyPaymentFailed(ctx context.Context, ev *Event, subID string, at time.Time) error {
+	sub, err := s.Subscriptions.Get(ctx, subID)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Printf("[Billing] Ignoring event %s: unknown subscription %q", ev.ID, subID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Access is suspended until a retried payment succeeds and the
+	// subscription is updated back to active
+	sub.Status = "past_due"
+	sub.EventAt = at
+	sub.UpdatedAt = time.Time{}
+	return s.save(ctx, ev, *sub)
+}
+
+// save stores the subscription and recomputes its owner's plan. Stale events
+// are dropped, but replays of the latest one are applied again so a failed
+// user update is retried with the webhook.
+func (s *Service) save(ctx context.Context, ev *Event, sub models.Subscription) error {
+	saved, err := s.Subscriptions.Save(ctx, sub)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		log.Printf("[Billing] Ignoring stale event %s for subscription %s", ev.ID, sub.ID)
+		return nil
+	}
+	log.Printf("[Billing] Subscription %s of user %d is %s (%s)", sub.ID, sub.UserID, sub.Status, sub.Plan)
+	return s.syncUser(ctx, sub.UserID)
+}
+
+// Active reports whether a subscription in the given status grants its plan.
+func Active(status string) bool {
+	return status == "active" || status == "trialing"
+}
+
+// syncUser sets the user's paid flag and plan from their active
+// subscriptions, preferring pro if there are several. Without one the user
+// keeps their plan name but is no longer paid.
+func (s *Service) syncUser(ctx context.Context, userID int) error {
+	user, err := s.Users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	subs, err := s.Subscriptions.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	plan, paid := user.SubscriptionPlan, false
+	for _, sub := range subs {
+		if !Active(sub.Status) {
+			continue
+		}
+		if !paid || sub.Plan == string(entitlements.Pro) {
+			plan, paid = sub.Plan, true
+		}
+	}
+	if plan == user.SubscriptionPlan && paid == user.Paid {
+		return nil
+	}
+
+	log.Printf("[Billing] User %d is now on %s (paid: %t)", userID, plan, paid)
+	return s.Users.SetPlan(ctx, userID, plan, paid)
+}
+
+func validPlan(plan string) bool {
+	for _, p := range Plans {
+		if p == plan {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package billing
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "whsec_test"
+	payload := []byte(`{"id": "evt_1"}`)
+	now := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		ok     bool
+	}{
+		{"valid", Sign(secret, payload, now), true},
+		{"slightly old", Sign(secret, payload, now.Add(-DefaultTolerance+time.Second)), true},
+		{"slightly ahead", Sign(secret, payload, now.Add(DefaultTolerance-time.Second)), true},
+		{"rolled secret", "t=" + ts + ",v1=" + computeSignature("whsec_old", ts, payload) + ",v1=" + computeSignature(secret, ts, payload), true},
+		{"wrong secret", Sign("whsec_other", payload, now), false},
+		{"tampered payload", Sign(secret, []byte(`{"id": "evt_2"}`), now), false},
+		{"replayed too late", Sign(secret, payload, now.Add(-DefaultTolerance-time.Second)), false},
+		{"timestamp from the future", Sign(secret, payload, now.Add(DefaultTolerance+time.Second)), false},
+		{"timestamp swapped", "t=" + strconv.FormatInt(now.Unix()+1, 10) + ",v1=" + computeSignature(secret, ts, payload), false},
+		{"no timestamp", "v1=" + computeSignature(secret, ts, payload), false},
+		{"bad timestamp", "t=yesterday,v1=" + computeSignature(secret, ts, payload), false},
+		{"no signature", "t=" + ts, false},
+		{"empty", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifySignature(secret, payload, tc.header, DefaultTolerance, now)
+			if tc.ok && err != nil {
+				t.Errorf("got %v, want the signature accepted", err)
+			}
+			if !tc.ok && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("got %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
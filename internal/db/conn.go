@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect identifies the SQL flavour of the connected database.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// Conn wraps *sql.DB so queries can be written once with "?" placeholders
+// and portable SQL (ON CONFLICT, RETURNING), and are rebound for the
+// connected dialect.
+type Conn struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// OpenSQLite opens a SQLite database file. ":memory:" gives a private
+// in-memory database, limited to one connection so every query sees it.
+func OpenSQLite(path string) (*Conn, error) {
+	dsn := path
+	if path != ":memory:" {
+		// Wait for the lock instead of failing when the scheduler and
+		// handlers write concurrently
+		dsn += "?_busy_timeout=5000"
+	}
+	sqlDB, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return &Conn{DB: sqlDB, Dialect: SQLite}, nil
+}
+
+// OpenPostgres opens a PostgreSQL database from a URL or keyword/value DSN.
+func OpenPostgres(dsn string) (*Conn, error) {
+	sqlDB, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return &Conn{DB: sqlDB, Dialect: Postgres}, nil
+}
+
+// Rebind converts "?" placeholders to the dialect's style. Question marks
+// inside quoted literals and identifiers are left alone.
+func (c *Conn) Rebind(query string) string {
+	return rebind(c.Dialect, query)
+}
+
+func rebind(dialect Dialect, query string) string {
+	if dialect != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+func (c *Conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.Rebind(query), args...)
+}
+
+func (c *Conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.ExecContext(ctx, c.Rebind(query), args...)
+}
+
+func (c *Conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.Query(c.Rebind(query), args...)
+}
+
+func (c *Conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.QueryContext(ctx, c.Rebind(query), args...)
+}
+
+func (c *Conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRow(c.Rebind(query), args...)
+}
+
+func (c *Conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRowContext(ctx, c.Rebind(query), args...)
+}
+
+func (c *Conn) Prepare(query string) (*sql.Stmt, error) {
+	return c.DB.Prepare(c.Rebind(query))
+}
+
+func (c *Conn) Begin() (*Tx, error) {
+	return c.BeginTx(context.Background(), nil)
+}
+
+func (c *Conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := c.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: c.Dialect}, nil
+}
+
+// IsUniqueViolation reports whether err is a unique constraint failure on
+// either dialect.
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// Tx is the transaction counterpart of Conn.
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+func (t *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(rebind(t.Dialect, query), args...)
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, rebind(t.Dialect, query), args...)
+}
+
+func (t *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.Query(rebind(t.Dialect, query), args...)
+}
+
+func (t *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRow(rebind(t.Dialect, query), args...)
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, rebind(t.Dialect, query), args...)
+}
+
+func (t *Tx) Prepare(query string) (*sql.Stmt, error) {
+	return t.Tx.Prepare(rebind(t.Dialect, query))
+}
@@ -1,96 +1,67 @@
 package db
 
 import (
-	"database/sql"
 	"log"
 	"os"
 	"path/filepath"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+var DB *Conn
 
-func InitDB() {
+// Open connects to the database configured by DB_DRIVER ("sqlite3" or
+// "postgres") without touching the schema. SQLite uses DB_PATH, Postgres
+// uses DATABASE_URL.
+func Open() {
 	var err error
 
-	// Use data directory for database (supports Docker volumes)
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/jobseek.db"
+	driver := Dialect(os.Getenv("DB_DRIVER"))
+	if driver == "" {
+		driver = SQLite
 	}
 
-	// Create data directory if it doesn't exist
-	dataDir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		log.Fatal("Failed to create data directory:", err)
-	}
+	switch driver {
+	case SQLite:
+		// Use data directory for database (supports Docker volumes)
+		dbPath := os.Getenv("DB_PATH")
+		if dbPath == "" {
+			dbPath = "./data/jobseek.db"
+		}
 
-	DB, err = sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	createTableSQL := `CREATE TABLE IF NOT EXISTS users (
-		"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-		"name" TEXT NOT NULL,
-		"email" TEXT NOT NULL UNIQUE,
-		"password" TEXT NOT NULL,
-		"subscription_plan" TEXT DEFAULT 'basic',
-		"paid" INTEGER DEFAULT 0,
-		"created_at" DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+		if dbPath != ":memory:" {
+			// Create data directory if it doesn't exist
+			dataDir := filepath.Dir(dbPath)
+			if err := os.MkdirAll(dataDir, 0755); err != nil {
+				log.Fatal("Failed to create data directory:", err)
+			}
+		}
 
-	log.Println("Creating users table...")
-	statement, err := DB.Prepare(createTableSQL)
-	if err != nil {
-		log.Fatal(err.Error())
+		DB, err = OpenSQLite(dbPath)
+	case Postgres:
+		dsn := os.Getenv("DATABASE_URL")
+		if dsn == "" {
+			log.Fatal("DATABASE_URL is required when DB_DRIVER=postgres")
+		}
+		DB, err = OpenPostgres(dsn)
+	default:
+		log.Fatalf("Unsupported DB_DRIVER %q (expected sqlite3 or postgres)", driver)
 	}
-	statement.Exec()
-	log.Println("Users table created")
-
-	createSearchesTableSQL := `CREATE TABLE IF NOT EXISTS user_searches (
-		"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-		"user_id" INTEGER NOT NULL,
-		"keyword" TEXT,
-		"country" TEXT,
-		"location" TEXT,
-		"language" TEXT,
-		"frequency" TEXT DEFAULT 'hourly',
-		"hours_old" INTEGER DEFAULT 24,
-		"exclude" TEXT DEFAULT '',
-		"results_wanted" INTEGER DEFAULT 10,
-		"last_run" DATETIME,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);`
-
-	log.Println("Creating user_searches table...")
-	stmtSearches, err := DB.Prepare(createSearchesTableSQL)
 	if err != nil {
-		log.Fatal(err.Error())
+		log.Fatal(err)
 	}
-	stmtSearches.Exec()
-	log.Println("User searches table created")
-
-	// Add new columns if they don't exist (for existing databases)
-	_, _ = DB.Exec("ALTER TABLE user_searches ADD COLUMN hours_old INTEGER DEFAULT 24")
-	_, _ = DB.Exec("ALTER TABLE user_searches ADD COLUMN exclude TEXT DEFAULT ''")
-	_, _ = DB.Exec("ALTER TABLE user_searches ADD COLUMN results_wanted INTEGER DEFAULT 10")
+}
 
-	createSentJobsTableSQL := `CREATE TABLE IF NOT EXISTS sent_jobs (
-		"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-		"search_id" INTEGER NOT NULL,
-		"job_url" TEXT NOT NULL,
-		"sent_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY(search_id) REFERENCES user_searches(id),
-		UNIQUE(search_id, job_url)
-	);`
+// InitDB connects to the database and applies any pending migrations.
+func InitDB() {
+	Open()
 
-	log.Println("Creating sent_jobs table...")
-	stmtSent, err := DB.Prepare(createSentJobsTableSQL)
+	applied, err := MigrateUp(0)
 	if err != nil {
-		log.Fatal(err.Error())
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	if applied > 0 {
+		log.Printf("Applied %d database migration(s)", applied)
 	}
-	stmtSent.Exec()
-	log.Println("Sent jobs table created")
 }
@@ -0,0 +1,321 @@
+package db
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each dialect has its own copy of every migration under migrations/<dialect>,
+// numbered identically so versions mean the same schema on both.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFS embed.FS
+
+func migrationDir(dialect Dialect) string {
+	if dialect == Postgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
+
+// baselineVersion is the schema InitDB created before migrations existed.
+// Such databases are adopted at this version instead of being re-created.
+const baselineVersion = 1
+
+// Migration is a numbered schema change read from migrations/<dialect>/NNNN_name.{up,down}.sql.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+// MigrationState pairs a migration with when it was applied, if at all.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// LoadMigrations returns the embedded migrations for dialect ordered by version.
+func LoadMigrations(dialect Dialect) ([]Migration, error) {
+	dir := migrationDir(dialect)
+	files, err := fs.Glob(migrationFS, dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, dir+"/")
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: must end in .up.sql or .down.sql", base)
+		}
+
+		stem := strings.TrimSuffix(base, "."+direction+".sql")
+		num, name, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description", base)
+		}
+
+		content, err := migrationFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s): needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d (%s): versions must be consecutive from 1", m.Version, m.Name)
+		}
+	}
+	return migrations, nil
+}
+
+type appliedMigration struct {
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func ensureMigrationsTable() error {
+	timestamp := "DATETIME"
+	if DB.Dialect == Postgres {
+		timestamp = "TIMESTAMPTZ"
+	}
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		"version" INTEGER NOT NULL PRIMARY KEY,
+		"name" TEXT NOT NULL,
+		"checksum" TEXT NOT NULL,
+		"applied_at" ` + timestamp + ` NOT NULL
+	)`)
+	return err
+}
+
+func appliedMigrations() (map[int]appliedMigration, error) {
+	rows, err := DB.Query("SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// prepare loads migrations and the applied set, adopting pre-migration
+// databases and refusing to continue if an applied migration was edited.
+func prepare() ([]Migration, map[int]appliedMigration, error) {
+	migrations, err := LoadMigrations(DB.Dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(applied) == 0 && DB.Dialect == SQLite {
+		if err := adoptLegacySchema(migrations); err != nil {
+			return nil, nil, err
+		}
+		if applied, err = appliedMigrations(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, m := range migrations {
+		a, ok := applied[m.Version]
+		if ok && a.Checksum != m.Checksum {
+			return nil, nil, fmt.Errorf("migration %d (%s) was modified after being applied (applied %s, embedded %s)",
+				m.Version, m.Name, a.Checksum[:12], m.Checksum[:12])
+		}
+	}
+	for version := range applied {
+		if version > len(migrations) {
+			return nil, nil, fmt.Errorf("database is at migration %d, newer than this binary knows about", version)
+		}
+	}
+	return migrations, applied, nil
+}
+
+// adoptLegacySchema records the baseline as applied for databases created by
+// InitDB before migrations existed. The old code also added these columns with
+// ALTER TABLE, so make sure they're present. Only SQLite predates migrations.
+func adoptLegacySchema(migrations []Migration) error {
+	var exists bool
+	err := DB.QueryRow("SELECT exists(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'users')").Scan(&exists)
+	if err != nil || !exists {
+		return err
+	}
+
+	log.Printf("Adopting existing database at migration %d", baselineVersion)
+	legacyColumns := []string{
+		"ALTER TABLE user_searches ADD COLUMN hours_old INTEGER DEFAULT 24",
+		"ALTER TABLE user_searches ADD COLUMN exclude TEXT DEFAULT ''",
+		"ALTER TABLE user_searches ADD COLUMN results_wanted INTEGER DEFAULT 10",
+	}
+	for _, stmt := range legacyColumns {
+		if _, err := DB.Exec(stmt); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			return fmt.Errorf("adopting legacy schema: %v", err)
+		}
+	}
+
+	for _, m := range migrations[:baselineVersion] {
+		if _, err := DB.Exec(
+			"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+			m.Version, m.Name, m.Checksum, time.Now().UTC(),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies pending migrations up to and including target (0 means
+// all) and returns how many were applied.
+func MigrateUp(target int) (int, error) {
+	migrations, applied, err := prepare()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		log.Printf("Applying migration %04d_%s...", m.Version, m.Name)
+		err := inTx(func(tx *Tx) error {
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(
+				"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+				m.Version, m.Name, m.Checksum, time.Now().UTC(),
+			)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, steps at a time,
+// and returns how many were reverted.
+func MigrateDown(steps int) (int, error) {
+	migrations, applied, err := prepare()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+
+		log.Printf("Reverting migration %04d_%s...", m.Version, m.Name)
+		err := inTx(func(tx *Tx) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrationStatus lists every known migration and whether it is applied.
+func MigrationStatus() ([]MigrationState, error) {
+	migrations, applied, err := prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			at := a.AppliedAt
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func inTx(fn func(tx *Tx) error) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
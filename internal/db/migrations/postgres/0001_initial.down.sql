@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS sent_jobs;
+DROP TABLE IF EXISTS user_searches;
+DROP TABLE IF EXISTS users;
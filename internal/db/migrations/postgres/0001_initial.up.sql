@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS users (
+	"id" SERIAL PRIMARY KEY,
+	"name" TEXT NOT NULL,
+	"email" TEXT NOT NULL UNIQUE,
+	"password" TEXT NOT NULL,
+	"subscription_plan" TEXT DEFAULT 'basic',
+	"paid" INTEGER DEFAULT 0,
+	"created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_searches (
+	"id" SERIAL PRIMARY KEY,
+	"user_id" INTEGER NOT NULL,
+	"keyword" TEXT,
+	"country" TEXT,
+	"location" TEXT,
+	"language" TEXT,
+	"frequency" TEXT DEFAULT 'hourly',
+	"hours_old" INTEGER DEFAULT 24,
+	"exclude" TEXT DEFAULT '',
+	"results_wanted" INTEGER DEFAULT 10,
+	"last_run" TIMESTAMPTZ,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS sent_jobs (
+	"id" SERIAL PRIMARY KEY,
+	"search_id" INTEGER NOT NULL,
+	"job_url" TEXT NOT NULL,
+	"sent_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(search_id) REFERENCES user_searches(id),
+	UNIQUE(search_id, job_url)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS search_cache (
+	"cache_key" TEXT NOT NULL PRIMARY KEY,
+	"results" TEXT NOT NULL,
+	"expires_at" TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_searches_next_run_at;
+ALTER TABLE user_searches DROP COLUMN next_run_at;
+ALTER TABLE user_searches DROP COLUMN timezone;
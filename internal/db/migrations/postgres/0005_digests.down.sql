@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS digest_items;
+ALTER TABLE users DROP COLUMN last_digest_at;
+ALTER TABLE users DROP COLUMN digest_frequency;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS email_outbox (
+	"id" SERIAL PRIMARY KEY,
+	"user_id" INTEGER NOT NULL,
+	"search_id" INTEGER,
+	"kind" TEXT NOT NULL,
+	"to_email" TEXT NOT NULL,
+	"user_name" TEXT NOT NULL,
+	"payload" TEXT NOT NULL,
+	"status" TEXT NOT NULL DEFAULT 'pending',
+	"attempts" INTEGER NOT NULL DEFAULT 0,
+	"next_attempt_at" TIMESTAMPTZ NOT NULL,
+	"last_error" TEXT,
+	"created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	"sent_at" TIMESTAMPTZ,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox(status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS outbox_jobs (
+	"outbox_id" INTEGER NOT NULL,
+	"search_id" INTEGER NOT NULL,
+	"job_url" TEXT NOT NULL,
+	FOREIGN KEY(outbox_id) REFERENCES email_outbox(id),
+	PRIMARY KEY(outbox_id, search_id, job_url)
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_jobs_search ON outbox_jobs(search_id);
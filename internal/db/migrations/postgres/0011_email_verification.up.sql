@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Accounts created before verification existed keep receiving alerts
+UPDATE users SET email_verified_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+	"id" TEXT NOT NULL PRIMARY KEY,
+	"user_id" INTEGER NOT NULL,
+	"purpose" TEXT NOT NULL,
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"expires_at" TIMESTAMPTZ NOT NULL,
+	"used_at" TIMESTAMPTZ,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_purpose ON user_tokens(user_id, purpose, created_at);
@@ -0,0 +1,28 @@
+-- Failed logins per client IP (scope 'ip') and per account email (scope
+-- 'account'), whether or not the account exists
+CREATE TABLE IF NOT EXISTS login_failures (
+	"scope" TEXT NOT NULL,
+	"subject" TEXT NOT NULL,
+	"failures" INTEGER NOT NULL,
+	"first_failed_at" TIMESTAMPTZ NOT NULL,
+	"last_failed_at" TIMESTAMPTZ NOT NULL,
+	"locked_until" TIMESTAMPTZ,
+	PRIMARY KEY (scope, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_login_failures_last_failed_at ON login_failures(last_failed_at);
+
+-- Audit trail of lockouts
+CREATE TABLE IF NOT EXISTS login_lockouts (
+	"id" SERIAL PRIMARY KEY,
+	"scope" TEXT NOT NULL,
+	"subject" TEXT NOT NULL,
+	"user_id" INTEGER,
+	"ip" TEXT NOT NULL DEFAULT '',
+	"failures" INTEGER NOT NULL,
+	"locked_at" TIMESTAMPTZ NOT NULL,
+	"locked_until" TIMESTAMPTZ NOT NULL,
+	"unlocked_at" TIMESTAMPTZ,
+	"unlocked_by" TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_login_lockouts_subject ON login_lockouts(scope, subject);
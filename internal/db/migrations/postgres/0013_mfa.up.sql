@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+	"user_id" INTEGER NOT NULL PRIMARY KEY,
+	"secret" TEXT NOT NULL,
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"enabled_at" TIMESTAMPTZ,
+	"last_counter" BIGINT NOT NULL DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+	"id" SERIAL PRIMARY KEY,
+	"user_id" INTEGER NOT NULL,
+	"code_hash" TEXT NOT NULL,
+	"used_at" TIMESTAMPTZ,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+	"id" SERIAL PRIMARY KEY,
+	"user_id" INTEGER NOT NULL,
+	"provider" TEXT NOT NULL,
+	"subject" TEXT NOT NULL,
+	"email" TEXT NOT NULL DEFAULT '',
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"last_login_at" TIMESTAMPTZ NOT NULL,
+	UNIQUE(provider, subject),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
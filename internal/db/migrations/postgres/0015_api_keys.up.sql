@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	"id" SERIAL PRIMARY KEY,
+	"user_id" INTEGER NOT NULL,
+	"name" TEXT NOT NULL DEFAULT '',
+	"prefix" TEXT NOT NULL UNIQUE,
+	"key_hash" TEXT NOT NULL,
+	"scopes" TEXT NOT NULL,
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"last_used_at" TIMESTAMPTZ,
+	"revoked_at" TIMESTAMPTZ,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);
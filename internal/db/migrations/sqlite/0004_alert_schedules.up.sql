@@ -0,0 +1,3 @@
+ALTER TABLE user_searches ADD COLUMN timezone TEXT DEFAULT 'UTC';
+ALTER TABLE user_searches ADD COLUMN next_run_at DATETIME;
+CREATE INDEX IF NOT EXISTS idx_user_searches_next_run_at ON user_searches(next_run_at);
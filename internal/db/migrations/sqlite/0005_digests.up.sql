@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN digest_frequency TEXT DEFAULT 'off';
+ALTER TABLE users ADD COLUMN last_digest_at DATETIME;
+
+CREATE TABLE IF NOT EXISTS digest_items (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"user_id" INTEGER NOT NULL,
+	"search_id" INTEGER NOT NULL,
+	"job_url" TEXT NOT NULL,
+	"job" TEXT NOT NULL,
+	"created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(search_id) REFERENCES user_searches(id),
+	UNIQUE(search_id, job_url)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS outbox_jobs;
+DROP TABLE IF EXISTS email_outbox;
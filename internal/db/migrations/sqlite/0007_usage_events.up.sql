@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS usage_events (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"user_id" INTEGER NOT NULL,
+	"feature" TEXT NOT NULL,
+	"created_at" DATETIME NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_usage_events_user ON usage_events(user_id, feature, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_events_created ON usage_events(created_at);
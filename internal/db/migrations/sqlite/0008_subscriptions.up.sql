@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+	"id" TEXT NOT NULL PRIMARY KEY,
+	"user_id" INTEGER NOT NULL,
+	"customer_id" TEXT NOT NULL,
+	"plan" TEXT NOT NULL,
+	"status" TEXT NOT NULL,
+	"current_period_end" DATETIME,
+	"cancel_at_period_end" INTEGER NOT NULL DEFAULT 0,
+	"event_at" DATETIME NOT NULL,
+	"updated_at" DATETIME NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user ON subscriptions(user_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_customer ON subscriptions(customer_id);
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	"jti" TEXT NOT NULL PRIMARY KEY,
+	"user_id" INTEGER NOT NULL,
+	"expires_at" DATETIME NOT NULL,
+	"revoked_at" DATETIME NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
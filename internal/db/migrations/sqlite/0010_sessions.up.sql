@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"user_id" INTEGER NOT NULL,
+	"token_hash" TEXT NOT NULL UNIQUE,
+	"device" TEXT NOT NULL DEFAULT '',
+	"user_agent" TEXT NOT NULL DEFAULT '',
+	"ip" TEXT NOT NULL DEFAULT '',
+	"created_at" DATETIME NOT NULL,
+	"last_used_at" DATETIME NOT NULL,
+	"expires_at" DATETIME NOT NULL,
+	"revoked_at" DATETIME,
+	"revoked_reason" TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS session_rotated_tokens (
+	"token_hash" TEXT NOT NULL PRIMARY KEY,
+	"session_id" INTEGER NOT NULL,
+	"rotated_at" DATETIME NOT NULL,
+	FOREIGN KEY(session_id) REFERENCES sessions(id)
+);
+CREATE INDEX IF NOT EXISTS idx_session_rotated_tokens_session ON session_rotated_tokens(session_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+	"user_id" INTEGER NOT NULL PRIMARY KEY,
+	"secret" TEXT NOT NULL,
+	"created_at" DATETIME NOT NULL,
+	"enabled_at" DATETIME,
+	"last_counter" INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"user_id" INTEGER NOT NULL,
+	"code_hash" TEXT NOT NULL,
+	"used_at" DATETIME,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
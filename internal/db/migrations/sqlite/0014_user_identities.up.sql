@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"user_id" INTEGER NOT NULL,
+	"provider" TEXT NOT NULL,
+	"subject" TEXT NOT NULL,
+	"email" TEXT NOT NULL DEFAULT '',
+	"created_at" DATETIME NOT NULL,
+	"last_login_at" DATETIME NOT NULL,
+	UNIQUE(provider, subject),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
@@ -0,0 +1 @@
+ALTER TABLE user_searches DROP COLUMN paused_at;
@@ -0,0 +1 @@
+ALTER TABLE user_searches ADD COLUMN paused_at DATETIME;
@@ -0,0 +1,108 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+)
+
+// AccountData fills account_template.html, which is shared by the emails
+// about the account itself rather than jobs.
+type AccountData struct {
+	AppName    string
+	UserName   string
+	Heading    string
+	Message    string
+	ActionText string // button label, shown if ActionURL is set
+	ActionURL  string
+	Note       string // small print, e.g. what to do if it wasn't them
+}
+
+// SendVerification asks a new user to confirm they own their address. The
+// link opens the frontend's verification page, which submits the token.
+func SendVerification(toEmail, userName, token string) error {
+	appName, domain := appSettings()
+	link := fmt.Sprintf("%s/verify-email?token=%s", domain, url.QueryEscape(token))
+	return sendAccountEmail(toEmail, "Confirm your email address", AccountData{
+		AppName:    appName,
+		UserName:   userName,
+		Heading:    "Confirm your email address",
+		Message:    fmt.Sprintf("Thanks for signing up to %s. Please confirm this is your email address so we can send you job alerts.", appName),
+		ActionText: "Confirm email",
+		ActionURL:  link,
+		Note:       "The link expires in 48 hours. If you didn't sign up, you can ignore this email.",
+	})
+}
+
+// SendPasswordReset sends the link for choosing a new password.
+func SendPasswordReset(toEmail, userName, token string) error {
+	appName, domain := appSettings()
+	link := fmt.Sprintf("%s/reset-password?token=%s", domain, url.QueryEscape(token))
+	return sendAccountEmail(toEmail, "Reset your password", AccountData{
+		AppName:    appName,
+		UserName:   userName,
+		Heading:    "Reset your password",
+		Message:    fmt.Sprintf("Someone asked to reset the password of your %s account. Choose a new one with the link below.", appName),
+		ActionText: "Reset password",
+		ActionURL:  link,
+		Note:       "The link expires in 1 hour and works once. If you didn't ask for it, you can ignore this email; your password stays the same.",
+	})
+}
+
+// SendPasswordChanged tells the user their password was changed, in case it
+// wasn't them.
+func SendPasswordChanged(toEmail, userName string) error {
+	appName, domain := appSettings()
+	return sendAccountEmail(toEmail, "Your password was changed", AccountData{
+		AppName:    appName,
+		UserName:   userName,
+		Heading:    "Your password was changed",
+		Message:    fmt.Sprintf("The password of your %s account was just changed, and all devices were signed out.", appName),
+		ActionText: "Reset password",
+		ActionURL:  domain + "/forgot-password",
+		Note:       "If this wasn't you, reset your password right away and contact support.",
+	})
+}
+
+// SendAccountLocked warns the user that their account was locked after
+// repeated failed logins, with a link to unlock it early.
+func SendAccountLocked(toEmail, userName, token string, until time.Time) error {
+	appName, domain := appSettings()
+	link := fmt.Sprintf("%s/unlock-account?token=%s", domain, url.QueryEscape(token))
+	return sendAccountEmail(toEmail, "Your account was locked", AccountData{
+		AppName:    appName,
+		UserName:   userName,
+		Heading:    "Your account was locked",
+		Message:    fmt.Sprintf("There were several failed attempts to log in to your %s account, so logins are blocked until %s. If that was you, you can unlock it now.", appName, until.UTC().Format("15:04 UTC")),
+		ActionText: "Unlock account",
+		ActionURL:  link,
+		Note:       "If it wasn't you, someone may be guessing your password. Consider resetting it; that unlocks the account too.",
+	})
+}
+
+func sendAccountEmail(toEmail, subject string, data AccountData) error {
+	// Mock Fallback
+	if os.Getenv("RESEND_API_KEY") == "" {
+		log.Println("[Email] RESEND_API_KEY is missing. Falling back to mock email.")
+		log.Printf("---------------------------------------------------")
+		log.Printf("MOCK EMAIL TO: %s", toEmail)
+		log.Printf("SUBJECT: %s", subject)
+		log.Printf("BODY:")
+		log.Printf("Hi %s,\n\n%s", data.UserName, data.Message)
+		if data.ActionURL != "" {
+			log.Printf("%s: %s", data.ActionText, data.ActionURL)
+		}
+		log.Printf("---------------------------------------------------")
+		return nil
+	}
+
+	htmlContent, err := renderTemplate("account_template.html", data)
+	if err != nil {
+		log.Printf("[Email] Failed to render account template: %v", err)
+		return err
+	}
+
+	return deliver(toEmail, subject, htmlContent, nil)
+}
@@ -0,0 +1,91 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"jobseek-web-be/internal/models"
+)
+
+// DigestGroup is one alert's section of a digest email.
+type DigestGroup struct {
+	SearchID int          `json:"search_id"`
+	Title    string       `json:"title"` // e.g. "Software Engineer in Berlin, Germany"
+	Jobs     []models.Job `json:"jobs"`
+}
+
+type digestGroupData struct {
+	Title string
+	Jobs  []JobResult
+}
+
+type DigestData struct {
+	AppName        string
+	UserName       string
+	Period         string
+	JobCount       int
+	Groups         []digestGroupData
+	UnsubscribeURL string
+}
+
+// SendDigest sends a single email covering all of a user's alerts. Jobs are
+// expected to be deduplicated across groups already. period is "daily" or
+// "weekly" and only affects the wording.
+func SendDigest(toEmail, userName string, userID int, period string, groups []DigestGroup) error {
+	appName, domain := appSettings()
+	unsubscribeURL, headers, err := unsubscribeLinks(domain, userID, 0)
+	if err != nil {
+		return err
+	}
+
+	data := DigestData{
+		AppName:        appName,
+		UserName:       userName,
+		Period:         period,
+		UnsubscribeURL: unsubscribeURL,
+	}
+	for _, g := range groups {
+		data.JobCount += len(g.Jobs)
+		data.Groups = append(data.Groups, digestGroupData{
+			Title: g.Title,
+			Jobs:  jobResults(domain, g.Jobs),
+		})
+	}
+
+	// Mock Fallback
+	if os.Getenv("RESEND_API_KEY") == "" {
+		log.Println("[Email] RESEND_API_KEY is missing. Falling back to mock email.")
+		return mockSendDigest(toEmail, userName, period, groups, unsubscribeURL)
+	}
+
+	subject := fmt.Sprintf("Your %s digest: %d new jobs", period, data.JobCount)
+
+	htmlContent, err := renderTemplate("digest_template.html", data)
+	if err != nil {
+		log.Printf("[Email] Failed to render digest template: %v", err)
+		return err
+	}
+
+	return deliver(toEmail, subject, htmlContent, headers)
+}
+
+func mockSendDigest(toEmail, userName, period string, groups []DigestGroup, unsubscribeURL string) error {
+	log.Printf("---------------------------------------------------")
+	log.Printf("MOCK EMAIL TO: %s", toEmail)
+	log.Printf("SUBJECT: Your %s digest, %s", period, userName)
+	log.Printf("BODY:")
+	for _, g := range groups {
+		log.Printf("## %s (%d new)", g.Title, len(g.Jobs))
+		for i, job := range g.Jobs {
+			if i >= 5 {
+				log.Printf("... and %d more.", len(g.Jobs)-5)
+				break
+			}
+			log.Printf("- %s at %s: %s", job.Title, job.Company, job.JobURL)
+		}
+	}
+	log.Printf("Unsubscribe: %s", unsubscribeURL)
+	log.Printf("---------------------------------------------------")
+	return nil
+}
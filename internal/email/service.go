@@ -7,12 +7,16 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"net/url"
 	"os"
 
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/unsubscribe"
+
 	"github.com/resend/resend-go/v3"
 )
 
-//go:embed template.html
+//go:embed template.html digest_template.html account_template.html
 var emailTemplateFS embed.FS
 
 type JobResult struct {
@@ -31,45 +35,15 @@ type EmailData struct {
 	UnsubscribeURL string
 }
 
-func SendJobAlert(toEmail, userName string, userID, searchID int, jobs []interface{}) error {
-	apiKey := os.Getenv("RESEND_API_KEY")
-	appName := os.Getenv("APP_NAME")
-	if appName == "" {
-		appName = "JobSeek"
-	}
-
-	domain := os.Getenv("APP_DOMAIN")
-	if domain == "" {
-		domain = "http://localhost:8080"
-	}
+func SendJobAlert(toEmail, userName string, userID, searchID int, jobs []models.Job) error {
+	appName, domain := appSettings()
 
 	// Prepare Data
-	var jobList []JobResult
-	for _, job := range jobs {
-		j, ok := job.(map[string]interface{})
-		if ok {
-			title := j["title"].(string)
-			company := j["company"].(string)
-			rawUrl := j["job_url"].(string)
-			if title == "" {
-				title = "Job Opening"
-			}
-			if company == "" {
-				company = "Unknown Company"
-			}
-
-			// Wrap URL with Redirect
-			encodedUrl := base64.URLEncoding.EncodeToString([]byte(rawUrl))
-			redirectUrl := fmt.Sprintf("%s/api/redirect?data=%s", domain, encodedUrl)
-
-			jobList = append(jobList, JobResult{
-				Title:   title,
-				Company: company,
-				Url:     redirectUrl,
-			})
-		}
+	jobList := jobResults(domain, jobs)
+	unsubscribeURL, headers, err := unsubscribeLinks(domain, userID, searchID)
+	if err != nil {
+		return err
 	}
-	unsubscribeURL := fmt.Sprintf("%s/unsubscribe?uid=%d&sid=%d", domain, userID, searchID)
 
 	data := EmailData{
 		AppName:        appName,
@@ -82,20 +56,85 @@ func SendJobAlert(toEmail, userName string, userID, searchID int, jobs []interfa
 	}
 
 	// Mock Fallback
-	if apiKey == "" {
+	if os.Getenv("RESEND_API_KEY") == "" {
 		log.Println("[Email] RESEND_API_KEY is missing. Falling back to mock email.")
-		return mockSend(toEmail, userName, jobs)
+		return mockSend(toEmail, userName, jobs, unsubscribeURL)
 	}
 
-	client := resend.NewClient(apiKey)
 	subject := fmt.Sprintf("Found %d New Jobs For You!", len(jobs))
 
-	htmlContent, err := renderTemplate(data)
+	htmlContent, err := renderTemplate("template.html", data)
 	if err != nil {
 		log.Printf("[Email] Failed to render template: %v", err)
 		return err
 	}
 
+	return deliver(toEmail, subject, htmlContent, headers)
+}
+
+// unsubscribeLinks returns the signed link to the unsubscribe page for the
+// email body, and RFC 8058 headers that let mail clients unsubscribe in one
+// click by POSTing to the API directly. searchID 0 covers all the user's
+// alerts.
+func unsubscribeLinks(domain string, userID, searchID int) (string, map[string]string, error) {
+	token, err := unsubscribe.Token(userID, searchID)
+	if err != nil {
+		return "", nil, err
+	}
+	token = url.QueryEscape(token)
+	return domain + "/unsubscribe?token=" + token, map[string]string{
+		"List-Unsubscribe":      "<" + domain + "/api/unsubscribe?token=" + token + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}, nil
+}
+
+// appSettings returns the app name and public base URL used in emails.
+func appSettings() (string, string) {
+	appName := os.Getenv("APP_NAME")
+	if appName == "" {
+		appName = "JobSeek"
+	}
+
+	domain := os.Getenv("APP_DOMAIN")
+	if domain == "" {
+		domain = "http://localhost:8080"
+	}
+	return appName, domain
+}
+
+// jobResults prepares jobs for the templates, filling in placeholders and
+// wrapping each URL with the redirect endpoint.
+func jobResults(domain string, jobs []models.Job) []JobResult {
+	var jobList []JobResult
+	for _, job := range jobs {
+		title := job.Title
+		company := job.Company
+		if title == "" {
+			title = "Job Opening"
+		}
+		if company == "" {
+			company = "Unknown Company"
+		}
+
+		// Wrap URL with Redirect
+		encodedUrl := base64.URLEncoding.EncodeToString([]byte(job.JobURL))
+		redirectUrl := fmt.Sprintf("%s/api/redirect?data=%s", domain, encodedUrl)
+
+		jobList = append(jobList, JobResult{
+			Title:   title,
+			Company: company,
+			Url:     redirectUrl,
+		})
+	}
+	return jobList
+}
+
+// deliver sends a rendered email through Resend, with optional extra
+// headers.
+func deliver(toEmail, subject, htmlContent string, headers map[string]string) error {
+	appName, _ := appSettings()
+	client := resend.NewClient(os.Getenv("RESEND_API_KEY"))
+
 	// Construct Sender Name
 	fromName := fmt.Sprintf("%s Expat", appName)
 	// fromEmail := fmt.Sprintf("jobs@%s.com", appName)
@@ -111,6 +150,7 @@ func SendJobAlert(toEmail, userName string, userID, searchID int, jobs []interfa
 		To:      []string{toEmail},
 		Subject: subject,
 		Html:    htmlContent,
+		Headers: headers,
 	}
 
 	sent, err := client.Emails.Send(params)
@@ -123,8 +163,8 @@ func SendJobAlert(toEmail, userName string, userID, searchID int, jobs []interfa
 	return nil
 }
 
-func renderTemplate(data EmailData) (string, error) {
-	t, err := template.ParseFS(emailTemplateFS, "template.html")
+func renderTemplate(name string, data interface{}) (string, error) {
+	t, err := template.ParseFS(emailTemplateFS, name)
 	if err != nil {
 		return "", fmt.Errorf("error parsing template: %v", err)
 	}
@@ -137,7 +177,7 @@ func renderTemplate(data EmailData) (string, error) {
 	return buf.String(), nil
 }
 
-func mockSend(toEmail, userName string, jobs []interface{}) error {
+func mockSend(toEmail, userName string, jobs []models.Job, unsubscribeURL string) error {
 	log.Printf("---------------------------------------------------")
 	log.Printf("MOCK EMAIL TO: %s", toEmail)
 	log.Printf("SUBJECT: New Job Matches Found for %s!", userName)
@@ -150,12 +190,10 @@ func mockSend(toEmail, userName string, jobs []interface{}) error {
 			log.Printf("... and %d more.", len(jobs)-5)
 			break
 		}
-		j, ok := job.(map[string]interface{})
-		if ok {
-			log.Printf("- %s at %s: %s", j["title"], j["company"], j["job_url"])
-		}
+		log.Printf("- %s at %s: %s", job.Title, job.Company, job.JobURL)
 		count++
 	}
+	log.Printf("Unsubscribe: %s", unsubscribeURL)
 	log.Printf("---------------------------------------------------")
 	return nil
 }
@@ -0,0 +1,111 @@
+// Package entitlements decides what each account may do. Handlers and the
+// scheduler resolve an account's Entitlements here instead of checking the
+// plan themselves.
+package entitlements
+
+import "time"
+
+// Tier is the effective plan of an account.
+type Tier string
+
+const (
+	// Basic is a paid account on the basic plan.
+	Basic Tier = "basic"
+	// Pro is a paid account on the pro plan.
+	Pro Tier = "pro"
+	// Trial is an unpaid account within its trial period.
+	Trial Tier = "trial"
+	// Expired is an unpaid account whose trial has ended. It can still log
+	// in and search, but its alerts are paused.
+	Expired Tier = "expired"
+)
+
+// Entitlements are the capabilities and quotas of a tier. A zero quota means
+// the feature isn't included.
+type Entitlements struct {
+	Tier               Tier   `json:"tier"`
+	MaxAlerts          int    `json:"max_alerts"`
+	MinAlertFrequency  string `json:"min_alert_frequency,omitempty"` // most frequent preset allowed
+	CVAnalysesPerMonth int    `json:"cv_analyses_per_month"`
+	MaxResultsWanted   int    `json:"max_results_wanted"`
+
+	// Rolling quotas enforced by the usage meter
+	SearchesPerDay      int `json:"searches_per_day"`
+	AlertsCreatedPerDay int `json:"alerts_created_per_day"`
+
+	// MinAlertInterval is the shortest allowed gap between two runs of an
+	// alert, matching MinAlertFrequency.
+	MinAlertInterval time.Duration `json:"-"`
+}
+
+// Plans declares the entitlements of every tier.
+var Plans = map[Tier]Entitlements{
+	Basic: {
+		Tier:                Basic,
+		MaxAlerts:           3,
+		MinAlertFrequency:   "daily",
+		MinAlertInterval:    24 * time.Hour,
+		CVAnalysesPerMonth:  1,
+		MaxResultsWanted:    25,
+		SearchesPerDay:      100,
+		AlertsCreatedPerDay: 10,
+	},
+	Pro: {
+		Tier:                Pro,
+		MaxAlerts:           25,
+		MinAlertFrequency:   "hourly",
+		MinAlertInterval:    time.Hour,
+		CVAnalysesPerMonth:  20,
+		MaxResultsWanted:    100,
+		SearchesPerDay:      1000,
+		AlertsCreatedPerDay: 50,
+	},
+	Trial: {
+		Tier:                Trial,
+		MaxAlerts:           5,
+		MinAlertFrequency:   "hourly",
+		MinAlertInterval:    time.Hour,
+		CVAnalysesPerMonth:  3,
+		MaxResultsWanted:    50,
+		SearchesPerDay:      50,
+		AlertsCreatedPerDay: 10,
+	},
+	Expired: {
+		Tier:             Expired,
+		MaxResultsWanted: 10,
+		SearchesPerDay:   10,
+	},
+}
+
+// TierFor returns the effective tier of an account with the given plan and
+// payment status at now.
+func TierFor(plan string, paid bool, trialEndsAt, now time.Time) Tier {
+	switch {
+	case paid && plan == string(Pro):
+		return Pro
+	case paid:
+		return Basic
+	case now.Before(trialEndsAt):
+		return Trial
+	default:
+		return Expired
+	}
+}
+
+// For returns the current entitlements of an account.
+func For(plan string, paid bool, trialEndsAt time.Time) Entitlements {
+	return Plans[TierFor(plan, paid, trialEndsAt, time.Now())]
+}
+
+// AllowsAlerts reports whether the account may have alerts at all.
+func (e Entitlements) AllowsAlerts() bool {
+	return e.MaxAlerts > 0
+}
+
+// CapResults limits a requested number of results to the tier's cap.
+func (e Entitlements) CapResults(n int) int {
+	if n > e.MaxResultsWanted {
+		return e.MaxResultsWanted
+	}
+	return n
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/billing"
+	"jobseek-web-be/internal/middleware"
+	"jobseek-web-be/internal/oidc"
+	"jobseek-web-be/internal/repository"
+	"jobseek-web-be/internal/usage"
+)
+
+// API holds the dependencies of the handlers that read or write storage.
+type API struct {
+	Users    repository.UserRepository
+	Searches repository.SearchRepository
+	Auth     *auth.Service
+	Meter    *usage.Meter
+	Billing  *billing.Service
+	OIDC     *oidc.Registry
+}
+
+func NewAPI(store *repository.Store, authService *auth.Service) *API {
+	return &API{
+		Users:    store.Users,
+		Searches: store.Searches,
+		Auth:     authService,
+		Meter:    usage.NewMeter(store.Usage),
+		Billing:  billing.NewService(billing.ConfigFromEnv(), store),
+		OIDC:     oidc.ConfigFromEnv(),
+	}
+}
+
+// principal returns the user authenticated by middleware.Auth. Every
+// handler calling it must be wired through that middleware.
+func principal(w http.ResponseWriter, r *http.Request) (*middleware.Principal, bool) {
+	p, ok := middleware.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+	}
+	return p, ok
+}
+
+// consume meters one use of the feature, responding with 403 when the
+// user's plan doesn't include it and with 429 and Retry-After when its quota
+// is used up. It reports whether the request may go on.
+func (a *API) consume(w http.ResponseWriter, r *http.Request, user *middleware.Principal, f usage.Feature) bool {
+	err := a.Meter.Consume(r.Context(), user.ID, user.Entitlements, f)
+	if err == nil {
+		return true
+	}
+
+	var notIncluded *usage.NotIncludedError
+	if errors.As(err, &notIncluded) {
+		http.Error(w, notIncluded.Error(), http.StatusForbidden)
+		return false
+	}
+	var exceeded *usage.ExceededError
+	if errors.As(err, &exceeded) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(exceeded.RetryAfter.Seconds()))))
+		http.Error(w, exceeded.Error(), http.StatusTooManyRequests)
+		return false
+	}
+	log.Printf("Failed to record %s usage for user %d: %v", f, user.ID, err)
+	http.Error(w, "Database error", http.StatusInternalServerError)
+	return false
+}
+
+// refund takes back a use metered by consume when the request then failed
+// on our side, so errors don't eat into the user's quota.
+func (a *API) refund(r *http.Request, user *middleware.Principal, f usage.Feature) {
+	// The client may have gone away, which is often why the request failed
+	ctx := context.WithoutCancel(r.Context())
+	if err := a.Meter.Refund(ctx, user.ID, f); err != nil {
+		log.Printf("Failed to refund %s usage for user %d: %v", f, user.ID, err)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/middleware"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// newTestAPI returns handlers backed by an in-memory store.
+func newTestAPI(t *testing.T) (*API, *repository.Store) {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	return NewAPI(store, auth.NewService(nil, store)), store
+}
+
+// testUser stores a verified user on the tier and returns the principal
+// middleware.Auth would build for them.
+func testUser(t *testing.T, store *repository.Store, email string, tier entitlements.Tier) *middleware.Principal {
+	t.Helper()
+	u := models.User{Name: "Test User", Email: email, Password: "hash"}
+	if err := store.Users.Create(context.Background(), &u); err != nil {
+		t.Fatal(err)
+	}
+	return &middleware.Principal{
+		ID:            u.ID,
+		Email:         u.Email,
+		Name:          u.Name,
+		EmailVerified: true,
+		Entitlements:  entitlements.Plans[tier],
+	}
+}
+
+// serve runs handler on a request made as user, who may be nil.
+func serve(handler http.HandlerFunc, user *middleware.Principal, method, target, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if user != nil {
+		r = r.WithContext(middleware.WithPrincipal(r.Context(), user))
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
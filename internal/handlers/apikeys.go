@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// APIKeysHandler lists the user's API keys (GET /api/keys), creates one
+// (POST /api/keys) or revokes one (DELETE /api/keys/{id}).
+func (a *API) APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/keys"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && idStr == "":
+		keys, err := a.Auth.ListAPIKeys(r.Context(), user.ID)
+		if err != nil {
+			log.Printf("[Auth] Failed to list API keys of user %d: %v", user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if keys == nil {
+			keys = []models.APIKey{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+
+	case r.Method == http.MethodPost && idStr == "":
+		var req models.CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		key, err := a.Auth.CreateAPIKey(r.Context(), user.ID, req.Name, req.Scopes)
+		switch {
+		case errors.Is(err, auth.ErrInvalidScope):
+			http.Error(w, "Scopes must be one or more of "+strings.Join(auth.Scopes, ", "), http.StatusBadRequest)
+			return
+		case errors.Is(err, auth.ErrTooManyAPIKeys):
+			http.Error(w, "You have too many API keys, revoke one first", http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("[Auth] Failed to create API key for user %d: %v", user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(key)
+
+	case r.Method == http.MethodDelete && idStr != "":
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+			return
+		}
+		err = a.Auth.RevokeAPIKey(r.Context(), user.ID, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("[Auth] Failed to revoke API key %d of user %d: %v", id, user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
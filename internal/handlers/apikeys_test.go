@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/models"
+)
+
+func TestAPIKeys(t *testing.T) {
+	api, store := newTestAPI(t)
+	user := testUser(t, store, "alice@example.com", entitlements.Trial)
+
+	// No keys is an empty list, not null
+	w := serve(api.APIKeysHandler, user, http.MethodGet, "/api/keys", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("list without keys: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(api.APIKeysHandler, user, http.MethodPost, "/api/keys", `{"name": "ci", "scopes": ["alerts:write", "search:read"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var created models.CreatedAPIKey
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Key, created.Prefix+"_") || strings.Join(created.Scopes, " ") != "search:read alerts:write" {
+		t.Errorf("unexpected key %+v", created)
+	}
+
+	w = serve(api.APIKeysHandler, user, http.MethodPost, "/api/keys", `{"name": "bad", "scopes": ["admin"]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown scope: got %d, want 400", w.Code)
+	}
+
+	w = serve(api.APIKeysHandler, user, http.MethodDelete, "/api/keys/"+strconv.Itoa(created.ID), "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body)
+	}
+	w = serve(api.APIKeysHandler, user, http.MethodGet, "/api/keys", "")
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("revoked key still listed: %s", w.Body)
+	}
+}
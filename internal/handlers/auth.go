@@ -1,14 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/middleware"
 	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
 )
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -20,7 +29,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := auth.RegisterUser(req); err != nil {
+	if err := a.Auth.RegisterUser(r.Context(), req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -29,7 +38,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "User created successfully"})
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -41,16 +50,367 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, sub, name, err := auth.LoginUser(creds)
-	if err != nil {
+	user, pair, err := a.Auth.LoginUser(r.Context(), creds, clientInfo(r))
+	var throttled *auth.TooManyAttemptsError
+	var mfa *auth.MFARequiredError
+	switch {
+	case errors.As(err, &mfa):
+		writeMFAChallenge(w, mfa)
+		return
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		http.Error(w, throttled.Error(), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, auth.ErrInvalidCredentials):
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
+	case err != nil:
+		log.Printf("[Auth] Login failed: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
 	}
 
+	writeTokens(w, user, pair)
+}
+
+// RefreshHandler trades a refresh token for a new access token and a new
+// refresh token. The old refresh token stops working; presenting it again
+// revokes the whole session.
+func (a *API) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, pair, err := a.Auth.Refresh(r.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		http.Error(w, "Refresh token reuse detected; session revoked", http.StatusUnauthorized)
+		return
+	case errors.Is(err, auth.ErrInvalidRefreshToken):
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("[Auth] Failed to refresh session: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, user, pair)
+}
+
+func writeTokens(w http.ResponseWriter, user *models.User, pair *auth.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 	json.NewEncoder(w).Encode(models.AuthResponse{
-		Token:        token,
-		Subscription: sub,
-		Name:         name,
-		Email:        creds.Email,
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		Subscription: user.SubscriptionPlan,
+		Name:         user.Name,
+		Email:        user.Email,
 	})
 }
+
+// writeMFAChallenge asks the client to finish logging in with a 2FA code.
+func writeMFAChallenge(w http.ResponseWriter, mfa *auth.MFARequiredError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.MFAChallenge{
+		MFARequired: true,
+		MFAToken:    mfa.Token,
+		ExpiresIn:   int(auth.MFATokenTTL.Seconds()),
+	})
+}
+
+func clientInfo(r *http.Request) auth.ClientInfo {
+	return auth.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        middleware.ClientIP(r),
+	}
+}
+
+// LogoutHandler ends the session the request was made with. With ?all=true
+// it ends every session of the user and revokes all their tokens instead.
+func (a *API) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	if r.URL.Query().Get("all") == "true" {
+		err = a.Auth.RevokeAllTokens(r.Context(), user.ID, auth.RevokedLogoutAll)
+	} else {
+		err = a.Auth.EndSession(r.Context(), user.ID, user.Token)
+	}
+	if err != nil {
+		log.Printf("[Auth] Failed to revoke tokens of user %d: %v", user.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SessionsHandler lists the user's active sessions (GET /api/auth/sessions),
+// revokes one (DELETE /api/auth/sessions/{id}) or revokes all but the
+// current one (DELETE /api/auth/sessions).
+func (a *API) SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	var currentID int
+	if user.Token != nil {
+		currentID = user.Token.SessionID
+	}
+
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/auth/sessions"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && idStr == "":
+		sessions, err := a.Auth.ListSessions(r.Context(), user.ID, currentID)
+		if err != nil {
+			log.Printf("[Auth] Failed to list sessions of user %d: %v", user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if sessions == nil {
+			sessions = []models.Session{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+
+	case r.Method == http.MethodDelete && idStr == "":
+		n, err := a.Auth.RevokeOtherSessions(r.Context(), user.ID, currentID)
+		if err != nil {
+			log.Printf("[Auth] Failed to revoke sessions of user %d: %v", user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"revoked": n})
+
+	case r.Method == http.MethodDelete:
+		sessionID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+		err = a.Auth.RevokeSession(r.Context(), user.ID, sessionID)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("[Auth] Failed to revoke session %d of user %d: %v", sessionID, user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// VerifyEmailHandler confirms the user's email address with the token from
+// their verification email.
+func (a *API) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	err := a.Auth.VerifyEmail(r.Context(), token)
+	if errors.Is(err, auth.ErrInvalidUserToken) {
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("[Auth] Failed to verify email: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "verified"})
+}
+
+// ResendVerificationHandler emails the user a new verification link.
+func (a *API) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.Auth.ResendVerification(r.Context(), user.ID)
+	var tooMany *auth.TooManyEmailsError
+	switch {
+	case errors.Is(err, auth.ErrAlreadyVerified):
+		http.Error(w, "Email already verified", http.StatusConflict)
+		return
+	case errors.As(err, &tooMany):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+		http.Error(w, tooMany.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		log.Printf("[Auth] Failed to resend verification email to user %d: %v", user.ID, err)
+		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+var weakPasswordMessage = fmt.Sprintf("Password must be at least %d characters", auth.MinPasswordLength)
+
+// ForgotPasswordHandler emails a password reset link. It always answers 202
+// and does the work in the background, so neither the response nor its
+// timing reveals whether the address has an account.
+func (a *API) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		if err := a.Auth.RequestPasswordReset(ctx, req.Email); err != nil {
+			log.Printf("[Auth] Failed to send password reset email: %v", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the address has an account, a reset link is on its way"})
+}
+
+// ResetPasswordHandler sets a new password with the token from a reset email.
+// All of the user's sessions end, so they log in again afterwards.
+func (a *API) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := a.Auth.ResetPassword(r.Context(), req.Token, req.Password)
+	switch {
+	case errors.Is(err, auth.ErrWeakPassword):
+		http.Error(w, weakPasswordMessage, http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrInvalidUserToken):
+		http.Error(w, "Invalid or expired reset link", http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("[Auth] Failed to reset password: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated"})
+}
+
+// ChangePasswordHandler replaces the password of the logged in user. Every
+// session ends, and the response carries tokens for a new one so the client
+// making the change stays logged in.
+func (a *API) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updated, pair, err := a.Auth.ChangePassword(r.Context(), user.ID, req.CurrentPassword, req.NewPassword, clientInfo(r))
+	var throttled *auth.TooManyAttemptsError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		http.Error(w, throttled.Error(), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, auth.ErrWrongPassword):
+		http.Error(w, "Current password is incorrect", http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrWeakPassword):
+		http.Error(w, weakPasswordMessage, http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("[Auth] Failed to change password of user %d: %v", user.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, updated, pair)
+}
+
+// UnlockAccountHandler lifts an account lockout with the token from the
+// lockout email.
+func (a *API) UnlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	err := a.Auth.UnlockAccount(r.Context(), token)
+	if errors.Is(err, auth.ErrInvalidUserToken) {
+		http.Error(w, "Invalid or expired unlock link", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("[Auth] Failed to unlock account: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "unlocked"})
+}
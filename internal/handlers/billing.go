@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"jobseek-web-be/internal/billing"
+	"jobseek-web-be/internal/models"
+)
+
+// maxWebhookBody bounds the webhook payloads read into memory.
+const maxWebhookBody = 1 << 20
+
+// CheckoutHandler starts a checkout for a plan and returns the URL to send
+// the user to.
+func (a *API) CheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if user.Paid && user.Plan == req.Plan {
+		http.Error(w, fmt.Sprintf("Already subscribed to %s", req.Plan), http.StatusConflict)
+		return
+	}
+
+	session, err := a.Billing.Checkout(r.Context(), user.ID, user.Email, req.Plan)
+	if errors.Is(err, billing.ErrNotConfigured) {
+		http.Error(w, "Billing is not configured", http.StatusServiceUnavailable)
+		return
+	} else if errors.Is(err, billing.ErrUnknownPlan) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("[Billing] Checkout failed for user %d: %v", user.ID, err)
+		http.Error(w, "Failed to start checkout", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// BillingWebhookHandler receives signed subscription events from the billing
+// provider. Failures return 5xx so the provider retries the delivery.
+func (a *API) BillingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := a.Billing.ParseEvent(payload, r.Header.Get(billing.SignatureHeader))
+	if errors.Is(err, billing.ErrNotConfigured) {
+		http.Error(w, "Billing is not configured", http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		log.Printf("[Billing] Rejected webhook: %v", err)
+		http.Error(w, "Invalid webhook", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.Billing.HandleEvent(r.Context(), event); err != nil {
+		log.Printf("[Billing] Failed to handle event %s (%s): %v", event.ID, event.Type, err)
+		http.Error(w, "Failed to handle event", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"received": true})
+}
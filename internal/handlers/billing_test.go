@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/billing"
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+const webhookSecret = "whsec_test"
+
+// webhookServer serves the billing webhook over the in-memory store and
+// returns a user whose trial has long ended.
+func webhookServer(t *testing.T) (*httptest.Server, *repository.Store, models.User) {
+	t.Helper()
+	api, store := newTestAPI(t)
+	api.Billing = billing.NewService(billing.Config{
+		WebhookSecret: webhookSecret,
+		Prices:        map[string]string{"basic": "price_basic", "pro": "price_pro"},
+	}, store)
+	srv := httptest.NewServer(http.HandlerFunc(api.BillingWebhookHandler))
+	t.Cleanup(srv.Close)
+
+	u := models.User{Name: "Alice", Email: "alice@example.com", Password: "hash", CreatedAt: time.Now().Add(-60 * 24 * time.Hour)}
+	if err := store.Users.Create(context.Background(), &u); err != nil {
+		t.Fatal(err)
+	}
+	return srv, store, u
+}
+
+// sendEvent posts the event like the "billing send-webhook" command does,
+// signed with secret at sentAt, and returns the response status.
+func sendEvent(t *testing.T, srv *httptest.Server, ev billing.FakeEvent, secret string, sentAt time.Time) int {
+	t.Helper()
+	payload, err := ev.Payload(billing.Config{Prices: map[string]string{"basic": "price_basic", "pro": "price_pro"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := billing.SendWebhook(context.Background(), srv.Client(), srv.URL, secret, payload, sentAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// tierOf returns the user's current tier as middleware.Auth resolves it.
+func tierOf(t *testing.T, store *repository.Store, userID int) entitlements.Tier {
+	t.Helper()
+	u, err := store.Users.GetByID(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entitlements.For(u.SubscriptionPlan, u.Paid, auth.TrialEnd(u.CreatedAt)).Tier
+}
+
+func TestBillingWebhookRejectsBadSignatures(t *testing.T) {
+	srv, store, u := webhookServer(t)
+	now := time.Now()
+	ev := billing.FakeEvent{Type: billing.EventSubscriptionCreated, UserID: u.ID, Plan: "pro", Created: now}
+
+	for _, tc := range []struct {
+		name   string
+		secret string
+		sentAt time.Time
+	}{
+		{"wrong secret", "whsec_other", now},
+		{"stale", webhookSecret, now.Add(-billing.DefaultTolerance - time.Minute)},
+		{"from the future", webhookSecret, now.Add(billing.DefaultTolerance + time.Minute)},
+	} {
+		if code := sendEvent(t, srv, ev, tc.secret, tc.sentAt); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", tc.name, code)
+		}
+	}
+	if tier := tierOf(t, store, u.ID); tier != entitlements.Expired {
+		t.Errorf("rejected events changed the tier to %s", tier)
+	}
+}
+
+func TestBillingWebhookTierTransitions(t *testing.T) {
+	srv, store, u := webhookServer(t)
+	start := time.Now().Add(-time.Hour)
+
+	for i, step := range []struct {
+		ev   billing.FakeEvent
+		want entitlements.Tier
+	}{
+		{billing.FakeEvent{Type: billing.EventSubscriptionCreated, Plan: "basic"}, entitlements.Basic},
+		{billing.FakeEvent{Type: billing.EventSubscriptionUpdated, Plan: "pro"}, entitlements.Pro},
+		// Access is suspended while a payment is failing
+		{billing.FakeEvent{Type: billing.EventPaymentFailed}, entitlements.Expired},
+		{billing.FakeEvent{Type: billing.EventSubscriptionUpdated, Plan: "pro"}, entitlements.Pro},
+		{billing.FakeEvent{Type: billing.EventSubscriptionDeleted, Plan: "pro"}, entitlements.Expired},
+	} {
+		step.ev.UserID = u.ID
+		step.ev.Created = start.Add(time.Duration(i) * time.Minute)
+		if code := sendEvent(t, srv, step.ev, webhookSecret, time.Now()); code != http.StatusOK {
+			t.Fatalf("step %d (%s): got %d", i, step.ev.Type, code)
+		}
+		if tier := tierOf(t, store, u.ID); tier != step.want {
+			t.Errorf("step %d (%s): tier %s, want %s", i, step.ev.Type, tier, step.want)
+		}
+	}
+
+	subs, err := store.Subscriptions.ListByUser(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Status != "canceled" || subs[0].Plan != "pro" {
+		t.Errorf("subscriptions = %+v", subs)
+	}
+}
+
+func TestBillingWebhookReplaysAndOutOfOrderEvents(t *testing.T) {
+	srv, store, u := webhookServer(t)
+	created := time.Now().Add(-time.Hour)
+	upgraded := created.Add(time.Minute)
+
+	upgrade := billing.FakeEvent{ID: "evt_upgrade", Type: billing.EventSubscriptionUpdated, UserID: u.ID, Plan: "pro", Created: upgraded}
+	if code := sendEvent(t, srv, upgrade, webhookSecret, time.Now()); code != http.StatusOK {
+		t.Fatalf("upgrade: got %d", code)
+	}
+
+	// The creation event is delivered late and must not downgrade
+	create := billing.FakeEvent{ID: "evt_create", Type: billing.EventSubscriptionCreated, UserID: u.ID, Plan: "basic", Created: created}
+	if code := sendEvent(t, srv, create, webhookSecret, time.Now()); code != http.StatusOK {
+		t.Fatalf("late creation: got %d", code)
+	}
+	if tier := tierOf(t, store, u.ID); tier != entitlements.Pro {
+		t.Errorf("after a late event the tier is %s, want pro", tier)
+	}
+
+	// A retried delivery of the latest event is applied again, repairing a
+	// user update that failed the first time
+	if err := store.Users.SetPlan(context.Background(), u.ID, "pro", false); err != nil {
+		t.Fatal(err)
+	}
+	if code := sendEvent(t, srv, upgrade, webhookSecret, time.Now()); code != http.StatusOK {
+		t.Fatalf("replay: got %d", code)
+	}
+	if tier := tierOf(t, store, u.ID); tier != entitlements.Pro {
+		t.Errorf("after a replay the tier is %s, want pro", tier)
+	}
+
+	sub, err := store.Subscriptions.Get(context.Background(), "sub_test_"+strconv.Itoa(u.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sub.EventAt.Equal(time.Unix(upgraded.Unix(), 0)) {
+		t.Errorf("subscription from the event at %v, want the upgrade at %v", sub.EventAt, upgraded)
+	}
+}
+
+func TestBillingWebhookIgnoresUnknownUsers(t *testing.T) {
+	srv, store, u := webhookServer(t)
+	ev := billing.FakeEvent{Type: billing.EventSubscriptionCreated, UserID: u.ID + 1, Plan: "pro"}
+	if code := sendEvent(t, srv, ev, webhookSecret, time.Now()); code != http.StatusOK {
+		t.Errorf("got %d, want 200 so the provider stops retrying", code)
+	}
+	if subs, err := store.Subscriptions.ListByUser(context.Background(), u.ID+1); err != nil || len(subs) != 0 {
+		t.Errorf("subscription stored for an unknown user: %+v, %v", subs, err)
+	}
+}
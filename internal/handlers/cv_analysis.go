@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,13 +10,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
-	"jobseek-web-be/internal/auth"
-	"jobseek-web-be/internal/db"
 	"jobseek-web-be/internal/search"
-
-	"github.com/golang-jwt/jwt/v5"
+	"jobseek-web-be/internal/usage"
 )
 
 // CVAnalysisRequest represents the request parameters for CV analysis
@@ -34,75 +29,29 @@ type CVAnalysisResponse struct {
 }
 
 // AnalyzeCVHandler handles CV upload and analysis (Pro users only)
-func AnalyzeCVHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) AnalyzeCVHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// 1. Verify Auth Token and Pro status
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "Missing authorization header", http.StatusUnauthorized)
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return auth.SecretKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
+	// 1. Verify the plan includes CV analysis
+	user, ok := principal(w, r)
 	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
 		return
 	}
 
-	email, ok := claims["email"].(string)
-	if !ok {
-		http.Error(w, "Invalid token email", http.StatusUnauthorized)
-		return
-	}
-
-	// Get user from database
-	var userID int
-	var subscription string
-	var paid int
-	var createdAt time.Time
-
-	err = db.DB.QueryRow("SELECT id, subscription_plan, paid, created_at FROM users WHERE email = ?", email).
-		Scan(&userID, &subscription, &paid, &createdAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-
-	// Check if user is Pro or in trial
-	trialDays := 7
-	daysSinceRegistration := int(time.Since(createdAt).Hours() / 24)
-	isPro := subscription == "pro" && paid == 1
-	isInTrial := daysSinceRegistration < trialDays
-
-	if !isPro && !isInTrial {
+	if user.Entitlements.CVAnalysesPerMonth == 0 {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusForbidden)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "CV analysis is a Pro feature. Please upgrade your subscription.",
+			"error": "Your plan doesn't include CV analysis. Please upgrade your subscription.",
 		})
 		return
 	}
 
 	// 2. Parse multipart form
-	err = r.ParseMultipartForm(10 << 20) // 10 MB max
+	err := r.ParseMultipartForm(10 << 20) // 10 MB max
 	if err != nil {
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
@@ -171,6 +120,11 @@ func AnalyzeCVHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only requests that reach Gemini count towards the monthly quota
+	if !a.consume(w, r, user, usage.CVAnalysis) {
+		return
+	}
+
 	// Set GEMINI_API_KEY from environment
 	cmd := exec.Command(cmdPath, args...)
 	cmd.Env = append(os.Environ(), fmt.Sprintf("GEMINI_API_KEY=%s", geminiKey))
@@ -178,6 +132,7 @@ func AnalyzeCVHandler(w http.ResponseWriter, r *http.Request) {
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("CV Analysis failed: %s\nOutput: %s", err, string(output))
+		a.refund(r, user, usage.CVAnalysis)
 		http.Error(w, fmt.Sprintf("Analysis failed: %s", string(output)), http.StatusInternalServerError)
 		return
 	}
@@ -186,6 +141,7 @@ func AnalyzeCVHandler(w http.ResponseWriter, r *http.Request) {
 	var analysisResult CVAnalysisResponse
 	err = json.Unmarshal(output, &analysisResult)
 	if err != nil {
+		a.refund(r, user, usage.CVAnalysis)
 		http.Error(w, "Failed to parse analysis result", http.StatusInternalServerError)
 		return
 	}
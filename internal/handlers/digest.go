@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/scheduler"
+)
+
+// DigestSettingsHandler reads (GET) or changes (PUT) the user's digest mode.
+func (a *API) DigestSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	// Get current setting
+	user, err := a.Users.GetByID(r.Context(), p.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	settings := models.DigestSettings{Digest: user.DigestFrequency}
+	if settings.Digest == "" {
+		settings.Digest = scheduler.DigestOff
+	}
+
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := scheduler.DigestPeriods[settings.Digest]; !ok && settings.Digest != scheduler.DigestOff {
+			http.Error(w, "Invalid digest: must be off, daily or weekly", http.StatusBadRequest)
+			return
+		}
+
+		if err := a.Users.SetDigestFrequency(r.Context(), user.ID, settings.Digest); err != nil {
+			http.Error(w, "Failed to update settings", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
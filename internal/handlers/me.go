@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"jobseek-web-be/internal/entitlements"
+)
+
+// MeResponse describes the authenticated user and what their plan allows.
+type MeResponse struct {
+	ID            int                       `json:"id"`
+	Name          string                    `json:"name"`
+	Email         string                    `json:"email"`
+	EmailVerified bool                      `json:"email_verified"`
+	Subscription  string                    `json:"subscription"`
+	Paid          bool                      `json:"paid"`
+	TrialEndsAt   *time.Time                `json:"trial_ends_at,omitempty"` // unpaid accounts only
+	Alerts        int                       `json:"alerts"`
+	Entitlements  entitlements.Entitlements `json:"entitlements"`
+}
+
+// MeHandler returns the current user's profile and effective entitlements.
+func (a *API) MeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	searches, err := a.Searches.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := MeResponse{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Subscription:  user.Plan,
+		Paid:          user.Paid,
+		Alerts:        len(searches),
+		Entitlements:  user.Entitlements,
+	}
+	if !user.Paid {
+		trialEndsAt := user.TrialEndsAt.UTC()
+		resp.TrialEndsAt = &trialEndsAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/middleware"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// MFAStatus is the response of GET /api/auth/mfa.
+type MFAStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// MFAHandler reports whether 2FA is on (GET) or turns it off with a current
+// code (DELETE).
+func (a *API) MFAHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		enabled, left, err := a.Auth.MFAStatus(r.Context(), user.ID)
+		if err != nil {
+			log.Printf("[Auth] Failed to load 2FA status of user %d: %v", user.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MFAStatus{Enabled: enabled, RecoveryCodesLeft: left})
+
+	case http.MethodDelete:
+		var req models.MFACodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		err := a.Auth.DisableMFA(r.Context(), user.ID, req.Code, middleware.ClientIP(r))
+		if errors.Is(err, auth.ErrMFANotEnrolled) {
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+			return
+		} else if err != nil {
+			mfaError(w, user.ID, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// MFAEnrollHandler starts setting up 2FA, returning the secret for the
+// user's authenticator app.
+func (a *API) MFAEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := a.Auth.EnrollMFA(r.Context(), user.ID, user.Email)
+	if errors.Is(err, repository.ErrMFAEnabled) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("[Auth] Failed to enroll user %d in 2FA: %v", user.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// MFAActivateHandler turns on 2FA with a first code from the authenticator
+// app and returns the recovery codes.
+func (a *API) MFAActivateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := a.Auth.ActivateMFA(r.Context(), user.ID, req.Code)
+	switch {
+	case errors.Is(err, auth.ErrMFANotEnrolled):
+		http.Error(w, "Start two-factor setup first", http.StatusConflict)
+		return
+	case errors.Is(err, repository.ErrMFAEnabled):
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	case err != nil:
+		mfaError(w, user.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// MFAVerifyHandler finishes a 2FA login, trading the mfa_token from login
+// and a code for the usual tokens.
+func (a *API) MFAVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	client := clientInfo(r)
+	client.Device = req.Device
+	user, pair, err := a.Auth.CompleteMFALogin(r.Context(), req.MFAToken, req.Code, client)
+	if errors.Is(err, auth.ErrInvalidUserToken) {
+		http.Error(w, "Login expired, log in again", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		mfaError(w, 0, err)
+		return
+	}
+
+	writeTokens(w, user, pair)
+}
+
+// mfaError responds to a failed code check.
+func mfaError(w http.ResponseWriter, userID int, err error) {
+	var throttled *auth.TooManyAttemptsError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		http.Error(w, throttled.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		http.Error(w, "Invalid authentication code", http.StatusUnauthorized)
+	default:
+		log.Printf("[Auth] 2FA check failed for user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+	}
+}
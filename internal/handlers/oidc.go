@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/oidc"
+)
+
+// oidcStateCookie keeps a provider login's state in the browser between the
+// redirect to the provider and its callback.
+const oidcStateCookie = "oidc_state"
+
+// OIDCProvidersHandler lists the providers users can log in with.
+func (a *API) OIDCProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"providers": a.OIDC.Names()})
+}
+
+// OIDCHandler serves /api/auth/oidc/{provider}/login, which sends the
+// browser to the provider, and /api/auth/oidc/{provider}/callback, where the
+// provider sends it back.
+func (a *API) OIDCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/auth/oidc"), "/"), "/")
+	p, err := a.OIDC.Get(name)
+	if err != nil {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "login":
+		a.oidcLogin(w, r, p)
+	case "callback":
+		a.oidcCallback(w, r, p)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *API) oidcLogin(w http.ResponseWriter, r *http.Request, p *oidc.Provider) {
+	authURL, state, err := a.Auth.BeginOIDCLogin(r.Context(), p)
+	if err != nil {
+		log.Printf("[Auth] Failed to start %s login: %v", p.Name, err)
+		http.Error(w, "Login provider unavailable", http.StatusBadGateway)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc/" + p.Name,
+		MaxAge:   int(auth.OIDCStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(p.RedirectURL, "https://"),
+		// Lax, since the callback is a cross-site navigation
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallback finishes the provider login and hands the result to the
+// frontend's callback page in the URL fragment: a login_token to exchange,
+// or an error code.
+func (a *API) oidcCallback(w http.ResponseWriter, r *http.Request, p *oidc.Provider) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/api/auth/oidc/" + p.Name,
+		MaxAge: -1,
+	})
+
+	q := r.URL.Query()
+	result := url.Values{}
+	cookie, err := r.Cookie(oidcStateCookie)
+	switch {
+	case q.Get("error") != "":
+		// The user declined, or the provider refused the request
+		log.Printf("[Auth] %s login failed: %s %s", p.Name, q.Get("error"), q.Get("error_description"))
+		result.Set("error", "access_denied")
+	case err != nil || q.Get("code") == "":
+		result.Set("error", "invalid_state")
+	default:
+		token, err := a.Auth.FinishOIDCLogin(r.Context(), p, cookie.Value, q.Get("state"), q.Get("code"))
+		switch {
+		case err == nil:
+			result.Set("login_token", token)
+		case errors.Is(err, auth.ErrInvalidOIDCState):
+			result.Set("error", "invalid_state")
+		case errors.Is(err, auth.ErrOIDCEmailUnverified):
+			result.Set("error", "email_unverified")
+		case errors.Is(err, auth.ErrOIDCAccountUnverified):
+			result.Set("error", "account_unverified")
+		default:
+			log.Printf("[Auth] %s login failed: %v", p.Name, err)
+			result.Set("error", "login_failed")
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, a.OIDC.CallbackPage+"#"+result.Encode(), http.StatusFound)
+}
+
+// OIDCExchangeHandler trades the login_token from a provider login for the
+// usual tokens, or a 2FA challenge.
+func (a *API) OIDCExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.OIDCExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LoginToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	client := clientInfo(r)
+	client.Device = req.Device
+	user, pair, err := a.Auth.ExchangeOIDCLogin(r.Context(), req.LoginToken, client)
+	var mfa *auth.MFARequiredError
+	switch {
+	case errors.As(err, &mfa):
+		writeMFAChallenge(w, mfa)
+		return
+	case errors.Is(err, auth.ErrInvalidUserToken):
+		http.Error(w, "Login expired, log in again", http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("[Auth] Failed to exchange login token: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, user, pair)
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/oidc"
+	"jobseek-web-be/internal/oidc/oidctest"
+	"jobseek-web-be/internal/repository"
+)
+
+// oidcFlow drives a browser through social login against a mock provider.
+// Its client doesn't follow redirects, so each step can be inspected.
+type oidcFlow struct {
+	provider *oidctest.Provider
+	store    *repository.Store
+	api      *httptest.Server
+	client   *http.Client
+}
+
+// newOIDCFlow serves the OIDC handlers with a mock provider configured
+// through the same OIDC_* variables as in production.
+func newOIDCFlow(t *testing.T) *oidcFlow {
+	t.Helper()
+	keys, err := auth.ParseKeys("test:" + strings.Repeat("k", auth.MinKeyLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := repository.NewMemoryStore()
+	api := NewAPI(store, auth.NewService(keys, store))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/auth/oidc/exchange", api.OIDCExchangeHandler)
+	mux.HandleFunc("/api/auth/oidc/", api.OIDCHandler)
+	apiSrv := httptest.NewServer(mux)
+	t.Cleanup(apiSrv.Close)
+
+	provider, err := oidctest.NewProvider("", "mock-client", "mock-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerSrv := httptest.NewServer(provider)
+	t.Cleanup(providerSrv.Close)
+	provider.Issuer = providerSrv.URL
+
+	t.Setenv("APP_DOMAIN", apiSrv.URL)
+	t.Setenv("OIDC_PROVIDERS", "mock")
+	t.Setenv("OIDC_MOCK_ISSUER", providerSrv.URL)
+	t.Setenv("OIDC_MOCK_CLIENT_ID", "mock-client")
+	t.Setenv("OIDC_MOCK_CLIENT_SECRET", "mock-secret")
+	api.OIDC = oidc.ConfigFromEnv()
+
+	f := &oidcFlow{provider: provider, store: store, api: apiSrv}
+	f.resetBrowser(t)
+	return f
+}
+
+// resetBrowser forgets the cookies of earlier logins.
+func (f *oidcFlow) resetBrowser(t *testing.T) {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.client = &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// redirect requests target and returns where it redirects to.
+func (f *oidcFlow) redirect(t *testing.T, target string) *url.URL {
+	t.Helper()
+	resp, err := f.client.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("GET %s: got %d, want a redirect", target, resp.StatusCode)
+	}
+	loc, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// begin starts a login and signs in at the provider, returning the
+// provider's redirect back to the callback.
+func (f *oidcFlow) begin(t *testing.T) *url.URL {
+	t.Helper()
+	authorize := f.redirect(t, f.api.URL+"/api/auth/oidc/mock/login")
+	if !strings.HasPrefix(authorize.String(), f.provider.Issuer+"/authorize?") {
+		t.Fatalf("login redirected to %s, want the provider", authorize)
+	}
+	return f.redirect(t, authorize.String())
+}
+
+// callback follows the provider's redirect and returns the result handed
+// to the frontend's callback page.
+func (f *oidcFlow) callback(t *testing.T, u *url.URL) url.Values {
+	t.Helper()
+	page := f.redirect(t, u.String())
+	if page.Path != "/oauth/callback" {
+		t.Fatalf("callback redirected to %s, want the frontend", page)
+	}
+	result, err := url.ParseQuery(page.Fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func (f *oidcFlow) login(t *testing.T) url.Values {
+	t.Helper()
+	return f.callback(t, f.begin(t))
+}
+
+// exchange trades a login token for tokens.
+func (f *oidcFlow) exchange(t *testing.T, loginToken string) (*models.AuthResponse, int) {
+	t.Helper()
+	body, _ := json.Marshal(models.OIDCExchangeRequest{LoginToken: loginToken})
+	resp, err := f.client.Post(f.api.URL+"/api/auth/oidc/exchange", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode
+	}
+	var tokens models.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	return &tokens, resp.StatusCode
+}
+
+// userOf returns the account with the email, if there is one.
+func (f *oidcFlow) userOf(t *testing.T, email string) (*models.User, bool) {
+	t.Helper()
+	u, err := f.store.Users.GetByEmail(context.Background(), email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, false
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return u, true
+}
+
+func TestOIDCLogin(t *testing.T) {
+	f := newOIDCFlow(t)
+	f.provider.Email = "jane@example.com"
+	f.provider.Name = "Jane Doe"
+
+	result := f.login(t)
+	if result.Get("error") != "" || result.Get("login_token") == "" {
+		t.Fatalf("login result %v", result)
+	}
+	tokens, code := f.exchange(t, result.Get("login_token"))
+	if code != http.StatusOK {
+		t.Fatalf("exchange: got %d", code)
+	}
+	if tokens.Email != "jane@example.com" || tokens.Name != "Jane Doe" || tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Errorf("unexpected tokens %+v", tokens)
+	}
+	// Login tokens are single-use
+	if _, code := f.exchange(t, result.Get("login_token")); code != http.StatusUnauthorized {
+		t.Errorf("second exchange: got %d, want 401", code)
+	}
+
+	jane, ok := f.userOf(t, "jane@example.com")
+	if !ok || jane.EmailVerifiedAt == nil {
+		t.Fatalf("login didn't create a verified account: %+v", jane)
+	}
+
+	// The next login finds the same account through the linked identity
+	f.resetBrowser(t)
+	if tokens, _ := f.exchange(t, f.login(t).Get("login_token")); tokens == nil || tokens.Email != jane.Email {
+		t.Errorf("second login got %+v", tokens)
+	}
+
+	// A confirmed account with the email is linked rather than duplicated
+	bob := models.User{Name: "Bob", Email: "bob@example.com", Password: "hash"}
+	if err := f.store.Users.Create(context.Background(), &bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.Users.MarkEmailVerified(context.Background(), bob.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	f.provider.Email = bob.Email
+	f.resetBrowser(t)
+	if tokens, _ := f.exchange(t, f.login(t).Get("login_token")); tokens == nil || tokens.Name != "Bob" {
+		t.Errorf("login to a confirmed account got %+v", tokens)
+	}
+}
+
+func TestOIDCLoginRefusesUnverifiedEmails(t *testing.T) {
+	f := newOIDCFlow(t)
+
+	// The provider doesn't vouch for the address
+	f.provider.Email = "jane@example.com"
+	f.provider.EmailVerified = false
+	if result := f.login(t); result.Get("error") != "email_unverified" || result.Get("login_token") != "" {
+		t.Errorf("unverified provider email: result %v", result)
+	}
+	if _, ok := f.userOf(t, "jane@example.com"); ok {
+		t.Error("an account was created for an unverified email")
+	}
+
+	// Someone registered the address but never confirmed it
+	squatter := models.User{Name: "Squatter", Email: "bob@example.com", Password: "hash"}
+	if err := f.store.Users.Create(context.Background(), &squatter); err != nil {
+		t.Fatal(err)
+	}
+	f.provider.Email = squatter.Email
+	f.provider.EmailVerified = true
+	f.resetBrowser(t)
+	if result := f.login(t); result.Get("error") != "account_unverified" || result.Get("login_token") != "" {
+		t.Errorf("unconfirmed account: result %v", result)
+	}
+
+	// Neither was linked, so confirming the account later doesn't let the
+	// earlier provider logins in
+	for _, email := range []string{"jane@example.com", "bob@example.com"} {
+		if _, err := f.store.Identities.GetBySubject(context.Background(), "mock", oidctest.Subject(email)); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("identity for %s was linked: %v", email, err)
+		}
+	}
+}
+
+func TestOIDCLoginRejectsStateAndNonceMismatch(t *testing.T) {
+	f := newOIDCFlow(t)
+
+	t.Run("tampered state", func(t *testing.T) {
+		f.resetBrowser(t)
+		back := f.begin(t)
+		q := back.Query()
+		q.Set("state", q.Get("state")+"x")
+		back.RawQuery = q.Encode()
+		if result := f.callback(t, back); result.Get("error") != "invalid_state" {
+			t.Errorf("result %v, want invalid_state", result)
+		}
+	})
+
+	t.Run("no state cookie", func(t *testing.T) {
+		f.resetBrowser(t)
+		back := f.begin(t)
+		f.resetBrowser(t)
+		if result := f.callback(t, back); result.Get("error") != "invalid_state" {
+			t.Errorf("result %v, want invalid_state", result)
+		}
+	})
+
+	t.Run("callback of another login", func(t *testing.T) {
+		f.resetBrowser(t)
+		first := f.begin(t)
+		f.begin(t) // replaces the state cookie
+		if result := f.callback(t, first); result.Get("error") != "invalid_state" {
+			t.Errorf("result %v, want invalid_state", result)
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		f.resetBrowser(t)
+		f.provider.Email = "replayed@example.com"
+		f.provider.Nonce = "nonce-of-another-login"
+		t.Cleanup(func() { f.provider.Nonce = "" })
+		if result := f.login(t); result.Get("error") != "login_failed" || result.Get("login_token") != "" {
+			t.Errorf("result %v, want login_failed", result)
+		}
+		if _, ok := f.userOf(t, "replayed@example.com"); ok {
+			t.Error("an account was created from an ID token with the wrong nonce")
+		}
+	})
+}
@@ -1,207 +1,128 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
-	"jobseek-web-be/internal/auth"
-	"jobseek-web-be/internal/db"
 	"jobseek-web-be/internal/models"
-
-	"github.com/golang-jwt/jwt/v5"
+	"jobseek-web-be/internal/repository"
+	"jobseek-web-be/internal/scheduler"
+	"jobseek-web-be/internal/search"
+	"jobseek-web-be/internal/usage"
 )
 
-func SaveSearchHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) SaveSearchHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if this is a DELETE request with an ID in the path
 	// e.g., /api/searches/123
 	if r.Method == http.MethodDelete && r.URL.Path != "/api/searches" {
-		deleteSearchHandler(w, r)
+		a.deleteSearchHandler(w, r)
+		return
+	}
+	// e.g., /api/searches/123/resume
+	if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/resume") {
+		a.resumeSearchHandler(w, r)
 		return
 	}
 
 	// Route based on method for /api/searches
 	switch r.Method {
 	case http.MethodGet:
-		listSearchesHandler(w, r)
+		a.listSearchesHandler(w, r)
 	case http.MethodPost:
-		createSearchHandler(w, r)
+		a.createSearchHandler(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func listSearchesHandler(w http.ResponseWriter, r *http.Request) {
-	// 1. Verify Auth Token
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "Missing authorization header", http.StatusUnauthorized)
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return auth.SecretKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
-	}
-
-	email, ok := claims["email"].(string)
+func (a *API) listSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := principal(w, r)
 	if !ok {
-		http.Error(w, "Invalid token email", http.StatusUnauthorized)
-		return
-	}
-
-	// Get User ID
-	var userID int
-	err = db.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
+	userID := user.ID
 
 	// Fetch all searches for this user
-	rows, err := db.DB.Query(`
-		SELECT id, keyword, country, location, language, frequency, hours_old, exclude, results_wanted, last_run 
-		FROM user_searches 
-		WHERE user_id = ?
-		ORDER BY id DESC
-	`, userID)
+	searches, err := a.Searches.ListByUser(r.Context(), userID)
 	if err != nil {
 		http.Error(w, "Failed to fetch searches", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var searches []models.UserSearch
-	for rows.Next() {
-		var s models.UserSearch
-		var location, language, exclude sql.NullString
-		var hoursOld, resultsWanted sql.NullInt64
-		var lastRun sql.NullTime
-
-		err := rows.Scan(&s.ID, &s.Keyword, &s.Country, &location, &language, &s.Frequency, &hoursOld, &exclude, &resultsWanted, &lastRun)
-		if err != nil {
-			continue
-		}
-
-		s.UserID = userID
-		if location.Valid {
-			s.Location = location.String
-		}
-		if language.Valid {
-			s.Language = language.String
-		}
-		if hoursOld.Valid {
-			s.HoursOld = int(hoursOld.Int64)
-		}
-		if exclude.Valid {
-			s.Exclude = exclude.String
-		}
-		if resultsWanted.Valid {
-			s.ResultsWanted = int(resultsWanted.Int64)
-		}
-		if lastRun.Valid {
-			s.LastRun = lastRun.Time
-		}
-
-		searches = append(searches, s)
-	}
-
-	// Return empty array if no searches
-	if searches == nil {
-		searches = []models.UserSearch{}
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(searches)
 }
 
-func createSearchHandler(w http.ResponseWriter, r *http.Request) {
-
-	// 1. Verify Auth Token
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "Missing authorization header", http.StatusUnauthorized)
+func (a *API) createSearchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := principal(w, r)
+	if !ok {
 		return
 	}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return auth.SecretKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	// Check the plan includes alerts at all
+	ent := user.Entitlements
+	if !ent.AllowsAlerts() {
+		http.Error(w, "Your plan doesn't include job alerts. Please upgrade your subscription.", http.StatusForbidden)
 		return
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+	// Parse Request
+	var req models.CreateSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	email, ok := claims["email"].(string)
-	if !ok {
-		http.Error(w, "Invalid token email", http.StatusUnauthorized)
-		return
+	// Default schedule
+	if req.Frequency == "" {
+		req.Frequency = scheduler.DefaultFrequency
 	}
-
-	// Get User ID and Subscription
-	var userID int
-	var subscription string
-	err = db.DB.QueryRow("SELECT id, subscription_plan FROM users WHERE email = ?", email).Scan(&userID, &subscription)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	if req.Timezone == "" {
+		req.Timezone = scheduler.DefaultTimezone
+	}
+	if _, err := scheduler.ParseSchedule(req.Frequency, req.Timezone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Check subscription - only pro users can save alerts
-	if subscription != "pro" {
-		http.Error(w, "This feature requires a Pro subscription", http.StatusForbidden)
+	if interval, _ := scheduler.MinInterval(req.Frequency); interval < ent.MinAlertInterval {
+		http.Error(w, fmt.Sprintf("Your plan allows alerts to run at most %s", ent.MinAlertFrequency), http.StatusForbidden)
 		return
 	}
+	req.ResultsWanted = ent.CapResults(req.ResultsWanted)
 
-	// Parse Request
-	var req models.CreateSearchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	// Reject unknown providers up front rather than failing on every scheduler run
+	if req.Provider != "" {
+		if _, err := search.GetProvider(req.Provider); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Default frequency
-	if req.Frequency == "" {
-		req.Frequency = "hourly"
+	// The first run happens on the next scheduler tick, later ones follow
+	// the alert's schedule.
+	userSearch := models.UserSearch{
+		UserID:        user.ID,
+		Keyword:       req.Keyword,
+		Country:       req.Country,
+		Location:      req.Location,
+		Language:      req.Language,
+		Frequency:     req.Frequency,
+		Timezone:      req.Timezone,
+		HoursOld:      req.HoursOld,
+		Exclude:       req.Exclude,
+		ResultsWanted: req.ResultsWanted,
+		Provider:      req.Provider,
+		NextRunAt:     time.Now().UTC().Truncate(time.Second),
 	}
 
 	// Check if search already exists
-	var existingID int
-	err = db.DB.QueryRow(`
-		SELECT id FROM user_searches 
-		WHERE user_id = ? AND keyword = ? AND country = ? AND location = ? AND language = ? AND hours_old = ? AND exclude = ? AND results_wanted = ?
-	`, userID, req.Keyword, req.Country, req.Location, req.Language, req.HoursOld, req.Exclude, req.ResultsWanted).Scan(&existingID)
-
+	existingID, err := a.Searches.FindDuplicate(r.Context(), userSearch)
 	if err == nil {
 		// Search already exists
 		w.WriteHeader(http.StatusOK)
@@ -210,68 +131,42 @@ func createSearchHandler(w http.ResponseWriter, r *http.Request) {
 			"id":      existingID,
 		})
 		return
-	} else if err != sql.ErrNoRows {
+	} else if !errors.Is(err, repository.ErrNotFound) {
 		// Database error
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	// Insert Search (only if it doesn't exist)
-	_, err = db.DB.Exec(`
-        INSERT INTO user_searches (user_id, keyword, country, location, language, frequency, hours_old, exclude, results_wanted, last_run)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULL)
-    `, userID, req.Keyword, req.Country, req.Location, req.Language, req.Frequency, req.HoursOld, req.Exclude, req.ResultsWanted)
-
+	existing, err := a.Searches.ListByUser(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, "Failed to save search: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Search saved successfully"})
-}
-
-func deleteSearchHandler(w http.ResponseWriter, r *http.Request) {
-	// 1. Verify Auth Token
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "Missing authorization header", http.StatusUnauthorized)
+	if len(existing) >= ent.MaxAlerts {
+		http.Error(w, fmt.Sprintf("Alert limit reached: your plan allows %d alerts", ent.MaxAlerts), http.StatusForbidden)
 		return
 	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return auth.SecretKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	if !a.consume(w, r, user, usage.AlertCreate) {
 		return
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+	// Insert Search (only if it doesn't exist)
+	if err := a.Searches.Create(r.Context(), &userSearch); err != nil {
+		a.refund(r, user, usage.AlertCreate)
+		http.Error(w, "Failed to save search: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	email, ok := claims["email"].(string)
-	if !ok {
-		http.Error(w, "Invalid token email", http.StatusUnauthorized)
-		return
-	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Search saved successfully"})
+}
 
-	// Get User ID
-	var userID int
-	err = db.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+func (a *API) deleteSearchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := principal(w, r)
+	if !ok {
 		return
 	}
+	userID := user.ID
 
 	// Extract search ID from URL path (e.g., /api/searches/123)
 	pathParts := strings.Split(r.URL.Path, "/")
@@ -291,31 +186,49 @@ func deleteSearchHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Delete Alert] User %d attempting to delete search ID: %d", userID, searchID)
 
 	// Delete the search, but only if it belongs to this user
-	result, err := db.DB.Exec("DELETE FROM user_searches WHERE id = ? AND user_id = ?", searchID, userID)
-	if err != nil {
+	err = a.Searches.Delete(r.Context(), userID, searchID)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Printf("[Delete Alert] Search ID %d not found or unauthorized for user %d", searchID, userID)
+		http.Error(w, "Search not found or unauthorized", http.StatusNotFound)
+		return
+	} else if err != nil {
 		log.Printf("[Delete Alert] Error deleting search ID %d: %v", searchID, err)
 		http.Error(w, "Failed to delete search", http.StatusInternalServerError)
 		return
 	}
 
-	// Check if any rows were affected
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Printf("[Delete Alert] Error getting rows affected for search ID %d: %v", searchID, err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	log.Printf("[Delete Alert] Successfully deleted search ID %d for user %d", searchID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Search deleted successfully"})
+}
+
+// resumeSearchHandler runs a search paused by an unsubscribe link again,
+// starting on the next scheduler tick.
+func (a *API) resumeSearchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := principal(w, r)
+	if !ok {
 		return
 	}
 
-	log.Printf("[Delete Alert] Rows affected: %d", rowsAffected)
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/searches/"), "/resume")
+	searchID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid search ID", http.StatusBadRequest)
+		return
+	}
 
-	if rowsAffected == 0 {
-		log.Printf("[Delete Alert] Search ID %d not found or unauthorized for user %d", searchID, userID)
+	err = a.Searches.Resume(r.Context(), user.ID, searchID, time.Now().UTC().Truncate(time.Second))
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "Search not found or unauthorized", http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Printf("[Resume Alert] Error resuming search ID %d: %v", searchID, err)
+		http.Error(w, "Failed to resume search", http.StatusInternalServerError)
+		return
 	}
-
-	log.Printf("[Delete Alert] Successfully deleted search ID %d for user %d", searchID, userID)
+	log.Printf("[Resume Alert] Resumed search ID %d for user %d", searchID, user.ID)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Search deleted successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Search resumed successfully"})
 }
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/models"
+)
+
+const alertBody = `{"keyword": "golang", "country": "Germany", "location": "Berlin"}`
+
+func TestCreateAndListSearches(t *testing.T) {
+	api, store := newTestAPI(t)
+	user := testUser(t, store, "alice@example.com", entitlements.Trial)
+
+	w := serve(api.SaveSearchHandler, user, http.MethodPost, "/api/searches", alertBody)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+
+	// The same parameters again point at the existing alert
+	w = serve(api.SaveSearchHandler, user, http.MethodPost, "/api/searches", alertBody)
+	if w.Code != http.StatusOK {
+		t.Fatalf("duplicate: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(api.SaveSearchHandler, user, http.MethodGet, "/api/searches", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	var searches []models.UserSearch
+	if err := json.NewDecoder(w.Body).Decode(&searches); err != nil {
+		t.Fatal(err)
+	}
+	if len(searches) != 1 {
+		t.Fatalf("got %d searches, want 1", len(searches))
+	}
+	s := searches[0]
+	if s.Keyword != "golang" || s.Frequency != "hourly" || s.Timezone != "UTC" || s.NextRunAt.IsZero() {
+		t.Errorf("unexpected search %+v", s)
+	}
+}
+
+func TestCreateSearchRespectsPlan(t *testing.T) {
+	api, store := newTestAPI(t)
+
+	expired := testUser(t, store, "expired@example.com", entitlements.Expired)
+	if w := serve(api.SaveSearchHandler, expired, http.MethodPost, "/api/searches", alertBody); w.Code != http.StatusForbidden {
+		t.Errorf("plan without alerts: got %d, want 403", w.Code)
+	}
+
+	basic := testUser(t, store, "basic@example.com", entitlements.Basic)
+	body := `{"keyword": "golang", "country": "Germany", "frequency": "hourly"}`
+	if w := serve(api.SaveSearchHandler, basic, http.MethodPost, "/api/searches", body); w.Code != http.StatusForbidden {
+		t.Errorf("frequency above the plan's: got %d, want 403", w.Code)
+	}
+
+	for i := 0; i < entitlements.Plans[entitlements.Basic].MaxAlerts; i++ {
+		body := fmt.Sprintf(`{"keyword": "golang %d", "country": "Germany", "frequency": "daily"}`, i)
+		if w := serve(api.SaveSearchHandler, basic, http.MethodPost, "/api/searches", body); w.Code != http.StatusCreated {
+			t.Fatalf("alert %d: %d %s", i, w.Code, w.Body)
+		}
+	}
+	body = `{"keyword": "one too many", "country": "Germany", "frequency": "daily"}`
+	if w := serve(api.SaveSearchHandler, basic, http.MethodPost, "/api/searches", body); w.Code != http.StatusForbidden {
+		t.Errorf("alert over the plan's limit: got %d, want 403", w.Code)
+	}
+}
+
+func TestCreateSearchDailyQuota(t *testing.T) {
+	api, store := newTestAPI(t)
+	user := testUser(t, store, "alice@example.com", entitlements.Trial)
+
+	// Deleting alerts doesn't give back the day's quota of new ones
+	for i := 0; i < user.Entitlements.AlertsCreatedPerDay; i++ {
+		if w := serve(api.SaveSearchHandler, user, http.MethodPost, "/api/searches", alertBody); w.Code != http.StatusCreated {
+			t.Fatalf("alert %d: %d %s", i, w.Code, w.Body)
+		}
+		if err := store.Searches.DeleteAllForUser(context.Background(), user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := serve(api.SaveSearchHandler, user, http.MethodPost, "/api/searches", alertBody)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+}
+
+func TestDeleteSearch(t *testing.T) {
+	api, store := newTestAPI(t)
+	alice := testUser(t, store, "alice@example.com", entitlements.Trial)
+	bob := testUser(t, store, "bob@example.com", entitlements.Trial)
+
+	s := models.UserSearch{UserID: alice.ID, Keyword: "golang", Country: "Germany"}
+	if err := store.Searches.Create(context.Background(), &s); err != nil {
+		t.Fatal(err)
+	}
+	target := fmt.Sprintf("/api/searches/%d", s.ID)
+
+	if w := serve(api.SaveSearchHandler, bob, http.MethodDelete, target, ""); w.Code != http.StatusNotFound {
+		t.Errorf("deleting another user's alert: got %d, want 404", w.Code)
+	}
+	if w := serve(api.SaveSearchHandler, alice, http.MethodDelete, target, ""); w.Code != http.StatusOK {
+		t.Errorf("deleting own alert: got %d, want 200", w.Code)
+	}
+	if w := serve(api.SaveSearchHandler, alice, http.MethodDelete, target, ""); w.Code != http.StatusNotFound {
+		t.Errorf("deleting it again: got %d, want 404", w.Code)
+	}
+}
+
+func TestResumeSearch(t *testing.T) {
+	api, store := newTestAPI(t)
+	alice := testUser(t, store, "alice@example.com", entitlements.Trial)
+	bob := testUser(t, store, "bob@example.com", entitlements.Trial)
+
+	s := models.UserSearch{UserID: alice.ID, Keyword: "golang", Country: "Germany"}
+	if err := store.Searches.Create(context.Background(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Searches.Pause(context.Background(), alice.ID, s.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	target := fmt.Sprintf("/api/searches/%d/resume", s.ID)
+
+	if w := serve(api.SaveSearchHandler, bob, http.MethodPost, target, ""); w.Code != http.StatusNotFound {
+		t.Errorf("resuming another user's alert: got %d, want 404", w.Code)
+	}
+	if w := serve(api.SaveSearchHandler, alice, http.MethodPost, target, ""); w.Code != http.StatusOK {
+		t.Fatalf("resuming own alert: %d %s", w.Code, w.Body)
+	}
+	if due, err := store.Searches.ListDue(context.Background(), time.Now()); err != nil || len(due) != 1 || due[0].PausedAt != nil {
+		t.Errorf("resumed alert isn't due: %+v, %v", due, err)
+	}
+}
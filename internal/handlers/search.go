@@ -2,13 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
-	"jobseek-web-be/internal/auth"
 	"jobseek-web-be/internal/search"
+	"jobseek-web-be/internal/usage"
 	"log"
 	"net/http"
-	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type SearchRequest struct {
@@ -19,28 +16,17 @@ type SearchRequest struct {
 	ResultsWanted int    `json:"results_wanted"`
 	HoursOld      int    `json:"hours_old"`
 	Exclude       string `json:"exclude"`
+	Provider      string `json:"provider"`
 }
 
-func SearchHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Require authentication for search
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return auth.SecretKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	user, ok := principal(w, r)
+	if !ok {
 		return
 	}
 
@@ -50,6 +36,16 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Larger result sets are a plan feature
+	if req.ResultsWanted <= 0 {
+		req.ResultsWanted = search.DefaultResultsWanted
+	}
+	req.ResultsWanted = user.Entitlements.CapResults(req.ResultsWanted)
+
+	if !a.consume(w, r, user, usage.Search) {
+		return
+	}
+
 	// Map request to service params
 	params := search.SearchParams{
 		Keyword:       req.Keyword,
@@ -59,11 +55,17 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		ResultsWanted: req.ResultsWanted,
 		HoursOld:      req.HoursOld,
 		Exclude:       req.Exclude,
+		Provider:      req.Provider,
 	}
 
-	results, err := search.ExecuteSearch(params)
+	results, err := search.ExecuteSearch(r.Context(), params)
 	if err != nil {
 		log.Printf("Search failed: %v", err)
+		a.refund(r, user, usage.Search)
+		if search.IsCanceled(err) {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -71,3 +73,14 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
 }
+
+// SearchMetricsHandler reports cache and request coalescing counters.
+func SearchMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(search.Stats())
+}
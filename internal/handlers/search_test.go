@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/search"
+	"jobseek-web-be/internal/usage"
+)
+
+// fakeProvider returns canned jobs, or err.
+type fakeProvider struct {
+	name string
+	jobs []models.Job
+	err  error
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Search(ctx context.Context, params search.SearchParams) ([]models.Job, error) {
+	return p.jobs, p.err
+}
+
+// registerProvider installs a fake provider under a name unique to the test.
+func registerProvider(t *testing.T, jobs []models.Job, err error) string {
+	t.Helper()
+	p := &fakeProvider{name: "fake-" + t.Name(), jobs: jobs, err: err}
+	search.RegisterProvider(p)
+	return p.name
+}
+
+// searchesUsed returns how many searches count against the user's quota.
+func searchesUsed(t *testing.T, api *API, userID int) int {
+	t.Helper()
+	reports, err := api.Meter.Usage(context.Background(), userID, entitlements.Plans[entitlements.Trial])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reports {
+		if r.Feature == usage.Search {
+			return r.Used
+		}
+	}
+	t.Fatal("no search usage reported")
+	return 0
+}
+
+func TestSearch(t *testing.T) {
+	api, store := newTestAPI(t)
+	user := testUser(t, store, "alice@example.com", entitlements.Trial)
+	provider := registerProvider(t, []models.Job{{Title: "Gopher", JobURL: "https://jobs.example/1"}}, nil)
+
+	w := serve(api.SearchHandler, user, http.MethodPost, "/api/search", `{"keyword": "golang", "provider": "`+provider+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	var jobs []models.Job
+	if err := json.NewDecoder(w.Body).Decode(&jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Title != "Gopher" {
+		t.Errorf("unexpected results %+v", jobs)
+	}
+	if used := searchesUsed(t, api, user.ID); used != 1 {
+		t.Errorf("%d searches counted, want 1", used)
+	}
+}
+
+func TestSearchFailureIsRefunded(t *testing.T) {
+	api, store := newTestAPI(t)
+	user := testUser(t, store, "alice@example.com", entitlements.Trial)
+	provider := registerProvider(t, nil, errors.New("scraper crashed"))
+
+	w := serve(api.SearchHandler, user, http.MethodPost, "/api/search", `{"keyword": "golang", "provider": "`+provider+`"}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d, want 500", w.Code)
+	}
+	if used := searchesUsed(t, api, user.ID); used != 0 {
+		t.Errorf("%d searches counted after a failure, want 0", used)
+	}
+}
@@ -2,51 +2,68 @@ package handlers
 
 import (
 	"encoding/json"
-	"jobseek-web-be/internal/db"
+	"errors"
+	"jobseek-web-be/internal/repository"
+	"jobseek-web-be/internal/unsubscribe"
 	"log"
 	"net/http"
+	"time"
 )
 
+// UnsubscribeRequest is posted by the unsubscribe page with the token from
+// the email link.
 type UnsubscribeRequest struct {
-	UserID         int  `json:"user_id"`
-	SearchID       *int `json:"search_id"` // Optional
-	UnsubscribeAll bool `json:"unsubscribe_all"`
+	Token string `json:"token"`
 }
 
-func UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+// UnsubscribeHandler pauses the alerts a signed unsubscribe link was sent
+// for: one saved search, or all of the user's for digests. The unsubscribe
+// page posts the token as JSON; mail clients doing an RFC 8058 one-click
+// unsubscribe post a form to the List-Unsubscribe URL, which carries the
+// token in the query string. Since mail clients may do that without the
+// user noticing, the searches are kept and can be resumed.
+func (a *API) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req UnsubscribeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		var req UnsubscribeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+
+	userID, searchID, err := unsubscribe.Parse(token)
+	if err != nil {
+		http.Error(w, "Invalid unsubscribe link", http.StatusBadRequest)
 		return
 	}
 
-	if req.UnsubscribeAll {
-		// Unsubscribe all searches for the user
-		_, err := db.DB.Exec("DELETE FROM user_searches WHERE user_id = ?", req.UserID)
+	now := time.Now().UTC()
+	if searchID == 0 {
+		// Pause all searches for the user
+		err := a.Searches.PauseAllForUser(r.Context(), userID, now)
 		if err != nil {
-			log.Printf("Unsubscribe all failed for user %d: %v", req.UserID, err)
+			log.Printf("Unsubscribe all failed for user %d: %v", userID, err)
 			http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Unsubscribed all searches for user %d", req.UserID)
-	} else if req.SearchID != nil {
-		// Unsubscribe specific search
-		// Verify ownership first for security (simple check)
-		_, err := db.DB.Exec("DELETE FROM user_searches WHERE id = ? AND user_id = ?", *req.SearchID, req.UserID)
-		if err != nil {
-			log.Printf("Unsubscribe search %d failed: %v", *req.SearchID, err)
+		log.Printf("Paused all searches for user %d", userID)
+	} else {
+		// Deleted searches count as unsubscribed, and so do paused ones, so
+		// links can be followed twice
+		err := a.Searches.Pause(r.Context(), userID, searchID, now)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("Unsubscribe search %d failed: %v", searchID, err)
 			http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Unsubscribed search %d for user %d", *req.SearchID, req.UserID)
-	} else {
-		http.Error(w, "Invalid request parameters", http.StatusBadRequest)
-		return
+		log.Printf("Paused search %d for user %d", searchID, userID)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/unsubscribe"
+)
+
+// unsubscribeToken signs a link with a test secret.
+func unsubscribeToken(t *testing.T, userID, searchID int) string {
+	t.Helper()
+	if err := unsubscribe.SetSecrets([]string{strings.Repeat("s", unsubscribe.MinSecretLength)}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := unsubscribe.Token(userID, searchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// oneClick posts an RFC 8058 one-click unsubscribe, as a mail client does.
+func oneClick(api *API, token string) int {
+	target := "/api/unsubscribe?token=" + url.QueryEscape(token)
+	return serve(api.UnsubscribeHandler, nil, http.MethodPost, target, "List-Unsubscribe=One-Click").Code
+}
+
+func TestUnsubscribePausesSearches(t *testing.T) {
+	api, store := newTestAPI(t)
+	ctx := context.Background()
+	alice := testUser(t, store, "alice@example.com", entitlements.Pro)
+	var searches []models.UserSearch
+	for _, keyword := range []string{"golang", "rust", "python"} {
+		s := models.UserSearch{UserID: alice.ID, Keyword: keyword, Country: "Germany"}
+		if err := store.Searches.Create(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+		searches = append(searches, s)
+	}
+	paused := func() map[int]bool {
+		list, err := store.Searches.ListByUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != len(searches) {
+			t.Fatalf("got %d searches, want all %d kept", len(list), len(searches))
+		}
+		m := make(map[int]bool)
+		for _, s := range list {
+			m[s.ID] = s.PausedAt != nil
+		}
+		return m
+	}
+
+	// An alert email's link pauses only its alert
+	if code := oneClick(api, unsubscribeToken(t, alice.ID, searches[0].ID)); code != http.StatusOK {
+		t.Fatalf("one-click unsubscribe: got %d", code)
+	}
+	if p := paused(); !p[searches[0].ID] || p[searches[1].ID] || p[searches[2].ID] {
+		t.Errorf("paused after alert unsubscribe: %v", p)
+	}
+
+	// A digest's link pauses all of them, and nothing is deleted
+	if code := oneClick(api, unsubscribeToken(t, alice.ID, 0)); code != http.StatusOK {
+		t.Fatalf("one-click digest unsubscribe: got %d", code)
+	}
+	for id, p := range paused() {
+		if !p {
+			t.Errorf("search %d not paused after digest unsubscribe", id)
+		}
+	}
+}
+
+func TestUnsubscribeDeletedSearch(t *testing.T) {
+	api, store := newTestAPI(t)
+	alice := testUser(t, store, "alice@example.com", entitlements.Pro)
+	s := models.UserSearch{UserID: alice.ID, Keyword: "golang", Country: "Germany"}
+	if err := store.Searches.Create(context.Background(), &s); err != nil {
+		t.Fatal(err)
+	}
+	token := unsubscribeToken(t, alice.ID, s.ID)
+	if err := store.Searches.Delete(context.Background(), alice.ID, s.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The link of a deleted alert still succeeds, from the page and in one
+	// click, so following it twice doesn't show an error
+	body := `{"token": "` + token + `"}`
+	if w := serve(api.UnsubscribeHandler, nil, http.MethodPost, "/api/unsubscribe", body); w.Code != http.StatusOK {
+		t.Errorf("unsubscribe page: got %d %s", w.Code, w.Body)
+	}
+	if code := oneClick(api, token); code != http.StatusOK {
+		t.Errorf("one-click: got %d", code)
+	}
+}
+
+func TestUnsubscribeRejectsInvalidTokens(t *testing.T) {
+	api, store := newTestAPI(t)
+	alice := testUser(t, store, "alice@example.com", entitlements.Pro)
+	s := models.UserSearch{UserID: alice.ID, Keyword: "golang", Country: "Germany"}
+	if err := store.Searches.Create(context.Background(), &s); err != nil {
+		t.Fatal(err)
+	}
+	token := unsubscribeToken(t, alice.ID, s.ID)
+
+	for name, bad := range map[string]string{
+		"missing":      "",
+		"other search": strings.Replace(token, ".", ".9", 1),
+		"malformed":    "not-a-token",
+	} {
+		if code := oneClick(api, bad); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", name, code)
+		}
+	}
+	if w := serve(api.UnsubscribeHandler, nil, http.MethodGet, "/api/unsubscribe?token="+url.QueryEscape(token), ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d, want 405", w.Code)
+	}
+	if list, err := store.Searches.ListByUser(context.Background(), alice.ID); err != nil || len(list) != 1 || list[0].PausedAt != nil {
+		t.Errorf("search changed by invalid requests: %+v, %v", list, err)
+	}
+}
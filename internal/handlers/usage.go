@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// UsageHandler reports the user's usage and remaining allowance of every
+// metered feature.
+func (a *API) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	reports, err := a.Meter.Usage(r.Context(), user.ID, user.Entitlements)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tier":     user.Entitlements.Tier,
+		"features": reports,
+	})
+}
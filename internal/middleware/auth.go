@@ -2,52 +2,137 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"jobseek-web-be/internal/auth"
-
-	"github.com/golang-jwt/jwt/v5"
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
 )
 
+// Principal is the authenticated user a request acts for. It's loaded from
+// the database on every request, so plan changes apply without a new token.
+type Principal struct {
+	ID            int
+	Email         string
+	Name          string
+	Plan          string
+	Paid          bool
+	TrialEndsAt   time.Time
+	EmailVerified bool
+
+	// Token is the bearer token the request was authenticated with, or nil
+	// for API keys.
+	Token *auth.Token
+	// APIKey is the API key the request was authenticated with, or nil for
+	// access tokens.
+	APIKey *models.APIKey
+
+	// Entitlements are resolved from the fields above when the request starts.
+	Entitlements entitlements.Entitlements
+}
+
 type contextKey string
 
-const UserKey contextKey = "user"
+const principalKey contextKey = "principal"
 
-func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFrom returns the principal stored by Auth, if any.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// ReadWrite sends GET and HEAD requests to read and every other method to
+// write, so a route's reads and writes can require different scopes.
+func ReadWrite(read, write http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "authorization header required", http.StatusUnauthorized)
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			read(w, r)
 			return
 		}
+		write(w, r)
+	}
+}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "invalid authorization header format", http.StatusUnauthorized)
-			return
-		}
+// Auth returns middleware that requires a valid, unrevoked bearer token,
+// loads the token's user and stores it in the request context as a
+// *Principal. API keys are accepted in place of the token only on routes
+// wrapped with scopes, and only if the key has all of them.
+func Auth(tokens *auth.Service) func(next http.HandlerFunc, scopes ...string) http.HandlerFunc {
+	return func(next http.HandlerFunc, scopes ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Missing authorization header", http.StatusUnauthorized)
+				return
+			}
 
-		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, http.ErrAbortHandler
+			tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+			if !ok {
+				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+				return
 			}
-			return auth.SecretKey, nil
-		})
 
-		if err != nil || !token.Valid {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
-			return
-		}
+			var user *models.User
+			var token *auth.Token
+			var key *models.APIKey
+			var err error
+			if auth.IsAPIKey(tokenString) {
+				if len(scopes) == 0 {
+					http.Error(w, "API keys can't be used for this endpoint", http.StatusForbidden)
+					return
+				}
+				user, key, err = tokens.AuthenticateAPIKey(r.Context(), tokenString)
+			} else {
+				user, token, err = tokens.Authenticate(r.Context(), tokenString)
+			}
+			switch {
+			case errors.Is(err, auth.ErrInvalidToken):
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			case errors.Is(err, auth.ErrTokenRevoked):
+				http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+				return
+			case errors.Is(err, repository.ErrNotFound):
+				http.Error(w, "User not found", http.StatusUnauthorized)
+				return
+			case err != nil:
+				log.Printf("[Auth] Failed to authenticate request: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if key != nil {
+				for _, scope := range scopes {
+					if !slices.Contains(key.Scopes, scope) {
+						http.Error(w, "API key is missing the "+scope+" scope", http.StatusForbidden)
+						return
+					}
+				}
+			}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "invalid token claims", http.StatusUnauthorized)
-			return
+			principal := &Principal{
+				ID:            user.ID,
+				Email:         user.Email,
+				Name:          user.Name,
+				Plan:          user.SubscriptionPlan,
+				Paid:          user.Paid,
+				TrialEndsAt:   auth.TrialEnd(user.CreatedAt),
+				EmailVerified: user.EmailVerifiedAt != nil,
+				Token:         token,
+				APIKey:        key,
+			}
+			principal.Entitlements = entitlements.For(principal.Plan, principal.Paid, principal.TrialEndsAt)
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
 		}
-
-		ctx := context.WithValue(r.Context(), UserKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
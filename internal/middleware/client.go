@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// trustedHops is how many reverse proxies in front of the server append to
+// X-Forwarded-For, from TRUST_PROXY: "true" for one, or a count. Only set it
+// behind proxies that do, or clients can spoof their address.
+var trustedHops = parseTrustProxy(os.Getenv("TRUST_PROXY"))
+
+func parseTrustProxy(v string) int {
+	if v == "true" {
+		return 1
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// ClientIP returns the address the request came from. Behind trusted
+// proxies that's the X-Forwarded-For entry appended by the outermost of
+// them; anything further left was written by the client and can be forged.
+func ClientIP(r *http.Request) string {
+	if trustedHops > 0 {
+		var entries []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(header, ",") {
+				if entry = strings.TrimSpace(entry); entry != "" {
+					entries = append(entries, entry)
+				}
+			}
+		}
+		if len(entries) > 0 {
+			return entries[max(len(entries)-trustedHops, 0)]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
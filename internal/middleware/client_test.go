@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		hops int
+		xff  []string
+		want string
+	}{
+		{"no proxy ignores the header", 0, []string{"203.0.113.9"}, "192.0.2.1"},
+		{"one proxy", 1, []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed prefix", 1, []string{"203.0.113.9, 198.51.100.7"}, "198.51.100.7"},
+		{"spoofed header before the proxy's", 1, []string{"203.0.113.9", "198.51.100.7"}, "198.51.100.7"},
+		{"two proxies", 2, []string{"203.0.113.9, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"fewer entries than proxies", 2, []string{"198.51.100.7"}, "198.51.100.7"},
+		{"header missing", 1, nil, "192.0.2.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := trustedHops
+			trustedHops = tc.hops
+			t.Cleanup(func() { trustedHops = prev })
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "192.0.2.1:4321"
+			for _, v := range tc.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(r); got != tc.want {
+				t.Errorf("ClientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustProxy(t *testing.T) {
+	for v, want := range map[string]int{"": 0, "false": 0, "true": 1, "2": 2, "-1": 0, "yes": 0} {
+		if got := parseTrustProxy(v); got != want {
+			t.Errorf("parseTrustProxy(%q) = %d, want %d", v, got, want)
+		}
+	}
+}
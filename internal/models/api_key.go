@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// APIKey is a personal key for scripts. Only the hash of the secret is
+// stored; the prefix identifies the key in listings and logs.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedAPIKey is the response to creating a key, the only time the full
+// key is shown.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
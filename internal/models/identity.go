@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Identity links a user to their account at an OpenID Connect provider.
+type Identity struct {
+	ID          int
+	UserID      int
+	Provider    string // configured provider name, e.g. "google"
+	Subject     string // the provider's stable user ID (sub claim)
+	Email       string // as last reported by the provider
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type OIDCExchangeRequest struct {
+	LoginToken string `json:"login_token"`
+	Device     string `json:"device"`
+}
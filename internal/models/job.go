@@ -0,0 +1,33 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Job is a single posting returned by a search provider.
+type Job struct {
+	Site        string `json:"site"`
+	Title       string `json:"title"`
+	Company     string `json:"company"`
+	Location    string `json:"location"`
+	DatePosted  string `json:"date_posted"`
+	JobURL      string `json:"job_url"`
+	JobLevel    string `json:"job_level"`
+	Description string `json:"description,omitempty"`
+	Salary      string `json:"salary,omitempty"`
+}
+
+// Validate reports whether the job can be delivered to users. The job URL is
+// the identity used for duplicate tracking, so it must be an absolute http(s) URL.
+func (j Job) Validate() error {
+	if j.JobURL == "" {
+		return errors.New("missing job_url")
+	}
+	u, err := url.Parse(j.JobURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid job_url %q", j.JobURL)
+	}
+	return nil
+}
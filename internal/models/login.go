@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// LoginFailure counts recent failed logins from one IP or for one account.
+type LoginFailure struct {
+	Scope         string // "ip" or "account"
+	Subject       string // the IP address or normalized email
+	Failures      int
+	FirstFailedAt time.Time
+	LastFailedAt  time.Time
+	LockedUntil   *time.Time
+}
+
+// Lockout is the audit record of an IP or account being locked out.
+type Lockout struct {
+	ID          int        `json:"id"`
+	Scope       string     `json:"scope"`
+	Subject     string     `json:"subject"`
+	UserID      int        `json:"user_id,omitempty"` // 0 for IPs and unknown accounts
+	IP          string     `json:"ip"`                // address of the attempt that caused it
+	Failures    int        `json:"failures"`
+	LockedAt    time.Time  `json:"locked_at"`
+	LockedUntil time.Time  `json:"locked_until"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+	UnlockedBy  string     `json:"unlocked_by,omitempty"` // "email", "password_reset" or "support"
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// MFA is a user's TOTP enrollment. It's pending until the first code is
+// verified, and only enforced at login once EnabledAt is set.
+type MFA struct {
+	UserID      int
+	Secret      string // base32
+	CreatedAt   time.Time
+	EnabledAt   *time.Time
+	LastCounter int64 // time step of the last accepted code, so codes can't be replayed
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth:// provisioning URI, usually shown as a QR code
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"` // authenticator code or recovery code
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // authenticator code or recovery code
+	Device   string `json:"device"`
+}
+
+// MFAChallenge is the login response for accounts with 2FA, to be exchanged
+// for tokens at /api/auth/mfa/verify.
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
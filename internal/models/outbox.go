@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Outbox message statuses
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// OutboxMessage is an email queued for delivery, as stored. The payload is
+// kept as JSON so a retry sends exactly what the first attempt would have.
+type OutboxMessage struct {
+	ID            int
+	UserID        int
+	SearchID      int // 0 for digests
+	Kind          string
+	ToEmail       string
+	UserName      string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	// Matches are the jobs the message delivers, written when it's queued
+	// and moved to sent_jobs once it's delivered. Listings leave them out.
+	Matches []JobMatch
+}
+
+// JobMatch ties a job to the alert that found it.
+type JobMatch struct {
+	SearchID int    `json:"search_id"`
+	JobURL   string `json:"job_url"`
+}
+
+// DigestItem is a job held for its owner's next digest.
+type DigestItem struct {
+	ID        int
+	UserID    int
+	SearchID  int
+	JobURL    string
+	Job       string // the job as JSON
+	CreatedAt time.Time
+}
@@ -3,17 +3,21 @@ package models
 import "time"
 
 type UserSearch struct {
-	ID            int       `json:"id"`
-	UserID        int       `json:"user_id"`
-	Keyword       string    `json:"keyword"`
-	Country       string    `json:"country"`
-	Location      string    `json:"location"`
-	Language      string    `json:"language"`
-	Frequency     string    `json:"frequency"`
-	HoursOld      int       `json:"hours_old"`
-	Exclude       string    `json:"exclude"`
-	ResultsWanted int       `json:"results_wanted"`
-	LastRun       time.Time `json:"last_run"`
+	ID            int        `json:"id"`
+	UserID        int        `json:"user_id"`
+	Keyword       string     `json:"keyword"`
+	Country       string     `json:"country"`
+	Location      string     `json:"location"`
+	Language      string     `json:"language"`
+	Frequency     string     `json:"frequency"`
+	Timezone      string     `json:"timezone"`
+	HoursOld      int        `json:"hours_old"`
+	Exclude       string     `json:"exclude"`
+	ResultsWanted int        `json:"results_wanted"`
+	Provider      string     `json:"provider"`
+	LastRun       time.Time  `json:"last_run"`
+	NextRunAt     time.Time  `json:"next_run_at"`
+	PausedAt      *time.Time `json:"paused_at"` // set by an unsubscribe link until the user resumes the alert
 }
 
 type CreateSearchRequest struct {
@@ -21,8 +25,10 @@ type CreateSearchRequest struct {
 	Country       string `json:"country"`
 	Location      string `json:"location"`
 	Language      string `json:"language"`
-	Frequency     string `json:"frequency"` // optional, default hourly
+	Frequency     string `json:"frequency"` // optional, preset or cron expression, default hourly
+	Timezone      string `json:"timezone"`  // optional, IANA name, default UTC
 	HoursOld      int    `json:"hours_old"`
 	Exclude       string `json:"exclude"`
 	ResultsWanted int    `json:"results_wanted"`
+	Provider      string `json:"provider"` // optional, default provider
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Session is a login on one device. It's kept alive by rotating its refresh
+// token, of which only the current one's hash is stored.
+type Session struct {
+	ID            int        `json:"id"`
+	UserID        int        `json:"-"`
+	TokenHash     string     `json:"-"`
+	Device        string     `json:"device"`
+	UserAgent     string     `json:"user_agent"`
+	IP            string     `json:"ip"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"-"`
+	RevokedReason string     `json:"-"`
+	Current       bool       `json:"current"` // the session the listing request was made from
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
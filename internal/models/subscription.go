@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Subscription mirrors a billing provider subscription. Its status decides
+// whether the owner counts as paid.
+type Subscription struct {
+	ID                string    `json:"id"`
+	UserID            int       `json:"user_id"`
+	CustomerID        string    `json:"customer_id"`
+	Plan              string    `json:"plan"`
+	Status            string    `json:"status"`
+	CurrentPeriodEnd  time.Time `json:"current_period_end"`
+	CancelAtPeriodEnd bool      `json:"cancel_at_period_end"`
+	EventAt           time.Time `json:"-"` // creation time of the event it was last updated from
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type CheckoutRequest struct {
+	Plan string `json:"plan"` // "basic" or "pro"
+}
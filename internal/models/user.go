@@ -3,30 +3,54 @@ package models
 import "time"
 
 type User struct {
-	ID               int       `json:"id"`
-	Name             string    `json:"name"`
-	Email            string    `json:"email"`
-	Password         string    `json:"password"`
-	SubscriptionPlan string    `json:"subscription_plan"`
-	CreatedAt        time.Time `json:"created_at"`
+	ID               int        `json:"id"`
+	Name             string     `json:"name"`
+	Email            string     `json:"email"`
+	Password         string     `json:"password"`
+	SubscriptionPlan string     `json:"subscription_plan"`
+	Paid             bool       `json:"paid"`
+	DigestFrequency  string     `json:"digest_frequency"`
+	TokenVersion     int        `json:"-"`                 // bumped to invalidate every issued token
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"` // nil until the address is confirmed
+	CreatedAt        time.Time  `json:"created_at"`
 }
 
 type Credentials struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Device   string `json:"device"` // optional label for the session, e.g. "Work laptop"
 }
 
 type RegisterRequest struct {
 	Name         string `json:"name"`
 	Email        string `json:"email"`
 	Password     string `json:"password"`
-	Subscription string `json:"subscription"`  // "basic" or "pro"
-	PaymentToken string `json:"payment_token"` // Mock token
+	Subscription string `json:"subscription"` // "basic" or "pro", paid for via checkout
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 type AuthResponse struct {
 	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until Token expires
 	Subscription string `json:"subscription"`
 	Name         string `json:"name"`
 	Email        string `json:"email"`
 }
+
+type DigestSettings struct {
+	Digest string `json:"digest"` // "off", "daily" or "weekly"
+}
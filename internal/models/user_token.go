@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserToken records a single-use token emailed to a user, such as an email
+// verification link. The token itself is signed; this row makes it
+// single-use.
+type UserToken struct {
+	ID        string // SHA-256 of the token's jti
+	UserID    int
+	Purpose   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
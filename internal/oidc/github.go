@@ -0,0 +1,75 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// GitHub doesn't offer OpenID Connect for user logins, only OAuth 2.0. Its
+// endpoints are fixed rather than discovered, and there is no ID token: the
+// user is looked up with the access token instead. The profile's email field
+// is just what the user chose to show publicly, so the address and whether
+// it's verified come from the list of the user's emails.
+const githubIssuer = "https://github.com"
+
+// githubScopes let the access token read the profile and email addresses.
+var githubScopes = []string{"read:user", "user:email"}
+
+// githubAPI is the REST API of a GitHub instance: api.github.com for
+// github.com, /api/v3 on GitHub Enterprise Server.
+func githubAPI(issuer string) string {
+	if issuer == githubIssuer {
+		return "https://api.github.com"
+	}
+	return issuer + "/api/v3"
+}
+
+func githubMetadata(issuer string) *metadata {
+	return &metadata{
+		Issuer:                issuer,
+		AuthorizationEndpoint: issuer + "/login/oauth/authorize",
+		TokenEndpoint:         issuer + "/login/oauth/access_token",
+	}
+}
+
+// githubUser returns the claims of the user the access token was issued to.
+// The subject is the numeric user ID, which unlike the login never changes.
+func (p *Provider) githubUser(ctx context.Context, accessToken string) (*Claims, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := p.getAuthorizedJSON(ctx, p.userAPI+"/user", accessToken, &user); err != nil {
+		return nil, fmt.Errorf("fetching %s user: %w", p.Name, err)
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%s returned no user ID", p.Name)
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.getAuthorizedJSON(ctx, p.userAPI+"/user/emails", accessToken, &emails); err != nil {
+		return nil, fmt.Errorf("fetching %s emails: %w", p.Name, err)
+	}
+
+	c := &Claims{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Name:    user.Name,
+	}
+	if c.Name == "" {
+		c.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			c.Email = e.Email
+			c.EmailVerified = e.Verified
+			break
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeGitHub serves the OAuth and REST endpoints a GitHub login uses, the
+// REST API under /api/v3 like GitHub Enterprise Server.
+type fakeGitHub struct {
+	emails     string // JSON response of /user/emails
+	tokenError string // reported with 200 OK, like GitHub does
+}
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/login/oauth/access_token":
+		r.ParseForm()
+		if g.tokenError != "" {
+			json.NewEncoder(w).Encode(map[string]string{"error": g.tokenError})
+			return
+		}
+		if r.PostForm.Get("code") != "the-code" || r.PostForm.Get("code_verifier") != "the-verifier" ||
+			r.PostForm.Get("client_secret") != "gh-secret" {
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gho_token", "token_type": "bearer"})
+	case "/api/v3/user", "/api/v3/user/emails":
+		if r.Header.Get("Authorization") != "Bearer gho_token" {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/api/v3/user" {
+			w.Write([]byte(`{"id": 583231, "login": "octocat", "name": "", "email": "public@example.com"}`))
+		} else {
+			w.Write([]byte(g.emails))
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newGitHub configures a github provider against a fake GitHub instance.
+func newGitHub(t *testing.T, g *fakeGitHub) *Provider {
+	t.Helper()
+	srv := httptest.NewServer(g)
+	t.Cleanup(srv.Close)
+	t.Setenv("APP_DOMAIN", "https://app.example")
+	t.Setenv("OIDC_PROVIDERS", "github")
+	t.Setenv("OIDC_GITHUB_ISSUER", srv.URL)
+	t.Setenv("OIDC_GITHUB_CLIENT_ID", "gh-client")
+	t.Setenv("OIDC_GITHUB_CLIENT_SECRET", "gh-secret")
+	p, err := ConfigFromEnv().Get("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestGitHubConfig(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "github")
+	t.Setenv("OIDC_GITHUB_CLIENT_ID", "gh-client")
+	t.Setenv("OIDC_GITHUB_CLIENT_SECRET", "gh-secret")
+	p, err := ConfigFromEnv().Get("github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Issuer != "https://github.com" || p.userAPI != "https://api.github.com" {
+		t.Errorf("github configured with issuer %q and API %q", p.Issuer, p.userAPI)
+	}
+
+	authURL, err := p.AuthURL(context.Background(), "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Host != "github.com" || u.Path != "/login/oauth/authorize" {
+		t.Errorf("AuthURL = %s, want GitHub's authorize endpoint", authURL)
+	}
+	if q.Get("client_id") != "gh-client" || q.Get("state") != "the-state" || q.Get("scope") != "read:user user:email" ||
+		q.Get("code_challenge") != "the-challenge" || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("AuthURL query = %v", q)
+	}
+}
+
+func TestGitHubExchange(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		emails   string
+		email    string
+		verified bool
+	}{
+		{
+			name:     "verified primary",
+			emails:   `[{"email": "other@example.com", "primary": false, "verified": true}, {"email": "octocat@example.com", "primary": true, "verified": true}]`,
+			email:    "octocat@example.com",
+			verified: true,
+		},
+		{
+			name:   "unverified primary",
+			emails: `[{"email": "other@example.com", "primary": false, "verified": true}, {"email": "octocat@example.com", "primary": true, "verified": false}]`,
+			email:  "octocat@example.com",
+		},
+		{
+			name:   "no emails",
+			emails: `[]`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newGitHub(t, &fakeGitHub{emails: tc.emails})
+			c, err := p.Exchange(context.Background(), "the-code", "the-verifier", "the-nonce")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The public profile email is never used
+			if c.Subject != "583231" || c.Name != "octocat" || c.Email != tc.email || c.EmailVerified != tc.verified {
+				t.Errorf("claims = %+v, want %s verified=%v", c, tc.email, tc.verified)
+			}
+		})
+	}
+}
+
+func TestGitHubExchangeErrors(t *testing.T) {
+	p := newGitHub(t, &fakeGitHub{tokenError: "bad_verification_code"})
+	if c, err := p.Exchange(context.Background(), "the-code", "the-verifier", ""); err == nil || !strings.Contains(err.Error(), "bad_verification_code") {
+		t.Errorf("Exchange with a rejected code = %+v, %v", c, err)
+	}
+
+	p = newGitHub(t, &fakeGitHub{emails: `[]`})
+	if c, err := p.Exchange(context.Background(), "the-code", "wrong-verifier", ""); err == nil {
+		t.Errorf("Exchange with the wrong verifier = %+v", c)
+	}
+}
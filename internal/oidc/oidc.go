@@ -0,0 +1,409 @@
+// Package oidc signs users in through OpenID Connect providers with the
+// authorization code flow and PKCE. Each provider's endpoints and signing
+// keys are discovered from its issuer on first use, and ID tokens are checked
+// against them before any claim is trusted. GitHub, which only offers plain
+// OAuth 2.0, is supported through its REST API instead (see github.go).
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Leeway is the clock skew tolerated when checking ID token times.
+const Leeway = time.Minute
+
+// keyRefreshInterval limits how often the signing keys are refetched when a
+// token names a key we don't know.
+const keyRefreshInterval = time.Minute
+
+// DefaultScopes are requested unless OIDC_<NAME>_SCOPES overrides them.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// knownIssuers lets well-known providers be configured with just a client.
+var knownIssuers = map[string]string{
+	"google":   "https://accounts.google.com",
+	"linkedin": "https://www.linkedin.com/oauth",
+	"github":   githubIssuer,
+}
+
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrInvalidIDToken  = errors.New("invalid ID token")
+)
+
+// Provider is a configured OpenID Connect provider, or GitHub.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// userAPI is the REST API the identity is fetched from for providers
+	// without ID tokens; only GitHub
+	userAPI string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// metadata is the part of the discovery document we use.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the verified ID token claims a login relies on.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	// CallbackPage is the frontend page a finished login is handed to.
+	CallbackPage string
+	providers    map[string]*Provider
+}
+
+// ConfigFromEnv reads the providers listed in OIDC_PROVIDERS (comma
+// separated names). Each needs OIDC_<NAME>_CLIENT_ID and
+// OIDC_<NAME>_CLIENT_SECRET, and OIDC_<NAME>_ISSUER unless it's a provider we
+// know. Provider callbacks and the frontend's callback page are under
+// APP_DOMAIN. Misconfigured providers are logged and left out.
+func ConfigFromEnv() *Registry {
+	domain := strings.TrimRight(os.Getenv("APP_DOMAIN"), "/")
+	if domain == "" {
+		domain = "http://localhost:8080"
+	}
+
+	reg := &Registry{
+		CallbackPage: domain + "/oauth/callback",
+		providers:    make(map[string]*Provider),
+	}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p := &Provider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  domain + "/api/auth/oidc/" + name + "/callback",
+			Scopes:       DefaultScopes,
+			client:       &http.Client{Timeout: 10 * time.Second},
+		}
+		if p.Issuer == "" {
+			p.Issuer = knownIssuers[name]
+		}
+		p.Issuer = strings.TrimRight(p.Issuer, "/")
+		if name == "github" {
+			p.userAPI = githubAPI(p.Issuer)
+			p.Scopes = githubScopes
+		}
+		if scopes := strings.Fields(os.Getenv(prefix + "SCOPES")); len(scopes) > 0 {
+			p.Scopes = scopes
+		}
+		if p.Issuer == "" || p.ClientID == "" || p.ClientSecret == "" {
+			log.Printf("[Auth] Skipping login provider %q: set %sCLIENT_ID, %sCLIENT_SECRET and, unless it is google, linkedin or github, %sISSUER", name, prefix, prefix, prefix)
+			continue
+		}
+		reg.providers[name] = p
+	}
+	return reg
+}
+
+// Get returns the named provider, or ErrUnknownProvider.
+func (r *Registry) Get(name string) (*Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Names lists the configured providers, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthURL is where the user is sent to sign in. state and nonce are echoed
+// back in the callback and the ID token, and challenge is the PKCE S256
+// challenge of the verifier later passed to Exchange.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the
+// verified ID token, which must carry nonce. For GitHub they come from its
+// API instead.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("redeeming code at %s: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding %s token response: %w", p.Name, err)
+	}
+	// GitHub reports errors with 200 OK
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("redeeming code at %s: %s: %s %s", p.Name, resp.Status, body.Error, body.ErrorDescription)
+	}
+	if p.userAPI != "" {
+		if body.AccessToken == "" {
+			return nil, fmt.Errorf("%s returned no access token", p.Name)
+		}
+		return p.githubUser(ctx, body.AccessToken)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%s returned no ID token", p.Name)
+	}
+	return p.verify(ctx, body.IDToken, nonce)
+}
+
+// verify checks an ID token's signature, issuer, audience, expiry and nonce.
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	token, err := jwt.Parse(idToken, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(Leeway),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+
+	// Google also issues tokens with its issuer minus the scheme
+	iss, _ := claims["iss"].(string)
+	if iss != p.Issuer && "https://"+iss != p.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, iss)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	c := &Claims{}
+	c.Subject, _ = claims["sub"].(string)
+	c.Email, _ = claims["email"].(string)
+	c.Name, _ = claims["name"].(string)
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	// Some providers send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		c.EmailVerified = v == "true"
+	}
+	return c, nil
+}
+
+// discover fetches and caches the provider's discovery document.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	if p.userAPI != "" {
+		p.meta = githubMetadata(p.Issuer)
+		return p.meta, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.Name, err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovering %s: document is for issuer %q", p.Name, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: incomplete document", p.Name)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the provider's public key with the ID, refetching the key set
+// if it's unknown, e.g. after the provider rotated its keys.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching %s keys: %w", p.Name, err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	return p.getAuthorizedJSON(ctx, url, "", v)
+}
+
+// getAuthorizedJSON fetches url with accessToken as a bearer token, if set.
+func (p *Provider) getAuthorizedJSON(ctx context.Context, url, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// RandomString returns a URL-safe random string for states, nonces and PKCE
+// verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge is the PKCE S256 challenge for verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,168 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"jobseek-web-be/internal/email"
+	"jobseek-web-be/internal/repository"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultBaseDelay   = time.Minute
+	DefaultMaxDelay    = 6 * time.Hour
+
+	// claimLease keeps other dispatchers away from a message while it is
+	// being sent. If the process dies mid-send the message is retried after it.
+	claimLease = 5 * time.Minute
+	batchSize  = 50
+)
+
+// Dispatcher delivers due outbox messages, retrying failures with
+// exponential backoff and dead-lettering them after MaxAttempts.
+type Dispatcher struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	messages repository.OutboxRepository
+	// send delivers a message; tests replace it to simulate failures
+	send func(Message) error
+}
+
+// NewDispatcher returns a dispatcher for the messages, configured from
+// OUTBOX_MAX_ATTEMPTS and falling back to the defaults.
+func NewDispatcher(messages repository.OutboxRepository) *Dispatcher {
+	d := &Dispatcher{
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+		messages:    messages,
+		send:        deliver,
+	}
+	if v := os.Getenv("OUTBOX_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			d.MaxAttempts = n
+		} else {
+			log.Printf("[Outbox] Ignoring invalid OUTBOX_MAX_ATTEMPTS=%q", v)
+		}
+	}
+	return d
+}
+
+// Backoff returns the delay before the next attempt after the given number
+// of failed attempts: BaseDelay, 2x, 4x, ... capped at MaxDelay.
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
+
+// DispatchDue sends every pending message whose next attempt is due.
+func (d *Dispatcher) DispatchDue(ctx context.Context) {
+	msgs, err := d.dueMessages(ctx)
+	if err != nil {
+		log.Printf("[Outbox] Error fetching due messages: %v", err)
+		return
+	}
+
+	// Bookkeeping must still happen if dispatching is cancelled mid-send
+	bg := context.WithoutCancel(ctx)
+
+	var sent, failed, dead int
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		claimed, err := d.messages.Claim(bg, msg.ID, msg.Attempts, time.Now().UTC().Add(claimLease))
+		if err != nil {
+			log.Printf("[Outbox] Error claiming message %d: %v", msg.ID, err)
+			continue
+		}
+		if !claimed {
+			continue // another dispatcher got it
+		}
+		msg.Attempts++
+
+		if err := d.send(msg); err != nil {
+			if msg.Attempts >= d.MaxAttempts {
+				dead++
+				log.Printf("[Outbox] Message %d to %s dead-lettered after %d attempts: %v", msg.ID, msg.ToEmail, msg.Attempts, err)
+				d.recordFailure(bg, msg, StatusDead, err)
+			} else {
+				failed++
+				log.Printf("[Outbox] Message %d to %s failed (attempt %d/%d): %v", msg.ID, msg.ToEmail, msg.Attempts, d.MaxAttempts, err)
+				d.recordFailure(bg, msg, StatusPending, err)
+			}
+			continue
+		}
+
+		// This is the only place sent_jobs is written, so jobs count as
+		// sent only once delivered
+		if err := d.messages.MarkDelivered(bg, msg.ID, time.Now().UTC()); err != nil {
+			log.Printf("[Outbox] Message %d delivered but not recorded: %v", msg.ID, err)
+			continue
+		}
+		sent++
+	}
+
+	if len(msgs) > 0 {
+		log.Printf("[Outbox] Dispatch finished: %d sent, %d retrying, %d dead-lettered", sent, failed, dead)
+	}
+}
+
+func (d *Dispatcher) dueMessages(ctx context.Context) ([]Message, error) {
+	recs, err := d.messages.ListDue(ctx, time.Now().UTC(), batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []Message
+	for _, rec := range recs {
+		msg, err := decode(rec)
+		if err != nil {
+			// Retrying can't fix it, and left pending it would be listed
+			// first on every run, crowding out deliverable messages
+			log.Printf("[Outbox] Message %d dead-lettered, its payload is corrupt: %v", rec.ID, err)
+			if err := d.messages.RecordFailure(ctx, rec.ID, StatusDead, rec.NextAttemptAt, "corrupt payload: "+err.Error()); err != nil {
+				log.Printf("[Outbox] Error recording failure for message %d: %v", rec.ID, err)
+			}
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func deliver(msg Message) error {
+	switch msg.Kind {
+	case KindAlert:
+		return email.SendJobAlert(msg.ToEmail, msg.UserName, msg.UserID, msg.SearchID, msg.Payload.Jobs)
+	case KindDigest:
+		return email.SendDigest(msg.ToEmail, msg.UserName, msg.UserID, msg.Payload.Period, msg.Payload.Groups)
+	default:
+		return fmt.Errorf("unknown message kind %q", msg.Kind)
+	}
+}
+
+// recordFailure stores the error and schedules the next attempt. Dead
+// messages keep their outbox_jobs rows so the same jobs aren't queued again
+// until an operator requeues or discards them.
+func (d *Dispatcher) recordFailure(ctx context.Context, msg Message, status string, sendErr error) {
+	next := time.Now().UTC().Add(d.Backoff(msg.Attempts))
+	if err := d.messages.RecordFailure(ctx, msg.ID, status, next, sendErr.Error()); err != nil {
+		log.Printf("[Outbox] Error recording failure for message %d: %v", msg.ID, err)
+	}
+}
@@ -0,0 +1,199 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// newTestDispatcher returns a dispatcher over an in-memory store whose sends
+// are recorded and fail with the errors in fail, in turn.
+func newTestDispatcher(store *repository.Store, fail ...error) (*Dispatcher, *[]Message) {
+	d := NewDispatcher(store.Outbox)
+	var sent []Message
+	d.send = func(msg Message) error {
+		sent = append(sent, msg)
+		if len(fail) > 0 {
+			err := fail[0]
+			fail = fail[1:]
+			return err
+		}
+		return nil
+	}
+	return d, &sent
+}
+
+// queueAlert stores a user, an alert and a pending message for it.
+func queueAlert(t *testing.T, store *repository.Store, urls ...string) (models.UserSearch, models.OutboxMessage) {
+	t.Helper()
+	ctx := context.Background()
+	u := models.User{Name: "Alice", Email: "alice@example.com"}
+	if err := store.Users.Create(ctx, &u); err != nil {
+		t.Fatal(err)
+	}
+	s := models.UserSearch{UserID: u.ID, Keyword: "golang", Country: "Germany"}
+	if err := store.Searches.Create(ctx, &s); err != nil {
+		t.Fatal(err)
+	}
+	var jobs []models.Job
+	for _, url := range urls {
+		jobs = append(jobs, models.Job{Title: "Engineer", JobURL: url})
+	}
+	if err := Enqueue(ctx, store.Outbox, Alert(u.ID, s.ID, u.Email, u.Name, jobs)); err != nil {
+		t.Fatal(err)
+	}
+	return s, message(t, store)
+}
+
+// message returns the only stored message.
+func message(t *testing.T, store *repository.Store) models.OutboxMessage {
+	t.Helper()
+	msgs := store.Outbox.(*repository.MemoryOutboxRepository).Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	return msgs[0]
+}
+
+func TestDispatchDueMarksDelivered(t *testing.T) {
+	store := repository.NewMemoryStore()
+	d, sent := newTestDispatcher(store)
+	s, _ := queueAlert(t, store, "https://jobs.example/1", "https://jobs.example/2")
+
+	d.DispatchDue(context.Background())
+
+	if len(*sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(*sent))
+	}
+	if got := (*sent)[0]; got.Kind != KindAlert || got.SearchID != s.ID || len(got.Payload.Jobs) != 2 {
+		t.Errorf("unexpected message sent: %+v", got)
+	}
+	if msg := message(t, store); msg.Status != StatusSent || msg.Attempts != 1 {
+		t.Errorf("status %q after %d attempts, want sent after 1", msg.Status, msg.Attempts)
+	}
+	seen, err := store.SentJobs.SeenURLs(context.Background(), s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seen["https://jobs.example/1"] || !seen["https://jobs.example/2"] {
+		t.Errorf("delivered jobs not recorded as sent: %v", seen)
+	}
+
+	// Sent messages aren't picked up again
+	d.DispatchDue(context.Background())
+	if len(*sent) != 1 {
+		t.Errorf("sent %d messages, want 1", len(*sent))
+	}
+}
+
+func TestDispatchDueRetriesThenDeadLetters(t *testing.T) {
+	store := repository.NewMemoryStore()
+	d, sent := newTestDispatcher(store, errors.New("smtp down"), errors.New("smtp still down"))
+	d.MaxAttempts = 2
+	d.BaseDelay = time.Hour
+	d.MaxDelay = time.Hour
+	s, _ := queueAlert(t, store, "https://jobs.example/1")
+
+	d.DispatchDue(context.Background())
+
+	msg := message(t, store)
+	if msg.Status != StatusPending || msg.Attempts != 1 || msg.LastError != "smtp down" {
+		t.Fatalf("after a failure got status %q, attempts %d, error %q", msg.Status, msg.Attempts, msg.LastError)
+	}
+	if wait := time.Until(msg.NextAttemptAt); wait < 59*time.Minute || wait > time.Hour {
+		t.Errorf("next attempt in %v, want the backoff of 1h", wait)
+	}
+
+	// Not due yet
+	d.DispatchDue(context.Background())
+	if len(*sent) != 1 {
+		t.Fatalf("sent %d times before the backoff elapsed, want 1", len(*sent))
+	}
+
+	d.BaseDelay, d.MaxDelay = 0, 0
+	if err := store.Outbox.RecordFailure(context.Background(), msg.ID, StatusPending, time.Now().Add(-time.Second), msg.LastError); err != nil {
+		t.Fatal(err)
+	}
+	d.DispatchDue(context.Background())
+
+	msg = message(t, store)
+	if msg.Status != StatusDead || msg.Attempts != 2 || msg.LastError != "smtp still down" {
+		t.Errorf("after the last attempt got status %q, attempts %d, error %q", msg.Status, msg.Attempts, msg.LastError)
+	}
+	// Dead messages still hold their jobs, so they aren't queued again
+	seen, err := store.SentJobs.SeenURLs(context.Background(), s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seen["https://jobs.example/1"] {
+		t.Error("dead-lettered job no longer counts as seen")
+	}
+}
+
+func TestDispatchDueRetriesExpiredClaims(t *testing.T) {
+	store := repository.NewMemoryStore()
+	d, sent := newTestDispatcher(store)
+	_, msg := queueAlert(t, store, "https://jobs.example/1")
+
+	// A dispatcher claimed the message and died, and its lease ran out
+	claimed, err := store.Outbox.Claim(context.Background(), msg.ID, 0, time.Now().Add(-time.Second))
+	if err != nil || !claimed {
+		t.Fatalf("Claim = %v, %v", claimed, err)
+	}
+	if ok, _ := store.Outbox.Claim(context.Background(), msg.ID, 0, time.Now()); ok {
+		t.Fatal("a message was claimed twice")
+	}
+
+	d.DispatchDue(context.Background())
+	if len(*sent) != 1 || (*sent)[0].Attempts != 2 {
+		t.Errorf("expected one send as the second attempt, got %+v", *sent)
+	}
+}
+
+func TestDispatchDueDeadLettersCorruptPayloads(t *testing.T) {
+	store := repository.NewMemoryStore()
+	d, sent := newTestDispatcher(store)
+	ctx := context.Background()
+	corrupt := &models.OutboxMessage{UserID: 1, Kind: KindAlert, ToEmail: "alice@example.com", Payload: `{"jobs": [`}
+	if err := store.Outbox.Enqueue(ctx, corrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	d.DispatchDue(ctx)
+
+	if len(*sent) != 0 {
+		t.Errorf("sent %d messages, want 0", len(*sent))
+	}
+	msgs := store.Outbox.(*repository.MemoryOutboxRepository).Messages()
+	if msg := msgs[0]; msg.Status != StatusDead || !strings.HasPrefix(msg.LastError, "corrupt payload: ") {
+		t.Errorf("corrupt message has status %q and error %q, want it dead-lettered", msg.Status, msg.LastError)
+	}
+	due, err := store.Outbox.ListDue(ctx, time.Now(), batchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("corrupt message is still due")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+	for attempts, want := range map[int]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		4: 8 * time.Minute,
+		5: 10 * time.Minute,
+		9: 10 * time.Minute,
+	} {
+		if got := d.Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
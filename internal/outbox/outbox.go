@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"jobseek-web-be/internal/email"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/repository"
+)
+
+// Message kinds
+const (
+	KindAlert  = "alert"
+	KindDigest = "digest"
+)
+
+// Message statuses
+const (
+	StatusPending = models.OutboxPending
+	StatusSent    = models.OutboxSent
+	StatusDead    = models.OutboxDead
+)
+
+// Match ties a delivered job to the alert that found it. Matches are written
+// to sent_jobs only once the message has actually been delivered.
+type Match = models.JobMatch
+
+// Payload is the snapshot of what a message delivers, stored as JSON so a
+// retry sends exactly what the original attempt would have.
+type Payload struct {
+	Jobs   []models.Job        `json:"jobs,omitempty"`   // KindAlert
+	Period string              `json:"period,omitempty"` // KindDigest
+	Groups []email.DigestGroup `json:"groups,omitempty"` // KindDigest
+}
+
+// Message is a pending or finished delivery.
+type Message struct {
+	ID       int
+	UserID   int
+	SearchID int // 0 for digests
+	Kind     string
+	ToEmail  string
+	UserName string
+	Payload  Payload
+	Matches  []Match
+	Attempts int
+}
+
+// Alert returns the message for a single alert email.
+func Alert(userID, searchID int, toEmail, userName string, jobs []models.Job) Message {
+	matches := make([]Match, 0, len(jobs))
+	for _, job := range jobs {
+		matches = append(matches, Match{SearchID: searchID, JobURL: job.JobURL})
+	}
+	return Message{
+		UserID:   userID,
+		SearchID: searchID,
+		Kind:     KindAlert,
+		ToEmail:  toEmail,
+		UserName: userName,
+		Payload:  Payload{Jobs: jobs},
+		Matches:  matches,
+	}
+}
+
+// Digest returns the message for a digest email. matches lists every
+// alert/job pair covered, including jobs deduplicated out of the groups.
+func Digest(userID int, toEmail, userName, period string, groups []email.DigestGroup, matches []Match) Message {
+	return Message{
+		UserID:   userID,
+		Kind:     KindDigest,
+		ToEmail:  toEmail,
+		UserName: userName,
+		Payload:  Payload{Period: period, Groups: groups},
+		Matches:  matches,
+	}
+}
+
+// Enqueue records msg for delivery.
+func Enqueue(ctx context.Context, messages repository.OutboxRepository, msg Message) error {
+	rec, err := msg.Record()
+	if err != nil {
+		return err
+	}
+	return messages.Enqueue(ctx, rec)
+}
+
+// Record returns the row msg is stored as, for repositories that queue it
+// along with their own changes.
+func (msg Message) Record() (*models.OutboxMessage, error) {
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OutboxMessage{
+		UserID:   msg.UserID,
+		SearchID: msg.SearchID,
+		Kind:     msg.Kind,
+		ToEmail:  msg.ToEmail,
+		UserName: msg.UserName,
+		Payload:  string(payload),
+		Matches:  msg.Matches,
+	}, nil
+}
+
+// decode turns a stored row back into a message, without its matches.
+func decode(rec models.OutboxMessage) (Message, error) {
+	msg := Message{
+		ID:       rec.ID,
+		UserID:   rec.UserID,
+		SearchID: rec.SearchID,
+		Kind:     rec.Kind,
+		ToEmail:  rec.ToEmail,
+		UserName: rec.UserName,
+		Attempts: rec.Attempts,
+	}
+	err := json.Unmarshal([]byte(rec.Payload), &msg.Payload)
+	return msg, err
+}
@@ -0,0 +1,1222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"jobseek-web-be/internal/models"
+)
+
+// memoryData is the state shared by the in-memory repositories, so joins
+// like ListDue see the same users and searches.
+type memoryData struct {
+	mu            sync.Mutex
+	users         map[int]models.User
+	searches      map[int]models.UserSearch
+	seen          map[int]map[string]bool // search ID -> delivered job URLs
+	outbox        []models.OutboxMessage
+	digestItems   []models.DigestItem
+	lastDigest    map[int]time.Time // user ID -> last digest queued
+	usage         []usageEvent
+	subs          map[string]models.Subscription
+	revoked       map[string]time.Time
+	sessions      map[int]models.Session
+	rotated       map[string]int // rotated refresh token hash -> session ID
+	userTokens    map[string]models.UserToken
+	loginFailures map[[2]string]models.LoginFailure // scope, subject
+	lockouts      []models.Lockout
+	mfa           map[int]models.MFA
+	recoveryCodes map[int]map[string]bool // user ID -> code hash -> used
+	identities    []models.Identity
+	apiKeys       []models.APIKey
+	nextSessionID int
+	nextOutboxID  int
+	nextDigestID  int
+	nextUserID    int
+	nextSearchID  int
+}
+
+// NewMemoryStore returns empty in-memory repositories for tests. They are
+// safe for concurrent use.
+func NewMemoryStore() *Store {
+	d := &memoryData{
+		users:      make(map[int]models.User),
+		searches:   make(map[int]models.UserSearch),
+		seen:       make(map[int]map[string]bool),
+		lastDigest: make(map[int]time.Time),
+		subs:       make(map[string]models.Subscription),
+		revoked:    make(map[string]time.Time),
+		sessions:   make(map[int]models.Session),
+		rotated:    make(map[string]int),
+
+		userTokens:    make(map[string]models.UserToken),
+		loginFailures: make(map[[2]string]models.LoginFailure),
+		mfa:           make(map[int]models.MFA),
+		recoveryCodes: make(map[int]map[string]bool),
+	}
+	return &Store{
+		Users:    &MemoryUserRepository{d: d},
+		Searches: &MemorySearchRepository{d: d},
+		SentJobs: &MemorySentJobRepository{d: d},
+		Outbox:   &MemoryOutboxRepository{d: d},
+		Digests:  &MemoryDigestRepository{d: d},
+		Usage:    &MemoryUsageRepository{d: d},
+
+		Subscriptions: &MemorySubscriptionRepository{d: d},
+		Revocations:   &MemoryTokenRevocationRepository{d: d},
+		Sessions:      &MemorySessionRepository{d: d},
+		UserTokens:    &MemoryUserTokenRepository{d: d},
+		LoginAttempts: &MemoryLoginAttemptRepository{d: d},
+		MFA:           &MemoryMFARepository{d: d},
+		Identities:    &MemoryIdentityRepository{d: d},
+		APIKeys:       &MemoryAPIKeyRepository{d: d},
+	}
+}
+
+type MemoryUserRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, u *models.User) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for _, existing := range r.d.users {
+		if existing.Email == u.Email {
+			return ErrEmailTaken
+		}
+	}
+	r.d.nextUserID++
+	u.ID = r.d.nextUserID
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now().UTC()
+	}
+	r.d.users[u.ID] = *u
+	return nil
+}
+
+func (r *MemoryUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	_, err := r.GetByEmail(ctx, email)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	u, ok := r.d.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+func (r *MemoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for _, u := range r.d.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) SetDigestFrequency(ctx context.Context, userID int, frequency string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	u, ok := r.d.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.DigestFrequency = frequency
+	r.d.users[userID] = u
+	return nil
+}
+
+func (r *MemoryUserRepository) SetPlan(ctx context.Context, userID int, plan string, paid bool) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	u, ok := r.d.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.SubscriptionPlan = plan
+	u.Paid = paid
+	r.d.users[userID] = u
+	return nil
+}
+
+func (r *MemoryUserRepository) SetPassword(ctx context.Context, userID int, hash string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	u, ok := r.d.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Password = hash
+	r.d.users[userID] = u
+	return nil
+}
+
+func (r *MemoryUserRepository) BumpTokenVersion(ctx context.Context, userID int) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	u, ok := r.d.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.TokenVersion++
+	r.d.users[userID] = u
+	return nil
+}
+
+func (r *MemoryUserRepository) MarkEmailVerified(ctx context.Context, userID int, at time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	u, ok := r.d.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if u.EmailVerifiedAt == nil {
+		u.EmailVerifiedAt = &at
+		r.d.users[userID] = u
+	}
+	return nil
+}
+
+type MemorySearchRepository struct {
+	d *memoryData
+}
+
+func (r *MemorySearchRepository) ListByUser(ctx context.Context, userID int) ([]models.UserSearch, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	searches := []models.UserSearch{}
+	for _, s := range r.d.searches {
+		if s.UserID == userID {
+			searches = append(searches, s)
+		}
+	}
+	sort.Slice(searches, func(i, j int) bool { return searches[i].ID > searches[j].ID })
+	return searches, nil
+}
+
+func (r *MemorySearchRepository) FindDuplicate(ctx context.Context, s models.UserSearch) (int, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for _, e := range r.d.searches {
+		if e.UserID == s.UserID && e.Keyword == s.Keyword && e.Country == s.Country && e.Location == s.Location &&
+			e.Language == s.Language && e.HoursOld == s.HoursOld && e.Exclude == s.Exclude &&
+			e.ResultsWanted == s.ResultsWanted && e.Provider == s.Provider {
+			return e.ID, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (r *MemorySearchRepository) Create(ctx context.Context, s *models.UserSearch) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	r.d.nextSearchID++
+	s.ID = r.d.nextSearchID
+	r.d.searches[s.ID] = *s
+	return nil
+}
+
+func (r *MemorySearchRepository) Delete(ctx context.Context, userID, searchID int) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	s, ok := r.d.searches[searchID]
+	if !ok || s.UserID != userID {
+		return ErrNotFound
+	}
+	r.d.deleteSearch(searchID)
+	return nil
+}
+
+func (r *MemorySearchRepository) DeleteAllForUser(ctx context.Context, userID int) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for id, s := range r.d.searches {
+		if s.UserID == userID {
+			r.d.deleteSearch(id)
+		}
+	}
+	return nil
+}
+
+// deleteSearch removes a search along with its sent jobs and digest items,
+// like the SQL store. The caller holds the lock.
+func (d *memoryData) deleteSearch(searchID int) {
+	delete(d.searches, searchID)
+	delete(d.seen, searchID)
+	kept := d.digestItems[:0]
+	for _, item := range d.digestItems {
+		if item.SearchID != searchID {
+			kept = append(kept, item)
+		}
+	}
+	d.digestItems = kept
+}
+
+func (r *MemorySearchRepository) Pause(ctx context.Context, userID, searchID int, at time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	s, ok := r.d.searches[searchID]
+	if !ok || s.UserID != userID {
+		return ErrNotFound
+	}
+	if s.PausedAt == nil {
+		s.PausedAt = &at
+		r.d.searches[searchID] = s
+	}
+	return nil
+}
+
+func (r *MemorySearchRepository) PauseAllForUser(ctx context.Context, userID int, at time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for id, s := range r.d.searches {
+		if s.UserID == userID && s.PausedAt == nil {
+			s.PausedAt = &at
+			r.d.searches[id] = s
+		}
+	}
+	return nil
+}
+
+func (r *MemorySearchRepository) Resume(ctx context.Context, userID, searchID int, nextRun time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	s, ok := r.d.searches[searchID]
+	if !ok || s.UserID != userID {
+		return ErrNotFound
+	}
+	s.PausedAt = nil
+	s.NextRunAt = nextRun
+	r.d.searches[searchID] = s
+	return nil
+}
+
+func (r *MemorySearchRepository) ListDue(ctx context.Context, now time.Time) ([]DueSearch, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var due []DueSearch
+	for _, s := range r.d.searches {
+		if s.PausedAt != nil || (!s.NextRunAt.IsZero() && s.NextRunAt.After(now)) {
+			continue
+		}
+		u := r.d.users[s.UserID]
+		position := 0
+		for _, o := range r.d.searches {
+			if o.UserID == s.UserID && o.ID < s.ID {
+				position++
+			}
+		}
+		due = append(due, DueSearch{
+			UserSearch:    s,
+			UserEmail:     u.Email,
+			UserName:      u.Name,
+			Digest:        u.DigestFrequency,
+			Plan:          u.SubscriptionPlan,
+			Paid:          u.Paid,
+			UserCreatedAt: u.CreatedAt,
+			UserVerified:  u.EmailVerifiedAt != nil,
+			Position:      position,
+		})
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	return due, nil
+}
+
+func (r *MemorySearchRepository) Claim(ctx context.Context, searchID int, now, until time.Time) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	s, ok := r.d.searches[searchID]
+	if !ok || (!s.NextRunAt.IsZero() && s.NextRunAt.After(now)) {
+		return false, nil
+	}
+	s.NextRunAt = until
+	r.d.searches[searchID] = s
+	return true, nil
+}
+
+func (r *MemorySearchRepository) SetNextRun(ctx context.Context, searchID int, nextRun time.Time) error {
+	return r.update(searchID, func(s *models.UserSearch) { s.NextRunAt = nextRun })
+}
+
+func (r *MemorySearchRepository) RecordRun(ctx context.Context, searchID int, lastRun, nextRun time.Time) error {
+	return r.update(searchID, func(s *models.UserSearch) {
+		s.LastRun = lastRun
+		s.NextRunAt = nextRun
+	})
+}
+
+// update applies fn to a stored search. Like the SQL UPDATEs, a missing
+// search is not an error.
+func (r *MemorySearchRepository) update(searchID int, fn func(*models.UserSearch)) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if s, ok := r.d.searches[searchID]; ok {
+		fn(&s)
+		r.d.searches[searchID] = s
+	}
+	return nil
+}
+
+type MemorySentJobRepository struct {
+	d *memoryData
+}
+
+func (r *MemorySentJobRepository) SeenURLs(ctx context.Context, searchID int) (map[string]bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	seen := make(map[string]bool, len(r.d.seen[searchID]))
+	for url := range r.d.seen[searchID] {
+		seen[url] = true
+	}
+	for _, msg := range r.d.outbox {
+		for _, m := range msg.Matches {
+			if m.SearchID == searchID {
+				seen[m.JobURL] = true
+			}
+		}
+	}
+	for _, item := range r.d.digestItems {
+		if item.SearchID == searchID {
+			seen[item.JobURL] = true
+		}
+	}
+	return seen, nil
+}
+
+// MarkSeen records job URLs as already delivered for the search.
+func (r *MemorySentJobRepository) MarkSeen(searchID int, urls ...string) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if r.d.seen[searchID] == nil {
+		r.d.seen[searchID] = make(map[string]bool)
+	}
+	for _, url := range urls {
+		r.d.seen[searchID][url] = true
+	}
+}
+
+type MemoryOutboxRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryOutboxRepository) Enqueue(ctx context.Context, msg *models.OutboxMessage) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	r.d.enqueue(msg)
+	return nil
+}
+
+// enqueue stores a copy of msg, filling in its ID. The caller holds the lock.
+func (d *memoryData) enqueue(msg *models.OutboxMessage) {
+	d.nextOutboxID++
+	msg.ID = d.nextOutboxID
+	msg.Status = models.OutboxPending
+	msg.Attempts = 0
+	if msg.NextAttemptAt.IsZero() {
+		msg.NextAttemptAt = time.Now().UTC()
+	}
+	stored := *msg
+	stored.Matches = append([]models.JobMatch(nil), msg.Matches...)
+	d.outbox = append(d.outbox, stored)
+}
+
+func (r *MemoryOutboxRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var due []models.OutboxMessage
+	for _, msg := range r.d.outbox {
+		if msg.Status == models.OutboxPending && !msg.NextAttemptAt.After(now) {
+			msg.Matches = nil
+			due = append(due, msg)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (r *MemoryOutboxRepository) Claim(ctx context.Context, id, attempts int, until time.Time) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	msg := r.d.message(id)
+	if msg == nil || msg.Status != models.OutboxPending || msg.Attempts != attempts {
+		return false, nil
+	}
+	msg.Attempts++
+	msg.NextAttemptAt = until
+	return true, nil
+}
+
+func (r *MemoryOutboxRepository) MarkDelivered(ctx context.Context, id int, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	msg := r.d.message(id)
+	if msg == nil {
+		return nil
+	}
+	for _, m := range msg.Matches {
+		if _, ok := r.d.searches[m.SearchID]; !ok {
+			continue
+		}
+		if r.d.seen[m.SearchID] == nil {
+			r.d.seen[m.SearchID] = make(map[string]bool)
+		}
+		r.d.seen[m.SearchID][m.JobURL] = true
+	}
+	msg.Matches = nil
+	msg.Status = models.OutboxSent
+	msg.LastError = ""
+	return nil
+}
+
+func (r *MemoryOutboxRepository) RecordFailure(ctx context.Context, id int, status string, next time.Time, lastError string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if msg := r.d.message(id); msg != nil {
+		msg.Status = status
+		msg.NextAttemptAt = next
+		msg.LastError = lastError
+	}
+	return nil
+}
+
+// Messages returns every stored message, in the order they were queued.
+func (r *MemoryOutboxRepository) Messages() []models.OutboxMessage {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	msgs := make([]models.OutboxMessage, len(r.d.outbox))
+	copy(msgs, r.d.outbox)
+	return msgs
+}
+
+// message returns the stored message with the ID, or nil. The caller holds
+// the lock.
+func (d *memoryData) message(id int) *models.OutboxMessage {
+	for i := range d.outbox {
+		if d.outbox[i].ID == id {
+			return &d.outbox[i]
+		}
+	}
+	return nil
+}
+
+type MemoryDigestRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryDigestRepository) Add(ctx context.Context, items []models.DigestItem) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+next:
+	for _, item := range items {
+		for _, held := range r.d.digestItems {
+			if held.SearchID == item.SearchID && held.JobURL == item.JobURL {
+				continue next
+			}
+		}
+		r.d.nextDigestID++
+		item.ID = r.d.nextDigestID
+		if item.CreatedAt.IsZero() {
+			item.CreatedAt = time.Now().UTC()
+		}
+		r.d.digestItems = append(r.d.digestItems, item)
+	}
+	return nil
+}
+
+func (r *MemoryDigestRepository) ListUsers(ctx context.Context) ([]DigestUser, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var users []DigestUser
+	listed := make(map[int]bool)
+	for _, item := range r.d.digestItems {
+		u, ok := r.d.users[item.UserID]
+		if !ok || listed[u.ID] {
+			continue
+		}
+		listed[u.ID] = true
+		du := DigestUser{ID: u.ID, Email: u.Email, Name: u.Name, Frequency: u.DigestFrequency}
+		if at, ok := r.d.lastDigest[u.ID]; ok {
+			du.LastDigestAt = &at
+		}
+		users = append(users, du)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *MemoryDigestRepository) ListItems(ctx context.Context, userID int) ([]DigestEntry, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var entries []DigestEntry
+	for _, item := range r.d.digestItems {
+		s, ok := r.d.searches[item.SearchID]
+		if item.UserID != userID || !ok || s.PausedAt != nil {
+			continue
+		}
+		entries = append(entries, DigestEntry{DigestItem: item, Keyword: s.Keyword, Country: s.Country, Location: s.Location})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].SearchID < entries[j].SearchID
+	})
+	return entries, nil
+}
+
+func (r *MemoryDigestRepository) Delete(ctx context.Context, ids []int) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	kept := r.d.digestItems[:0]
+	for _, item := range r.d.digestItems {
+		if !slices.Contains(ids, item.ID) {
+			kept = append(kept, item)
+		}
+	}
+	r.d.digestItems = kept
+	return nil
+}
+
+func (r *MemoryDigestRepository) Flush(ctx context.Context, userID int, itemIDs []int, msg *models.OutboxMessage, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	flushed := make(map[int]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		flushed[id] = true
+	}
+	kept := make([]models.DigestItem, 0, len(r.d.digestItems))
+	for _, item := range r.d.digestItems {
+		if flushed[item.ID] && item.UserID == userID {
+			delete(flushed, item.ID)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if len(flushed) > 0 {
+		return ErrDigestTaken
+	}
+	r.d.digestItems = kept
+	r.d.enqueue(msg)
+	r.d.lastDigest[userID] = now.UTC()
+	return nil
+}
+
+type usageEvent struct {
+	userID  int
+	feature string
+	at      time.Time
+}
+
+type MemoryUsageRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryUsageRepository) Consume(ctx context.Context, userID int, feature string, now, since time.Time, limit int) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if used, _ := r.window(userID, feature, since); used >= limit {
+		return false, nil
+	}
+	r.d.usage = append(r.d.usage, usageEvent{userID: userID, feature: feature, at: now})
+	return true, nil
+}
+
+func (r *MemoryUsageRepository) Window(ctx context.Context, userID int, feature string, since time.Time) (int, time.Time, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	used, oldest := r.window(userID, feature, since)
+	return used, oldest, nil
+}
+
+func (r *MemoryUsageRepository) window(userID int, feature string, since time.Time) (int, time.Time) {
+	used := 0
+	var oldest time.Time
+	for _, e := range r.d.usage {
+		if e.userID != userID || e.feature != feature || !e.at.After(since) {
+			continue
+		}
+		used++
+		if oldest.IsZero() || e.at.Before(oldest) {
+			oldest = e.at
+		}
+	}
+	return used, oldest
+}
+
+func (r *MemoryUsageRepository) Refund(ctx context.Context, userID int, feature string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for i := len(r.d.usage) - 1; i >= 0; i-- {
+		if e := r.d.usage[i]; e.userID == userID && e.feature == feature {
+			r.d.usage = append(r.d.usage[:i], r.d.usage[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *MemoryUsageRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	kept := r.d.usage[:0]
+	for _, e := range r.d.usage {
+		if !e.at.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	pruned := int64(len(r.d.usage) - len(kept))
+	r.d.usage = kept
+	return pruned, nil
+}
+
+type MemorySubscriptionRepository struct {
+	d *memoryData
+}
+
+func (r *MemorySubscriptionRepository) Get(ctx context.Context, id string) (*models.Subscription, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	s, ok := r.d.subs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (r *MemorySubscriptionRepository) ListByUser(ctx context.Context, userID int) ([]models.Subscription, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	subs := []models.Subscription{}
+	for _, s := range r.d.subs {
+		if s.UserID == userID {
+			subs = append(subs, s)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].UpdatedAt.After(subs[j].UpdatedAt) })
+	return subs, nil
+}
+
+func (r *MemorySubscriptionRepository) Save(ctx context.Context, s models.Subscription) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if existing, ok := r.d.subs[s.ID]; ok && existing.EventAt.After(s.EventAt) {
+		return false, nil
+	}
+	if s.UpdatedAt.IsZero() {
+		s.UpdatedAt = time.Now().UTC()
+	}
+	r.d.subs[s.ID] = s
+	return true, nil
+}
+
+type MemoryTokenRevocationRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryTokenRevocationRepository) Revoke(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if _, ok := r.d.revoked[jti]; !ok {
+		r.d.revoked[jti] = expiresAt
+	}
+	return nil
+}
+
+func (r *MemoryTokenRevocationRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	_, ok := r.d.revoked[jti]
+	return ok, nil
+}
+
+func (r *MemoryTokenRevocationRepository) Prune(ctx context.Context, now time.Time) (int64, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var pruned int64
+	for jti, expiresAt := range r.d.revoked {
+		if expiresAt.Before(now) {
+			delete(r.d.revoked, jti)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+type MemorySessionRepository struct {
+	d *memoryData
+}
+
+func (r *MemorySessionRepository) Create(ctx context.Context, s *models.Session) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	r.d.nextSessionID++
+	s.ID = r.d.nextSessionID
+	r.d.sessions[s.ID] = *s
+	return nil
+}
+
+func (r *MemorySessionRepository) Get(ctx context.Context, id int) (*models.Session, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	s, ok := r.d.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (r *MemorySessionRepository) GetByTokenHash(ctx context.Context, hash string) (*models.Session, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for _, s := range r.d.sessions {
+		if s.TokenHash == hash {
+			return &s, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemorySessionRepository) FindRotated(ctx context.Context, hash string) (int, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	id, ok := r.d.rotated[hash]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return id, nil
+}
+
+func (r *MemorySessionRepository) Rotate(ctx context.Context, id int, oldHash, newHash string, now, expiresAt time.Time) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	s, ok := r.d.sessions[id]
+	if !ok || s.TokenHash != oldHash || s.RevokedAt != nil || !s.ExpiresAt.After(now) {
+		return false, nil
+	}
+	s.TokenHash = newHash
+	s.LastUsedAt = now
+	s.ExpiresAt = expiresAt
+	r.d.sessions[id] = s
+	r.d.rotated[oldHash] = id
+	return true, nil
+}
+
+func (r *MemorySessionRepository) ListActive(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	sessions := []models.Session{}
+	for _, s := range r.d.sessions {
+		if s.UserID == userID && s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (r *MemorySessionRepository) Revoke(ctx context.Context, userID, id int, reason string, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	s, ok := r.d.sessions[id]
+	if !ok || s.UserID != userID || s.RevokedAt != nil {
+		return ErrNotFound
+	}
+	s.RevokedAt = &now
+	s.RevokedReason = reason
+	r.d.sessions[id] = s
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeAll(ctx context.Context, userID, exceptID int, reason string, now time.Time) (int64, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var n int64
+	for id, s := range r.d.sessions {
+		if s.UserID != userID || id == exceptID || s.RevokedAt != nil {
+			continue
+		}
+		s.RevokedAt = &now
+		s.RevokedReason = reason
+		r.d.sessions[id] = s
+		n++
+	}
+	return n, nil
+}
+
+func (r *MemorySessionRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var n int64
+	for id, s := range r.d.sessions {
+		if s.ExpiresAt.Before(before) || (s.RevokedAt != nil && s.RevokedAt.Before(before)) {
+			delete(r.d.sessions, id)
+			n++
+		}
+	}
+	for hash, id := range r.d.rotated {
+		if _, ok := r.d.sessions[id]; !ok {
+			delete(r.d.rotated, hash)
+		}
+	}
+	return n, nil
+}
+
+type MemoryUserTokenRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryUserTokenRepository) Create(ctx context.Context, t *models.UserToken) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	r.d.userTokens[t.ID] = *t
+	return nil
+}
+
+func (r *MemoryUserTokenRepository) Consume(ctx context.Context, id, purpose string, now time.Time) (int, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	t, ok := r.d.userTokens[id]
+	if !ok || t.Purpose != purpose || t.UsedAt != nil || !t.ExpiresAt.After(now) {
+		return 0, ErrNotFound
+	}
+	t.UsedAt = &now
+	r.d.userTokens[id] = t
+	return t.UserID, nil
+}
+
+func (r *MemoryUserTokenRepository) Invalidate(ctx context.Context, userID int, purpose string, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for id, t := range r.d.userTokens {
+		if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+			t.UsedAt = &now
+			r.d.userTokens[id] = t
+		}
+	}
+	return nil
+}
+
+func (r *MemoryUserTokenRepository) IssuedSince(ctx context.Context, userID int, purpose string, since time.Time) ([]time.Time, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var issued []time.Time
+	for _, t := range r.d.userTokens {
+		if t.UserID == userID && t.Purpose == purpose && t.CreatedAt.After(since) {
+			issued = append(issued, t.CreatedAt)
+		}
+	}
+	sort.Slice(issued, func(i, j int) bool { return issued[i].Before(issued[j]) })
+	return issued, nil
+}
+
+func (r *MemoryUserTokenRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var n int64
+	for id, t := range r.d.userTokens {
+		if t.ExpiresAt.Before(before) {
+			delete(r.d.userTokens, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type MemoryLoginAttemptRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryLoginAttemptRepository) Get(ctx context.Context, scope, subject string) (*models.LoginFailure, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	f, ok := r.d.loginFailures[[2]string{scope, subject}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &f, nil
+}
+
+func (r *MemoryLoginAttemptRepository) RecordFailure(ctx context.Context, scope, subject string, now, since time.Time) (*models.LoginFailure, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	k := [2]string{scope, subject}
+	f, ok := r.d.loginFailures[k]
+	if !ok || f.LastFailedAt.Before(since) {
+		f = models.LoginFailure{Scope: scope, Subject: subject, FirstFailedAt: now, LockedUntil: f.LockedUntil}
+	}
+	f.Failures++
+	f.LastFailedAt = now
+	r.d.loginFailures[k] = f
+	return &f, nil
+}
+
+func (r *MemoryLoginAttemptRepository) Lock(ctx context.Context, scope, subject string, now, until time.Time) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	k := [2]string{scope, subject}
+	f, ok := r.d.loginFailures[k]
+	if !ok || (f.LockedUntil != nil && f.LockedUntil.After(now)) {
+		return false, nil
+	}
+	f.LockedUntil = &until
+	r.d.loginFailures[k] = f
+	return true, nil
+}
+
+func (r *MemoryLoginAttemptRepository) Clear(ctx context.Context, scope, subject string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	delete(r.d.loginFailures, [2]string{scope, subject})
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var n int64
+	for k, f := range r.d.loginFailures {
+		if f.LastFailedAt.Before(before) && (f.LockedUntil == nil || f.LockedUntil.Before(before)) {
+			delete(r.d.loginFailures, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryLoginAttemptRepository) RecordLockout(ctx context.Context, l *models.Lockout) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	l.ID = len(r.d.lockouts) + 1
+	r.d.lockouts = append(r.d.lockouts, *l)
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) MarkUnlocked(ctx context.Context, scope, subject, method string, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for i, l := range r.d.lockouts {
+		if l.Scope == scope && l.Subject == subject && l.UnlockedAt == nil && l.LockedUntil.After(now) {
+			r.d.lockouts[i].UnlockedAt = &now
+			r.d.lockouts[i].UnlockedBy = method
+		}
+	}
+	return nil
+}
+
+type MemoryMFARepository struct {
+	d *memoryData
+}
+
+func (r *MemoryMFARepository) Get(ctx context.Context, userID int) (*models.MFA, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	m, ok := r.d.mfa[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &m, nil
+}
+
+func (r *MemoryMFARepository) SavePending(ctx context.Context, userID int, secret string, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if m, ok := r.d.mfa[userID]; ok && m.EnabledAt != nil {
+		return ErrMFAEnabled
+	}
+	r.d.mfa[userID] = models.MFA{UserID: userID, Secret: secret, CreatedAt: now}
+	return nil
+}
+
+func (r *MemoryMFARepository) Enable(ctx context.Context, userID int, counter int64, recoveryHashes []string, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	m, ok := r.d.mfa[userID]
+	if !ok || m.EnabledAt != nil {
+		return ErrNotFound
+	}
+	m.EnabledAt = &now
+	m.LastCounter = counter
+	r.d.mfa[userID] = m
+	codes := make(map[string]bool, len(recoveryHashes))
+	for _, hash := range recoveryHashes {
+		codes[hash] = false
+	}
+	r.d.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *MemoryMFARepository) UseCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	m, ok := r.d.mfa[userID]
+	if !ok || m.LastCounter >= counter {
+		return false, nil
+	}
+	m.LastCounter = counter
+	r.d.mfa[userID] = m
+	return true, nil
+}
+
+func (r *MemoryMFARepository) UseRecoveryCode(ctx context.Context, userID int, hash string, now time.Time) (bool, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	used, ok := r.d.recoveryCodes[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	r.d.recoveryCodes[userID][hash] = true
+	return true, nil
+}
+
+func (r *MemoryMFARepository) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	n := 0
+	for _, used := range r.d.recoveryCodes[userID] {
+		if !used {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryMFARepository) Delete(ctx context.Context, userID int) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	delete(r.d.mfa, userID)
+	delete(r.d.recoveryCodes, userID)
+	return nil
+}
+
+type MemoryIdentityRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for _, i := range r.d.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return &i, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryIdentityRepository) Create(ctx context.Context, i *models.Identity) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for _, existing := range r.d.identities {
+		if existing.Provider == i.Provider && existing.Subject == i.Subject {
+			return errors.New("identity already linked")
+		}
+	}
+	i.ID = len(r.d.identities) + 1
+	r.d.identities = append(r.d.identities, *i)
+	return nil
+}
+
+func (r *MemoryIdentityRepository) RecordLogin(ctx context.Context, id int, email string, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for k := range r.d.identities {
+		if r.d.identities[k].ID == id {
+			r.d.identities[k].Email = email
+			r.d.identities[k].LastLoginAt = now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+type MemoryAPIKeyRepository struct {
+	d *memoryData
+}
+
+func (r *MemoryAPIKeyRepository) Create(ctx context.Context, k *models.APIKey) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for _, existing := range r.d.apiKeys {
+		if existing.Prefix == k.Prefix {
+			return errors.New("API key prefix already exists")
+		}
+	}
+	k.ID = len(r.d.apiKeys) + 1
+	r.d.apiKeys = append(r.d.apiKeys, *k)
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for _, k := range r.d.apiKeys {
+		if k.Prefix == prefix {
+			return &k, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) ListActive(ctx context.Context, userID int) ([]models.APIKey, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	keys := []models.APIKey{}
+	for i := len(r.d.apiKeys) - 1; i >= 0; i-- {
+		if k := r.d.apiKeys[i]; k.UserID == userID && k.RevokedAt == nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) Revoke(ctx context.Context, userID, id int, now time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for i, k := range r.d.apiKeys {
+		if k.ID == id && k.UserID == userID && k.RevokedAt == nil {
+			r.d.apiKeys[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) RevokeAll(ctx context.Context, userID int, now time.Time) (int64, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	var n int64
+	for i, k := range r.d.apiKeys {
+		if k.UserID == userID && k.RevokedAt == nil {
+			r.d.apiKeys[i].RevokedAt = &now
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryAPIKeyRepository) Touch(ctx context.Context, id int, now, since time.Time) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	for i, k := range r.d.apiKeys {
+		if k.ID == id && (k.LastUsedAt == nil || k.LastUsedAt.Before(since)) {
+			r.d.apiKeys[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
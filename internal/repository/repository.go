@@ -0,0 +1,322 @@
+// Package repository keeps the SQL for users, saved searches, sent jobs,
+// the email outbox, digest items, usage events, subscriptions, revoked
+// tokens, sessions, emailed user tokens, login throttling, 2FA enrollments,
+// linked identities and API keys in one place.
+// Handlers and the scheduler depend on the interfaces below, so they can run
+// against the SQL store in production and the in-memory store in tests.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"jobseek-web-be/internal/models"
+)
+
+// ErrNotFound is returned when the requested row doesn't exist (or isn't
+// owned by the given user).
+var ErrNotFound = errors.New("not found")
+
+// ErrMFAEnabled is returned by MFARepository.SavePending when the user
+// already has 2FA turned on.
+var ErrMFAEnabled = errors.New("two-factor authentication is already enabled")
+
+// ErrDigestTaken is returned by DigestRepository.Flush when another
+// instance flushed some of the items first.
+var ErrDigestTaken = errors.New("digest items already taken")
+
+// ErrEmailTaken is returned by UserRepository.Create when the email is
+// already registered.
+var ErrEmailTaken = errors.New("user already exists")
+
+type UserRepository interface {
+	// Create inserts the user, filling in ID and CreatedAt.
+	Create(ctx context.Context, u *models.User) error
+	EmailExists(ctx context.Context, email string) (bool, error)
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	SetDigestFrequency(ctx context.Context, userID int, frequency string) error
+	SetPlan(ctx context.Context, userID int, plan string, paid bool) error
+	// SetPassword replaces the user's password hash.
+	SetPassword(ctx context.Context, userID int, hash string) error
+	// BumpTokenVersion invalidates every token issued to the user so far.
+	BumpTokenVersion(ctx context.Context, userID int) error
+	// MarkEmailVerified records when the user confirmed their address. An
+	// earlier confirmation is kept.
+	MarkEmailVerified(ctx context.Context, userID int, at time.Time) error
+}
+
+type SearchRepository interface {
+	// ListByUser returns the user's saved searches, newest first.
+	ListByUser(ctx context.Context, userID int) ([]models.UserSearch, error)
+	// FindDuplicate returns the ID of the user's saved search with the same
+	// search parameters as s, or ErrNotFound.
+	FindDuplicate(ctx context.Context, s models.UserSearch) (int, error)
+	// Create inserts the search, filling in ID.
+	Create(ctx context.Context, s *models.UserSearch) error
+	// Delete removes one of the user's searches, or returns ErrNotFound.
+	Delete(ctx context.Context, userID, searchID int) error
+	DeleteAllForUser(ctx context.Context, userID int) error
+	// Pause stops one of the user's searches from running, keeping it and
+	// its held digest items until Resume, or returns ErrNotFound. An
+	// earlier pause is kept.
+	Pause(ctx context.Context, userID, searchID int, at time.Time) error
+	// PauseAllForUser pauses every search of the user.
+	PauseAllForUser(ctx context.Context, userID int, at time.Time) error
+	// Resume runs a paused search again from nextRun, or returns
+	// ErrNotFound.
+	Resume(ctx context.Context, userID, searchID int, nextRun time.Time) error
+
+	// ListDue returns the searches whose next_run_at has passed (or was
+	// never set), joined with their owner. Paused searches are left out.
+	ListDue(ctx context.Context, now time.Time) ([]DueSearch, error)
+	// Claim pushes a due search's next_run_at to until, reporting false if
+	// it's no longer due because someone else claimed it first.
+	Claim(ctx context.Context, searchID int, now, until time.Time) (bool, error)
+	// SetNextRun reschedules a search without recording a run.
+	SetNextRun(ctx context.Context, searchID int, nextRun time.Time) error
+	// RecordRun stores a finished run and the next scheduled one.
+	RecordRun(ctx context.Context, searchID int, lastRun, nextRun time.Time) error
+}
+
+type SentJobRepository interface {
+	// SeenURLs returns the job URLs already delivered for the search or
+	// waiting for delivery in the outbox or a pending digest.
+	SeenURLs(ctx context.Context, searchID int) (map[string]bool, error)
+}
+
+type OutboxRepository interface {
+	// Enqueue stores a pending message and its matches, filling in ID.
+	Enqueue(ctx context.Context, msg *models.OutboxMessage) error
+	// ListDue returns up to limit pending messages whose next attempt is
+	// due at now, earliest first.
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error)
+	// Claim bumps a pending message's attempts and pushes its next attempt
+	// to until, reporting false if its attempts are no longer attempts
+	// because another dispatcher claimed it first.
+	Claim(ctx context.Context, id, attempts int, until time.Time) (bool, error)
+	// MarkDelivered marks the message sent and moves its matches into
+	// sent_jobs, except for alerts deleted since it was queued.
+	MarkDelivered(ctx context.Context, id int, now time.Time) error
+	// RecordFailure stores an attempt's error along with the message's new
+	// status and next attempt. Matches are kept, so dead messages still
+	// keep their jobs from being queued again.
+	RecordFailure(ctx context.Context, id int, status string, next time.Time, lastError string) error
+}
+
+type DigestRepository interface {
+	// Add holds jobs for their owner's next digest. Jobs already held for
+	// the same alert are ignored.
+	Add(ctx context.Context, items []models.DigestItem) error
+	// ListUsers returns the users who have items held.
+	ListUsers(ctx context.Context) ([]DigestUser, error)
+	// ListItems returns the user's held items, oldest first, joined with
+	// the alert that found them. Items of paused alerts stay held.
+	ListItems(ctx context.Context, userID int) ([]DigestEntry, error)
+	// Delete removes held items without sending them.
+	Delete(ctx context.Context, ids []int) error
+	// Flush queues msg in the outbox, deletes the items it covers and
+	// records the user's digest as sent at now, all or nothing. It returns
+	// ErrDigestTaken if any of the items is already gone.
+	Flush(ctx context.Context, userID int, itemIDs []int, msg *models.OutboxMessage, now time.Time) error
+}
+
+type UsageRepository interface {
+	// Consume records a use of the feature at now unless the user already
+	// has limit uses after since, reporting whether it was recorded.
+	Consume(ctx context.Context, userID int, feature string, now, since time.Time, limit int) (bool, error)
+	// Window returns how many uses of the feature the user has after since,
+	// and when the oldest of them happened (zero if there are none).
+	Window(ctx context.Context, userID int, feature string, since time.Time) (int, time.Time, error)
+	// Refund deletes the user's most recent use of the feature.
+	Refund(ctx context.Context, userID int, feature string) error
+	// Prune deletes usage recorded before the given time.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+type SubscriptionRepository interface {
+	// Get returns the subscription with the billing provider's ID, or
+	// ErrNotFound.
+	Get(ctx context.Context, id string) (*models.Subscription, error)
+	ListByUser(ctx context.Context, userID int) ([]models.Subscription, error)
+	// Save inserts or updates the subscription unless the stored copy came
+	// from a newer event, reporting whether it was written.
+	Save(ctx context.Context, sub models.Subscription) (bool, error)
+}
+
+type TokenRevocationRepository interface {
+	// Revoke adds a token ID to the revocation list until the token expires.
+	Revoke(ctx context.Context, jti string, userID int, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// Prune drops entries for tokens that have expired anyway.
+	Prune(ctx context.Context, now time.Time) (int64, error)
+}
+
+type SessionRepository interface {
+	// Create inserts the session, filling in ID.
+	Create(ctx context.Context, s *models.Session) error
+	// Get returns a session by ID, revoked or not, or ErrNotFound.
+	Get(ctx context.Context, id int) (*models.Session, error)
+	// GetByTokenHash returns the session whose current refresh token has
+	// the hash, or ErrNotFound.
+	GetByTokenHash(ctx context.Context, hash string) (*models.Session, error)
+	// FindRotated returns the ID of the session a rotated-out refresh token
+	// belonged to, or ErrNotFound.
+	FindRotated(ctx context.Context, hash string) (int, error)
+	// Rotate replaces the session's refresh token hash if it's still
+	// oldHash and the session is live, remembering oldHash as rotated. It
+	// reports false if the session was rotated or revoked in the meantime.
+	Rotate(ctx context.Context, id int, oldHash, newHash string, now, expiresAt time.Time) (bool, error)
+	// ListActive returns the user's unrevoked, unexpired sessions, most
+	// recently used first.
+	ListActive(ctx context.Context, userID int, now time.Time) ([]models.Session, error)
+	// Revoke ends one of the user's sessions, or returns ErrNotFound.
+	Revoke(ctx context.Context, userID, id int, reason string, now time.Time) error
+	// RevokeAll ends all of the user's sessions except exceptID (0 for
+	// none), returning how many were ended.
+	RevokeAll(ctx context.Context, userID, exceptID int, reason string, now time.Time) (int64, error)
+	// Prune deletes sessions that expired or were revoked before the given
+	// time, along with their rotated tokens.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+type UserTokenRepository interface {
+	// Create records an issued token.
+	Create(ctx context.Context, t *models.UserToken) error
+	// Consume marks an unused, unexpired token with the purpose as used and
+	// returns its user ID, or ErrNotFound.
+	Consume(ctx context.Context, id, purpose string, now time.Time) (int, error)
+	// Invalidate marks all of the user's unused tokens with the purpose as
+	// used.
+	Invalidate(ctx context.Context, userID int, purpose string, now time.Time) error
+	// IssuedSince returns when tokens with the purpose were issued to the
+	// user after since, oldest first.
+	IssuedSince(ctx context.Context, userID int, purpose string, since time.Time) ([]time.Time, error)
+	// Prune deletes tokens that expired before the given time.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+type LoginAttemptRepository interface {
+	// Get returns the failure count of an IP or account, or ErrNotFound.
+	Get(ctx context.Context, scope, subject string) (*models.LoginFailure, error)
+	// RecordFailure counts a failed login at now and returns the updated
+	// count. Failures before since are forgotten first.
+	RecordFailure(ctx context.Context, scope, subject string, now, since time.Time) (*models.LoginFailure, error)
+	// Lock sets locked_until unless a lock is already in force at now,
+	// reporting whether it did.
+	Lock(ctx context.Context, scope, subject string, now, until time.Time) (bool, error)
+	// Clear forgets the failures and lock of an IP or account.
+	Clear(ctx context.Context, scope, subject string) error
+	// Prune deletes counts whose last failure and lock both ended before
+	// the given time.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+
+	// RecordLockout adds an audit record, filling in ID.
+	RecordLockout(ctx context.Context, l *models.Lockout) error
+	// MarkUnlocked closes the open audit records of an IP or account that
+	// was unlocked early.
+	MarkUnlocked(ctx context.Context, scope, subject, method string, now time.Time) error
+}
+
+type MFARepository interface {
+	// Get returns the user's enrollment, pending or enabled, or ErrNotFound.
+	Get(ctx context.Context, userID int) (*models.MFA, error)
+	// SavePending stores a new secret to be confirmed, replacing any
+	// pending one. It returns ErrMFAEnabled if 2FA is already enabled.
+	SavePending(ctx context.Context, userID int, secret string, now time.Time) error
+	// Enable turns on a pending enrollment after its first code (step
+	// counter) and replaces the recovery codes.
+	Enable(ctx context.Context, userID int, counter int64, recoveryHashes []string, now time.Time) error
+	// UseCounter records an accepted code's step, reporting false if a
+	// code from that step or a later one was already used.
+	UseCounter(ctx context.Context, userID int, counter int64) (bool, error)
+	// UseRecoveryCode marks an unused recovery code as used, reporting
+	// whether there was one.
+	UseRecoveryCode(ctx context.Context, userID int, hash string, now time.Time) (bool, error)
+	// RecoveryCodesLeft counts the user's unused recovery codes.
+	RecoveryCodesLeft(ctx context.Context, userID int) (int, error)
+	// Delete removes the enrollment and recovery codes.
+	Delete(ctx context.Context, userID int) error
+}
+
+type IdentityRepository interface {
+	// GetBySubject returns the identity for a provider's user, or
+	// ErrNotFound.
+	GetBySubject(ctx context.Context, provider, subject string) (*models.Identity, error)
+	// Create links an identity, filling in ID.
+	Create(ctx context.Context, i *models.Identity) error
+	// RecordLogin updates the identity's email and last login.
+	RecordLogin(ctx context.Context, id int, email string, now time.Time) error
+}
+
+type APIKeyRepository interface {
+	// Create inserts the key, filling in ID.
+	Create(ctx context.Context, k *models.APIKey) error
+	// GetByPrefix returns the key with the prefix, revoked or not, or
+	// ErrNotFound.
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	// ListActive returns the user's unrevoked keys, newest first.
+	ListActive(ctx context.Context, userID int) ([]models.APIKey, error)
+	// Revoke revokes one of the user's keys, or returns ErrNotFound if it
+	// doesn't exist, isn't theirs or was already revoked.
+	Revoke(ctx context.Context, userID, id int, now time.Time) error
+	// RevokeAll revokes all of the user's keys, returning how many were
+	// still active.
+	RevokeAll(ctx context.Context, userID int, now time.Time) (int64, error)
+	// Touch records a use of the key unless one was already recorded after
+	// since, which keeps busy keys from writing on every request.
+	Touch(ctx context.Context, id int, now, since time.Time) error
+}
+
+// DueSearch is a saved search joined with the owner details the scheduler
+// needs to process it.
+type DueSearch struct {
+	models.UserSearch
+	UserEmail     string
+	UserName      string
+	Digest        string // owner's digest frequency, empty or "off" when disabled
+	Plan          string
+	Paid          bool
+	UserCreatedAt time.Time
+	UserVerified  bool // owner confirmed their email address
+	// Position is the number of the owner's alerts created before this one,
+	// so plans with an alert limit can run only the oldest ones.
+	Position int
+}
+
+// DigestUser is a user with items held for a digest.
+type DigestUser struct {
+	ID           int
+	Email        string
+	Name         string
+	Frequency    string // empty or "off" when digests are disabled
+	LastDigestAt *time.Time
+}
+
+// DigestEntry is a held digest item joined with the alert that found it.
+type DigestEntry struct {
+	models.DigestItem
+	Keyword  string
+	Country  string
+	Location string
+}
+
+// Store bundles the repositories backed by the same storage.
+type Store struct {
+	Users    UserRepository
+	Searches SearchRepository
+	SentJobs SentJobRepository
+	Outbox   OutboxRepository
+	Digests  DigestRepository
+	Usage    UsageRepository
+
+	Subscriptions SubscriptionRepository
+	Revocations   TokenRevocationRepository
+	Sessions      SessionRepository
+	UserTokens    UserTokenRepository
+	LoginAttempts LoginAttemptRepository
+	MFA           MFARepository
+	Identities    IdentityRepository
+	APIKeys       APIKeyRepository
+}
@@ -0,0 +1,1330 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"jobseek-web-be/internal/db"
+	"jobseek-web-be/internal/models"
+)
+
+// Defaults for saved search columns that may be NULL in rows created before
+// the columns existed. They match the column defaults.
+const (
+	defaultHoursOld      = 24
+	defaultResultsWanted = 10
+)
+
+// NewSQLStore returns repositories backed by conn, which may be SQLite or
+// PostgreSQL.
+func NewSQLStore(conn *db.Conn) *Store {
+	return &Store{
+		Users:    &SQLUserRepository{db: conn},
+		Searches: &SQLSearchRepository{db: conn},
+		SentJobs: &SQLSentJobRepository{db: conn},
+		Outbox:   &SQLOutboxRepository{db: conn},
+		Digests:  &SQLDigestRepository{db: conn},
+		Usage:    &SQLUsageRepository{db: conn},
+
+		Subscriptions: &SQLSubscriptionRepository{db: conn},
+		Revocations:   &SQLTokenRevocationRepository{db: conn},
+		Sessions:      &SQLSessionRepository{db: conn},
+		UserTokens:    &SQLUserTokenRepository{db: conn},
+		LoginAttempts: &SQLLoginAttemptRepository{db: conn},
+		MFA:           &SQLMFARepository{db: conn},
+		Identities:    &SQLIdentityRepository{db: conn},
+		APIKeys:       &SQLAPIKeyRepository{db: conn},
+	}
+}
+
+type SQLUserRepository struct {
+	db *db.Conn
+}
+
+func (r *SQLUserRepository) Create(ctx context.Context, u *models.User) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now().UTC()
+	}
+	err := r.db.QueryRowContext(ctx,
+		"INSERT INTO users(name, email, password, subscription_plan, paid, created_at) VALUES(?, ?, ?, ?, ?, ?) RETURNING id",
+		u.Name, u.Email, u.Password, u.SubscriptionPlan, boolInt(u.Paid), u.CreatedAt,
+	).Scan(&u.ID)
+	if db.IsUniqueViolation(err) {
+		// Registered concurrently, after the caller's EmailExists check
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (r *SQLUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, "SELECT exists(SELECT 1 FROM users WHERE email=?)", email).Scan(&exists)
+	return exists, err
+}
+
+func (r *SQLUserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	return r.getBy(ctx, "id", id)
+}
+
+func (r *SQLUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.getBy(ctx, "email", email)
+}
+
+func (r *SQLUserRepository) getBy(ctx context.Context, column string, value interface{}) (*models.User, error) {
+	var u models.User
+	var plan, digest sql.NullString
+	var paid sql.NullBool
+	var verifiedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, name, email, password, subscription_plan, paid, digest_frequency, token_version, email_verified_at, created_at FROM users WHERE "+column+" = ?",
+		value,
+	).Scan(&u.ID, &u.Name, &u.Email, &u.Password, &plan, &paid, &digest, &u.TokenVersion, &verifiedAt, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	u.SubscriptionPlan = plan.String
+	u.Paid = paid.Bool
+	u.DigestFrequency = digest.String
+	if verifiedAt.Valid {
+		u.EmailVerifiedAt = &verifiedAt.Time
+	}
+	return &u, nil
+}
+
+func (r *SQLUserRepository) SetDigestFrequency(ctx context.Context, userID int, frequency string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET digest_frequency = ? WHERE id = ?", frequency, userID)
+	return err
+}
+
+func (r *SQLUserRepository) SetPlan(ctx context.Context, userID int, plan string, paid bool) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET subscription_plan = ?, paid = ? WHERE id = ?", plan, boolInt(paid), userID)
+	return err
+}
+
+func (r *SQLUserRepository) SetPassword(ctx context.Context, userID int, hash string) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ?", hash, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res)
+}
+
+func (r *SQLUserRepository) BumpTokenVersion(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET token_version = token_version + 1 WHERE id = ?", userID)
+	return err
+}
+
+func (r *SQLUserRepository) MarkEmailVerified(ctx context.Context, userID int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", at.UTC(), userID)
+	return err
+}
+
+type SQLSearchRepository struct {
+	db *db.Conn
+}
+
+// searchColumns are read by scanSearch, in order.
+const searchColumns = "us.id, us.user_id, us.keyword, us.country, us.location, us.language, us.frequency, us.timezone, us.hours_old, us.exclude, us.results_wanted, us.provider, us.last_run, us.next_run_at, us.paused_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSearch reads searchColumns (plus any extra destinations), mapping NULLs
+// to empty values or the column defaults.
+func scanSearch(row scanner, s *models.UserSearch, extra ...interface{}) error {
+	var keyword, country, location, language, frequency, timezone, exclude, provider sql.NullString
+	var hoursOld, resultsWanted sql.NullInt64
+	var lastRun, nextRunAt, pausedAt sql.NullTime
+
+	dest := []interface{}{&s.ID, &s.UserID, &keyword, &country, &location, &language, &frequency, &timezone, &hoursOld, &exclude, &resultsWanted, &provider, &lastRun, &nextRunAt, &pausedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	s.Keyword = keyword.String
+	s.Country = country.String
+	s.Location = location.String
+	s.Language = language.String
+	s.Frequency = frequency.String
+	s.Timezone = timezone.String
+	s.Exclude = exclude.String
+	s.Provider = provider.String
+	s.HoursOld = defaultHoursOld
+	if hoursOld.Valid {
+		s.HoursOld = int(hoursOld.Int64)
+	}
+	s.ResultsWanted = defaultResultsWanted
+	if resultsWanted.Valid {
+		s.ResultsWanted = int(resultsWanted.Int64)
+	}
+	if lastRun.Valid {
+		s.LastRun = lastRun.Time
+	}
+	if nextRunAt.Valid {
+		s.NextRunAt = nextRunAt.Time
+	}
+	if pausedAt.Valid {
+		s.PausedAt = &pausedAt.Time
+	}
+	return nil
+}
+
+func (r *SQLSearchRepository) ListByUser(ctx context.Context, userID int) ([]models.UserSearch, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+searchColumns+`
+		FROM user_searches us
+		WHERE us.user_id = ?
+		ORDER BY us.id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []models.UserSearch{}
+	for rows.Next() {
+		var s models.UserSearch
+		if err := scanSearch(rows, &s); err != nil {
+			return nil, err
+		}
+		searches = append(searches, s)
+	}
+	return searches, rows.Err()
+}
+
+func (r *SQLSearchRepository) FindDuplicate(ctx context.Context, s models.UserSearch) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id FROM user_searches
+		WHERE user_id = ? AND keyword = ? AND country = ? AND location = ? AND language = ? AND hours_old = ? AND exclude = ? AND results_wanted = ? AND provider = ?
+	`, s.UserID, s.Keyword, s.Country, s.Location, s.Language, s.HoursOld, s.Exclude, s.ResultsWanted, s.Provider).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+func (r *SQLSearchRepository) Create(ctx context.Context, s *models.UserSearch) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO user_searches (user_id, keyword, country, location, language, frequency, timezone, hours_old, exclude, results_wanted, provider, last_run, next_run_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, s.UserID, s.Keyword, s.Country, s.Location, s.Language, s.Frequency, s.Timezone, s.HoursOld, s.Exclude, s.ResultsWanted, s.Provider,
+		nullTime(s.LastRun), nullTime(s.NextRunAt)).Scan(&s.ID)
+}
+
+// searchDependents reference user_searches and are deleted with it, since
+// PostgreSQL enforces the foreign keys.
+var searchDependents = []string{"sent_jobs", "digest_items"}
+
+func (r *SQLSearchRepository) Delete(ctx context.Context, userID, searchID int) error {
+	return r.deleteWhere(ctx, "id = ? AND user_id = ?", searchID, userID)
+}
+
+func (r *SQLSearchRepository) DeleteAllForUser(ctx context.Context, userID int) error {
+	err := r.deleteWhere(ctx, "user_id = ?", userID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *SQLSearchRepository) deleteWhere(ctx context.Context, where string, args ...interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range searchDependents {
+		_, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE search_id IN (SELECT id FROM user_searches WHERE "+where+")", args...)
+		if err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_searches WHERE "+where, args...)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLSearchRepository) Pause(ctx context.Context, userID, searchID int, at time.Time) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE user_searches SET paused_at = COALESCE(paused_at, ?) WHERE id = ? AND user_id = ?", at, searchID, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res)
+}
+
+func (r *SQLSearchRepository) PauseAllForUser(ctx context.Context, userID int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE user_searches SET paused_at = ? WHERE user_id = ? AND paused_at IS NULL", at, userID)
+	return err
+}
+
+func (r *SQLSearchRepository) Resume(ctx context.Context, userID, searchID int, nextRun time.Time) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE user_searches SET paused_at = NULL, next_run_at = ? WHERE id = ? AND user_id = ?", nextRun, searchID, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res)
+}
+
+func (r *SQLSearchRepository) ListDue(ctx context.Context, now time.Time) ([]DueSearch, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+searchColumns+`, u.email, u.name, u.digest_frequency, u.subscription_plan, u.paid, u.created_at, u.email_verified_at IS NOT NULL,
+			(SELECT COUNT(*) FROM user_searches o WHERE o.user_id = us.user_id AND o.id < us.id)
+		FROM user_searches us
+		JOIN users u ON us.user_id = u.id
+		WHERE us.paused_at IS NULL AND (us.next_run_at IS NULL OR us.next_run_at <= ?)
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []DueSearch
+	for rows.Next() {
+		var d DueSearch
+		var digest, plan sql.NullString
+		var paid sql.NullBool
+		if err := scanSearch(rows, &d.UserSearch, &d.UserEmail, &d.UserName, &digest, &plan, &paid, &d.UserCreatedAt, &d.UserVerified, &d.Position); err != nil {
+			return nil, err
+		}
+		d.Digest = digest.String
+		d.Plan = plan.String
+		d.Paid = paid.Bool
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+func (r *SQLSearchRepository) Claim(ctx context.Context, searchID int, now, until time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE user_searches SET next_run_at = ?
+		WHERE id = ? AND (next_run_at IS NULL OR next_run_at <= ?)
+	`, until, searchID, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *SQLSearchRepository) SetNextRun(ctx context.Context, searchID int, nextRun time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE user_searches SET next_run_at = ? WHERE id = ?", nextRun, searchID)
+	return err
+}
+
+func (r *SQLSearchRepository) RecordRun(ctx context.Context, searchID int, lastRun, nextRun time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE user_searches SET last_run = ?, next_run_at = ? WHERE id = ?", lastRun, nextRun, searchID)
+	return err
+}
+
+type SQLSentJobRepository struct {
+	db *db.Conn
+}
+
+func (r *SQLSentJobRepository) SeenURLs(ctx context.Context, searchID int) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT job_url FROM sent_jobs WHERE search_id = ?
+		UNION SELECT job_url FROM outbox_jobs WHERE search_id = ?
+		UNION SELECT job_url FROM digest_items WHERE search_id = ?
+	`, searchID, searchID, searchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		seen[url] = true
+	}
+	return seen, rows.Err()
+}
+
+type SQLOutboxRepository struct {
+	db *db.Conn
+}
+
+func (r *SQLOutboxRepository) Enqueue(ctx context.Context, msg *models.OutboxMessage) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := enqueueTx(ctx, tx, msg); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// enqueueTx inserts msg and its matches within tx, so callers can queue a
+// message together with their own changes.
+func enqueueTx(ctx context.Context, tx *db.Tx, msg *models.OutboxMessage) error {
+	var searchID interface{}
+	if msg.SearchID != 0 {
+		searchID = msg.SearchID
+	}
+	if msg.NextAttemptAt.IsZero() {
+		msg.NextAttemptAt = time.Now().UTC()
+	}
+	msg.Status = models.OutboxPending
+
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO email_outbox (user_id, search_id, kind, to_email, user_name, payload, status, attempts, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?)
+		RETURNING id
+	`, msg.UserID, searchID, msg.Kind, msg.ToEmail, msg.UserName, msg.Payload, msg.Status, msg.NextAttemptAt.UTC()).Scan(&msg.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range msg.Matches {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO outbox_jobs (outbox_id, search_id, job_url) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+			msg.ID, m.SearchID, m.JobURL,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLOutboxRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, search_id, kind, to_email, user_name, payload, status, attempts, next_attempt_at, last_error
+		FROM email_outbox
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at
+		LIMIT ?
+	`, models.OutboxPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []models.OutboxMessage
+	for rows.Next() {
+		var msg models.OutboxMessage
+		var searchID sql.NullInt64
+		var lastError sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.UserID, &searchID, &msg.Kind, &msg.ToEmail, &msg.UserName, &msg.Payload, &msg.Status, &msg.Attempts, &msg.NextAttemptAt, &lastError); err != nil {
+			return nil, err
+		}
+		msg.SearchID = int(searchID.Int64)
+		msg.LastError = lastError.String
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+func (r *SQLOutboxRepository) Claim(ctx context.Context, id, attempts int, until time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE email_outbox SET attempts = attempts + 1, next_attempt_at = ?
+		WHERE id = ? AND status = ? AND attempts = ?
+	`, until.UTC(), id, models.OutboxPending, attempts)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *SQLOutboxRepository) MarkDelivered(ctx context.Context, id int, now time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Alerts deleted since the message was queued have no history to keep
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sent_jobs (search_id, job_url)
+		SELECT search_id, job_url FROM outbox_jobs
+		WHERE outbox_id = ? AND search_id IN (SELECT id FROM user_searches)
+		ON CONFLICT DO NOTHING
+	`, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM outbox_jobs WHERE outbox_id = ?", id); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE email_outbox SET status = ?, sent_at = ?, last_error = NULL WHERE id = ?",
+		models.OutboxSent, now.UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLOutboxRepository) RecordFailure(ctx context.Context, id int, status string, next time.Time, lastError string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE email_outbox SET status = ?, next_attempt_at = ?, last_error = ? WHERE id = ?",
+		status, next.UTC(), lastError, id,
+	)
+	return err
+}
+
+type SQLDigestRepository struct {
+	db *db.Conn
+}
+
+func (r *SQLDigestRepository) Add(ctx context.Context, items []models.DigestItem) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, item := range items {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO digest_items (user_id, search_id, job_url, job) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			item.UserID, item.SearchID, item.JobURL, item.Job,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLDigestRepository) ListUsers(ctx context.Context) ([]DigestUser, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.email, u.name, u.digest_frequency, u.last_digest_at
+		FROM users u
+		WHERE u.id IN (SELECT DISTINCT user_id FROM digest_items)
+		ORDER BY u.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []DigestUser
+	for rows.Next() {
+		var u DigestUser
+		var frequency sql.NullString
+		var lastDigest sql.NullTime
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &frequency, &lastDigest); err != nil {
+			return nil, err
+		}
+		u.Frequency = frequency.String
+		if lastDigest.Valid {
+			u.LastDigestAt = &lastDigest.Time
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *SQLDigestRepository) ListItems(ctx context.Context, userID int) ([]DigestEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT d.id, d.user_id, d.search_id, d.job_url, d.job, d.created_at, us.keyword, us.country, us.location
+		FROM digest_items d
+		JOIN user_searches us ON us.id = d.search_id
+		WHERE d.user_id = ? AND us.paused_at IS NULL
+		ORDER BY d.created_at, d.search_id, d.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []DigestEntry
+	for rows.Next() {
+		var e DigestEntry
+		var keyword, country, location sql.NullString
+		if err := rows.Scan(&e.ID, &e.UserID, &e.SearchID, &e.JobURL, &e.Job, &e.CreatedAt, &keyword, &country, &location); err != nil {
+			return nil, err
+		}
+		e.Keyword = keyword.String
+		e.Country = country.String
+		e.Location = location.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *SQLDigestRepository) Delete(ctx context.Context, ids []int) error {
+	for _, id := range ids {
+		if _, err := r.db.ExecContext(ctx, "DELETE FROM digest_items WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLDigestRepository) Flush(ctx context.Context, userID int, itemIDs []int, msg *models.OutboxMessage, now time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The outbox now owns the snapshot, so the items can go in the same tx
+	if err := enqueueTx(ctx, tx, msg); err != nil {
+		return err
+	}
+	for _, id := range itemIDs {
+		res, err := tx.ExecContext(ctx, "DELETE FROM digest_items WHERE id = ? AND user_id = ?", id, userID)
+		if err != nil {
+			return err
+		}
+		// Another instance flushed the same items concurrently
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return ErrDigestTaken
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET last_digest_at = ? WHERE id = ?", now.UTC(), userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type SQLUsageRepository struct {
+	db *db.Conn
+}
+
+// Consume inserts the event first and takes it back if it went over the
+// limit, so concurrent requests can't both slip in under it.
+func (r *SQLUsageRepository) Consume(ctx context.Context, userID int, feature string, now, since time.Time, limit int) (bool, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx,
+		"INSERT INTO usage_events (user_id, feature, created_at) VALUES (?, ?, ?) RETURNING id",
+		userID, feature, now.UTC(),
+	).Scan(&id)
+	if err != nil {
+		return false, err
+	}
+
+	var used int
+	err = r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM usage_events
+		WHERE user_id = ? AND feature = ? AND created_at > ? AND id <= ?
+	`, userID, feature, since.UTC(), id).Scan(&used)
+	if err != nil {
+		return false, err
+	}
+	if used <= limit {
+		return true, nil
+	}
+
+	_, err = r.db.ExecContext(ctx, "DELETE FROM usage_events WHERE id = ?", id)
+	return false, err
+}
+
+func (r *SQLUsageRepository) Window(ctx context.Context, userID int, feature string, since time.Time) (int, time.Time, error) {
+	var used int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM usage_events WHERE user_id = ? AND feature = ? AND created_at > ?",
+		userID, feature, since.UTC(),
+	).Scan(&used)
+	if err != nil || used == 0 {
+		return 0, time.Time{}, err
+	}
+
+	var oldest time.Time
+	err = r.db.QueryRowContext(ctx, `
+		SELECT created_at FROM usage_events
+		WHERE user_id = ? AND feature = ? AND created_at > ?
+		ORDER BY created_at LIMIT 1
+	`, userID, feature, since.UTC()).Scan(&oldest)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Expired between the two queries
+		return 0, time.Time{}, nil
+	}
+	return used, oldest, err
+}
+
+func (r *SQLUsageRepository) Refund(ctx context.Context, userID int, feature string) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM usage_events WHERE id = (
+			SELECT id FROM usage_events WHERE user_id = ? AND feature = ? ORDER BY id DESC LIMIT 1
+		)
+	`, userID, feature)
+	return err
+}
+
+func (r *SQLUsageRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM usage_events WHERE created_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type SQLSubscriptionRepository struct {
+	db *db.Conn
+}
+
+const subscriptionColumns = "id, user_id, customer_id, plan, status, current_period_end, cancel_at_period_end, event_at, updated_at"
+
+func scanSubscription(row scanner) (*models.Subscription, error) {
+	var s models.Subscription
+	var periodEnd sql.NullTime
+	var cancelAtPeriodEnd int
+	err := row.Scan(&s.ID, &s.UserID, &s.CustomerID, &s.Plan, &s.Status, &periodEnd, &cancelAtPeriodEnd, &s.EventAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if periodEnd.Valid {
+		s.CurrentPeriodEnd = periodEnd.Time
+	}
+	s.CancelAtPeriodEnd = cancelAtPeriodEnd != 0
+	return &s, nil
+}
+
+func (r *SQLSubscriptionRepository) Get(ctx context.Context, id string) (*models.Subscription, error) {
+	s, err := scanSubscription(r.db.QueryRowContext(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return s, err
+}
+
+func (r *SQLSubscriptionRepository) ListByUser(ctx context.Context, userID int) ([]models.Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions WHERE user_id = ? ORDER BY updated_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.Subscription{}
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *s)
+	}
+	return subs, rows.Err()
+}
+
+// Save relies on the upsert's WHERE clause so events delivered out of order
+// can't overwrite newer state. Replaying the same event is allowed.
+func (r *SQLSubscriptionRepository) Save(ctx context.Context, s models.Subscription) (bool, error) {
+	if s.UpdatedAt.IsZero() {
+		s.UpdatedAt = time.Now().UTC()
+	}
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO subscriptions (`+subscriptionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			customer_id = excluded.customer_id, plan = excluded.plan, status = excluded.status,
+			current_period_end = excluded.current_period_end, cancel_at_period_end = excluded.cancel_at_period_end,
+			event_at = excluded.event_at, updated_at = excluded.updated_at
+		WHERE subscriptions.event_at <= excluded.event_at
+	`, s.ID, s.UserID, s.CustomerID, s.Plan, s.Status, nullTime(s.CurrentPeriodEnd), boolInt(s.CancelAtPeriodEnd), s.EventAt.UTC(), s.UpdatedAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+type SQLTokenRevocationRepository struct {
+	db *db.Conn
+}
+
+func (r *SQLTokenRevocationRepository) Revoke(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		jti, userID, expiresAt.UTC(), time.Now().UTC(),
+	)
+	return err
+}
+
+func (r *SQLTokenRevocationRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, "SELECT exists(SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti).Scan(&revoked)
+	return revoked, err
+}
+
+func (r *SQLTokenRevocationRepository) Prune(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type SQLSessionRepository struct {
+	db *db.Conn
+}
+
+const sessionColumns = "id, user_id, token_hash, device, user_agent, ip, created_at, last_used_at, expires_at, revoked_at, revoked_reason"
+
+func scanSession(row scanner) (*models.Session, error) {
+	var s models.Session
+	var revokedAt sql.NullTime
+	var reason sql.NullString
+	err := row.Scan(&s.ID, &s.UserID, &s.TokenHash, &s.Device, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &revokedAt, &reason)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	s.RevokedReason = reason.String
+	return &s, nil
+}
+
+func (r *SQLSessionRepository) Create(ctx context.Context, s *models.Session) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO sessions (user_id, token_hash, device, user_agent, ip, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, s.UserID, s.TokenHash, s.Device, s.UserAgent, s.IP, s.CreatedAt.UTC(), s.LastUsedAt.UTC(), s.ExpiresAt.UTC()).Scan(&s.ID)
+}
+
+func (r *SQLSessionRepository) Get(ctx context.Context, id int) (*models.Session, error) {
+	return r.getBy(ctx, "id", id)
+}
+
+func (r *SQLSessionRepository) GetByTokenHash(ctx context.Context, hash string) (*models.Session, error) {
+	return r.getBy(ctx, "token_hash", hash)
+}
+
+func (r *SQLSessionRepository) getBy(ctx context.Context, column string, value interface{}) (*models.Session, error) {
+	s, err := scanSession(r.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE "+column+" = ?", value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return s, err
+}
+
+func (r *SQLSessionRepository) FindRotated(ctx context.Context, hash string) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx, "SELECT session_id FROM session_rotated_tokens WHERE token_hash = ?", hash).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+func (r *SQLSessionRepository) Rotate(ctx context.Context, id int, oldHash, newHash string, now, expiresAt time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE sessions SET token_hash = ?, last_used_at = ?, expires_at = ?
+		WHERE id = ? AND token_hash = ? AND revoked_at IS NULL AND expires_at > ?
+	`, newHash, now.UTC(), expiresAt.UTC(), id, oldHash, now.UTC())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO session_rotated_tokens (token_hash, session_id, rotated_at) VALUES (?, ?, ?)",
+		oldHash, id, now.UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *SQLSessionRepository) ListActive(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC
+	`, userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SQLSessionRepository) Revoke(ctx context.Context, userID, id int, reason string, now time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = ?, revoked_reason = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		now.UTC(), reason, id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRow(res)
+}
+
+func (r *SQLSessionRepository) RevokeAll(ctx context.Context, userID, exceptID int, reason string, now time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = ?, revoked_reason = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL",
+		now.UTC(), reason, userID, exceptID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *SQLSessionRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const stale = "expires_at < ? OR revoked_at < ?"
+	_, err = tx.ExecContext(ctx, "DELETE FROM session_rotated_tokens WHERE session_id IN (SELECT id FROM sessions WHERE "+stale+")", before.UTC(), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE "+stale, before.UTC(), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// boolInt stores booleans as the 0/1 integers the schema uses.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type SQLUserTokenRepository struct {
+	db *db.Conn
+}
+
+func (r *SQLUserTokenRepository) Create(ctx context.Context, t *models.UserToken) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO user_tokens (id, user_id, purpose, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		t.ID, t.UserID, t.Purpose, t.CreatedAt.UTC(), t.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// Consume is a single conditional UPDATE, so two requests racing with the
+// same token can't both succeed.
+func (r *SQLUserTokenRepository) Consume(ctx context.Context, id, purpose string, now time.Time) (int, error) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE user_tokens SET used_at = ?
+		WHERE id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id
+	`, now.UTC(), id, purpose, now.UTC()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
+
+func (r *SQLUserTokenRepository) Invalidate(ctx context.Context, userID int, purpose string, now time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		now.UTC(), userID, purpose,
+	)
+	return err
+}
+
+func (r *SQLUserTokenRepository) IssuedSince(ctx context.Context, userID int, purpose string, since time.Time) ([]time.Time, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT created_at FROM user_tokens WHERE user_id = ? AND purpose = ? AND created_at > ? ORDER BY created_at",
+		userID, purpose, since.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var issued []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		issued = append(issued, t)
+	}
+	return issued, rows.Err()
+}
+
+func (r *SQLUserTokenRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM user_tokens WHERE expires_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func expectRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type SQLLoginAttemptRepository struct {
+	db *db.Conn
+}
+
+const loginFailureColumns = "scope, subject, failures, first_failed_at, last_failed_at, locked_until"
+
+func scanLoginFailure(row scanner) (*models.LoginFailure, error) {
+	var f models.LoginFailure
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&f.Scope, &f.Subject, &f.Failures, &f.FirstFailedAt, &f.LastFailedAt, &lockedUntil); err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		f.LockedUntil = &lockedUntil.Time
+	}
+	return &f, nil
+}
+
+func (r *SQLLoginAttemptRepository) Get(ctx context.Context, scope, subject string) (*models.LoginFailure, error) {
+	f, err := scanLoginFailure(r.db.QueryRowContext(ctx,
+		"SELECT "+loginFailureColumns+" FROM login_failures WHERE scope = ? AND subject = ?", scope, subject))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// RecordFailure is a single upsert so concurrent failures are all counted.
+func (r *SQLLoginAttemptRepository) RecordFailure(ctx context.Context, scope, subject string, now, since time.Time) (*models.LoginFailure, error) {
+	return scanLoginFailure(r.db.QueryRowContext(ctx, `
+		INSERT INTO login_failures (scope, subject, failures, first_failed_at, last_failed_at)
+		VALUES (?, ?, 1, ?, ?)
+		ON CONFLICT (scope, subject) DO UPDATE SET
+			failures = CASE WHEN login_failures.last_failed_at < ? THEN 1 ELSE login_failures.failures + 1 END,
+			first_failed_at = CASE WHEN login_failures.last_failed_at < ? THEN excluded.first_failed_at ELSE login_failures.first_failed_at END,
+			last_failed_at = excluded.last_failed_at
+		RETURNING `+loginFailureColumns,
+		scope, subject, now.UTC(), now.UTC(), since.UTC(), since.UTC()))
+}
+
+func (r *SQLLoginAttemptRepository) Lock(ctx context.Context, scope, subject string, now, until time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE login_failures SET locked_until = ?
+		WHERE scope = ? AND subject = ? AND (locked_until IS NULL OR locked_until <= ?)
+	`, until.UTC(), scope, subject, now.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *SQLLoginAttemptRepository) Clear(ctx context.Context, scope, subject string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_failures WHERE scope = ? AND subject = ?", scope, subject)
+	return err
+}
+
+func (r *SQLLoginAttemptRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		"DELETE FROM login_failures WHERE last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)",
+		before.UTC(), before.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *SQLLoginAttemptRepository) RecordLockout(ctx context.Context, l *models.Lockout) error {
+	var userID interface{}
+	if l.UserID != 0 {
+		userID = l.UserID
+	}
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO login_lockouts (scope, subject, user_id, ip, failures, locked_at, locked_until)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id
+	`, l.Scope, l.Subject, userID, l.IP, l.Failures, l.LockedAt.UTC(), l.LockedUntil.UTC()).Scan(&l.ID)
+}
+
+func (r *SQLLoginAttemptRepository) MarkUnlocked(ctx context.Context, scope, subject, method string, now time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE login_lockouts SET unlocked_at = ?, unlocked_by = ?
+		WHERE scope = ? AND subject = ? AND unlocked_at IS NULL AND locked_until > ?
+	`, now.UTC(), method, scope, subject, now.UTC())
+	return err
+}
+
+type SQLMFARepository struct {
+	db *db.Conn
+}
+
+func (r *SQLMFARepository) Get(ctx context.Context, userID int) (*models.MFA, error) {
+	var m models.MFA
+	var enabledAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		"SELECT user_id, secret, created_at, enabled_at, last_counter FROM user_mfa WHERE user_id = ?", userID,
+	).Scan(&m.UserID, &m.Secret, &m.CreatedAt, &enabledAt, &m.LastCounter)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		m.EnabledAt = &enabledAt.Time
+	}
+	return &m, nil
+}
+
+func (r *SQLMFARepository) SavePending(ctx context.Context, userID int, secret string, now time.Time) error {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_mfa (user_id, secret, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at, last_counter = 0
+		WHERE user_mfa.enabled_at IS NULL
+	`, userID, secret, now.UTC())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrMFAEnabled
+	}
+	return nil
+}
+
+func (r *SQLMFARepository) Enable(ctx context.Context, userID int, counter int64, recoveryHashes []string, now time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE user_mfa SET enabled_at = ?, last_counter = ? WHERE user_id = ? AND enabled_at IS NULL",
+		now.UTC(), counter, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(res); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLMFARepository) UseCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE user_mfa SET last_counter = ? WHERE user_id = ? AND last_counter < ?",
+		counter, userID, counter,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *SQLMFARepository) UseRecoveryCode(ctx context.Context, userID int, hash string, now time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now.UTC(), userID, hash,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *SQLMFARepository) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&n)
+	return n, err
+}
+
+func (r *SQLMFARepository) Delete(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type SQLIdentityRepository struct {
+	db *db.Conn
+}
+
+func (r *SQLIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	var i models.Identity
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identities WHERE provider = ? AND subject = ?
+	`, provider, subject).Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return &i, err
+}
+
+func (r *SQLIdentityRepository) Create(ctx context.Context, i *models.Identity) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id
+	`, i.UserID, i.Provider, i.Subject, i.Email, i.CreatedAt.UTC(), i.LastLoginAt.UTC()).Scan(&i.ID)
+}
+
+func (r *SQLIdentityRepository) RecordLogin(ctx context.Context, id int, email string, now time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE user_identities SET email = ?, last_login_at = ? WHERE id = ?",
+		email, now.UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRow(res)
+}
+
+type SQLAPIKeyRepository struct {
+	db *db.Conn
+}
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, created_at, last_used_at, revoked_at"
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Hash, &scopes, &k.CreatedAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return &k, nil
+}
+
+func (r *SQLAPIKeyRepository) Create(ctx context.Context, k *models.APIKey) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id
+	`, k.UserID, k.Name, k.Prefix, k.Hash, strings.Join(k.Scopes, " "), k.CreatedAt.UTC()).Scan(&k.ID)
+}
+
+func (r *SQLAPIKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = ?", prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return k, err
+}
+
+func (r *SQLAPIKeyRepository) ListActive(ctx context.Context, userID int) ([]models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *SQLAPIKeyRepository) Revoke(ctx context.Context, userID, id int, now time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		now.UTC(), id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRow(res)
+}
+
+func (r *SQLAPIKeyRepository) RevokeAll(ctx context.Context, userID int, now time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		now.UTC(), userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *SQLAPIKeyRepository) Touch(ctx context.Context, id int, now, since time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		now.UTC(), id, since.UTC(),
+	)
+	return err
+}
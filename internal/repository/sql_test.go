@@ -0,0 +1,930 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/db"
+	"jobseek-web-be/internal/models"
+)
+
+// forEachStore runs fn against the in-memory store, a migrated SQLite
+// :memory: database and, when TEST_DATABASE_URL is set, a migrated schema
+// of its own in that Postgres database.
+func forEachStore(t *testing.T, fn func(t *testing.T, store *Store)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		conn, err := db.OpenSQLite(":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		migrate(t, conn)
+		fn(t, NewSQLStore(conn))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL not set")
+		}
+		fn(t, NewSQLStore(openPostgresSchema(t, dsn)))
+	})
+}
+
+// migrate applies every migration to conn. MigrateUp works on db.DB, so
+// the stores under test can't run in parallel.
+func migrate(t *testing.T, conn *db.Conn) {
+	t.Helper()
+	prev := db.DB
+	db.DB = conn
+	t.Cleanup(func() { db.DB = prev })
+	if _, err := db.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openPostgresSchema creates a throwaway schema, dropped after the test, and
+// returns a migrated connection whose search_path points at it.
+func openPostgresSchema(t *testing.T, dsn string) *db.Conn {
+	t.Helper()
+	admin, err := db.OpenPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(b)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("dropping %s: %v", schema, err)
+		}
+	})
+
+	switch {
+	case !strings.Contains(dsn, "://"):
+		dsn += " search_path=" + schema
+	case strings.Contains(dsn, "?"):
+		dsn += "&search_path=" + schema
+	default:
+		dsn += "?search_path=" + schema
+	}
+	conn, err := db.OpenPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	migrate(t, conn)
+	return conn
+}
+
+func createUser(t *testing.T, store *Store, email string) models.User {
+	t.Helper()
+	u := models.User{Name: "Test User", Email: email, Password: "hash"}
+	if err := store.Users.Create(context.Background(), &u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func createSearch(t *testing.T, store *Store, userID int, keyword string) models.UserSearch {
+	t.Helper()
+	s := models.UserSearch{UserID: userID, Keyword: keyword, Country: "Germany", Location: "Berlin", Frequency: "hourly", Timezone: "UTC"}
+	if err := store.Searches.Create(context.Background(), &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		if u.ID == 0 || u.CreatedAt.IsZero() {
+			t.Fatalf("Create didn't fill in ID and CreatedAt: %+v", u)
+		}
+
+		dup := models.User{Name: "Other", Email: "alice@example.com", Password: "hash"}
+		if err := store.Users.Create(ctx, &dup); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("duplicate email: got %v, want ErrEmailTaken", err)
+		}
+		if ok, err := store.Users.EmailExists(ctx, "alice@example.com"); err != nil || !ok {
+			t.Errorf("EmailExists = %v, %v", ok, err)
+		}
+		if _, err := store.Users.GetByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("unknown email: got %v, want ErrNotFound", err)
+		}
+
+		if err := store.Users.SetPlan(ctx, u.ID, "pro", true); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Users.SetDigestFrequency(ctx, u.ID, "weekly"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Users.BumpTokenVersion(ctx, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		first := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+		if err := store.Users.MarkEmailVerified(ctx, u.ID, first); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Users.MarkEmailVerified(ctx, u.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Users.GetByID(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.SubscriptionPlan != "pro" || !got.Paid || got.DigestFrequency != "weekly" || got.TokenVersion != u.TokenVersion+1 {
+			t.Errorf("updates not stored: %+v", got)
+		}
+		if got.EmailVerifiedAt == nil || !got.EmailVerifiedAt.Equal(first) {
+			t.Errorf("verified at %v, want the first confirmation %v", got.EmailVerifiedAt, first)
+		}
+	})
+}
+
+func TestSearches(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice@example.com")
+		bob := createUser(t, store, "bob@example.com")
+		first := createSearch(t, store, alice.ID, "golang")
+		second := createSearch(t, store, alice.ID, "rust")
+
+		list, err := store.Searches.ListByUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].ID != second.ID || list[1].ID != first.ID {
+			t.Errorf("ListByUser = %+v, want newest first", list)
+		}
+
+		if id, err := store.Searches.FindDuplicate(ctx, models.UserSearch{UserID: alice.ID, Keyword: "golang", Country: "Germany", Location: "Berlin"}); err != nil || id != first.ID {
+			t.Errorf("FindDuplicate = %d, %v, want %d", id, err, first.ID)
+		}
+		if _, err := store.Searches.FindDuplicate(ctx, models.UserSearch{UserID: bob.ID, Keyword: "golang", Country: "Germany", Location: "Berlin"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("another user's search counted as a duplicate: %v", err)
+		}
+
+		// Both were never run, so both are due, oldest first
+		now := time.Now()
+		due, err := store.Searches.ListDue(ctx, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 2 || due[0].ID != first.ID || due[0].UserEmail != alice.Email || due[0].Position != 0 || due[1].Position != 1 {
+			t.Fatalf("ListDue = %+v", due)
+		}
+
+		until := now.Add(time.Minute)
+		if ok, err := store.Searches.Claim(ctx, first.ID, now, until); err != nil || !ok {
+			t.Fatalf("Claim = %v, %v", ok, err)
+		}
+		if ok, _ := store.Searches.Claim(ctx, first.ID, now, until); ok {
+			t.Error("a search was claimed twice")
+		}
+		if err := store.Searches.RecordRun(ctx, second.ID, now, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if due, err := store.Searches.ListDue(ctx, now); err != nil || len(due) != 0 {
+			t.Errorf("ListDue after claiming and running = %+v, %v", due, err)
+		}
+		if err := store.Searches.SetNextRun(ctx, first.ID, now.Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if due, err := store.Searches.ListDue(ctx, now); err != nil || len(due) != 1 || due[0].ID != first.ID {
+			t.Errorf("ListDue after rescheduling = %+v, %v", due, err)
+		}
+
+		if err := store.Searches.Delete(ctx, bob.ID, first.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting another user's search: got %v, want ErrNotFound", err)
+		}
+		if err := store.Searches.Delete(ctx, alice.ID, first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Searches.Delete(ctx, alice.ID, first.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting twice: got %v, want ErrNotFound", err)
+		}
+		if err := store.Searches.DeleteAllForUser(ctx, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if list, err := store.Searches.ListByUser(ctx, alice.ID); err != nil || len(list) != 0 {
+			t.Errorf("ListByUser after deleting all = %+v, %v", list, err)
+		}
+	})
+}
+
+func TestPausedSearches(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice@example.com")
+		bob := createUser(t, store, "bob@example.com")
+		first := createSearch(t, store, alice.ID, "golang")
+		second := createSearch(t, store, alice.ID, "rust")
+		now := time.Now().UTC().Truncate(time.Second)
+		item := models.DigestItem{UserID: alice.ID, SearchID: first.ID, JobURL: "https://jobs.example/1", Job: "{}", CreatedAt: now}
+		if err := store.Digests.Add(ctx, []models.DigestItem{item}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Searches.Pause(ctx, bob.ID, first.ID, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("pausing another user's search: got %v, want ErrNotFound", err)
+		}
+		if err := store.Searches.Pause(ctx, alice.ID, first.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		// Pausing again keeps the first pause
+		if err := store.Searches.Pause(ctx, alice.ID, first.ID, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		list, err := store.Searches.ListByUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[1].PausedAt == nil || !list[1].PausedAt.Equal(now) || list[0].PausedAt != nil {
+			t.Fatalf("ListByUser = %+v, want only the first search paused at %s", list, now)
+		}
+
+		// Paused searches don't run, and their held items wait
+		if due, err := store.Searches.ListDue(ctx, now); err != nil || len(due) != 1 || due[0].ID != second.ID {
+			t.Errorf("ListDue = %+v, %v, want only the second search", due, err)
+		}
+		if entries, err := store.Digests.ListItems(ctx, alice.ID); err != nil || len(entries) != 0 {
+			t.Errorf("ListItems of a paused search = %+v, %v", entries, err)
+		}
+
+		if err := store.Searches.PauseAllForUser(ctx, alice.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		if due, err := store.Searches.ListDue(ctx, now); err != nil || len(due) != 0 {
+			t.Errorf("ListDue after pausing all = %+v, %v", due, err)
+		}
+
+		if err := store.Searches.Resume(ctx, bob.ID, first.ID, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("resuming another user's search: got %v, want ErrNotFound", err)
+		}
+		if err := store.Searches.Resume(ctx, alice.ID, first.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		if due, err := store.Searches.ListDue(ctx, now); err != nil || len(due) != 1 || due[0].ID != first.ID || due[0].PausedAt != nil {
+			t.Errorf("ListDue after resuming = %+v, %v", due, err)
+		}
+		if entries, err := store.Digests.ListItems(ctx, alice.ID); err != nil || len(entries) != 1 {
+			t.Errorf("ListItems after resuming = %+v, %v", entries, err)
+		}
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		s := createSearch(t, store, u.ID, "golang")
+		gone := createSearch(t, store, u.ID, "rust")
+
+		now := time.Now().UTC().Truncate(time.Second)
+		msg := &models.OutboxMessage{
+			UserID: u.ID, SearchID: s.ID, Kind: "alert", ToEmail: u.Email, UserName: u.Name, Payload: "{}",
+			NextAttemptAt: now.Add(-time.Minute),
+			Matches: []models.JobMatch{
+				{SearchID: s.ID, JobURL: "https://jobs.example/1"},
+				{SearchID: gone.ID, JobURL: "https://jobs.example/2"},
+			},
+		}
+		if err := store.Outbox.Enqueue(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID == 0 || msg.Status != models.OutboxPending {
+			t.Fatalf("Enqueue didn't fill in ID and status: %+v", msg)
+		}
+		if seen, err := store.SentJobs.SeenURLs(ctx, s.ID); err != nil || !seen["https://jobs.example/1"] {
+			t.Errorf("queued job not seen: %v, %v", seen, err)
+		}
+
+		due, err := store.Outbox.ListDue(ctx, now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0].ID != msg.ID || due[0].SearchID != s.ID || due[0].Attempts != 0 {
+			t.Fatalf("ListDue = %+v", due)
+		}
+
+		if ok, err := store.Outbox.Claim(ctx, msg.ID, 0, now.Add(time.Minute)); err != nil || !ok {
+			t.Fatalf("Claim = %v, %v", ok, err)
+		}
+		if ok, _ := store.Outbox.Claim(ctx, msg.ID, 0, now.Add(time.Minute)); ok {
+			t.Error("a message was claimed twice")
+		}
+		if due, err := store.Outbox.ListDue(ctx, now, 10); err != nil || len(due) != 0 {
+			t.Errorf("claimed message still due: %+v, %v", due, err)
+		}
+
+		if err := store.Outbox.RecordFailure(ctx, msg.ID, models.OutboxPending, now, "smtp down"); err != nil {
+			t.Fatal(err)
+		}
+		due, err = store.Outbox.ListDue(ctx, now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0].Attempts != 1 || due[0].LastError != "smtp down" {
+			t.Fatalf("after a failure ListDue = %+v", due)
+		}
+
+		// The alert deleted in the meantime gets no sent_jobs history
+		if err := store.Searches.Delete(ctx, u.ID, gone.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Outbox.MarkDelivered(ctx, msg.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		if due, err := store.Outbox.ListDue(ctx, now.Add(time.Hour), 10); err != nil || len(due) != 0 {
+			t.Errorf("delivered message still due: %+v, %v", due, err)
+		}
+		if seen, err := store.SentJobs.SeenURLs(ctx, s.ID); err != nil || len(seen) != 1 || !seen["https://jobs.example/1"] {
+			t.Errorf("delivered job not recorded as sent: %v, %v", seen, err)
+		}
+		if seen, err := store.SentJobs.SeenURLs(ctx, gone.ID); err != nil || len(seen) != 0 {
+			t.Errorf("deleted alert has sent jobs: %v, %v", seen, err)
+		}
+
+		dead := &models.OutboxMessage{UserID: u.ID, Kind: "digest", ToEmail: u.Email, Payload: "{}", NextAttemptAt: now}
+		if err := store.Outbox.Enqueue(ctx, dead); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Outbox.RecordFailure(ctx, dead.ID, models.OutboxDead, now, "bounced"); err != nil {
+			t.Fatal(err)
+		}
+		if due, err := store.Outbox.ListDue(ctx, now.Add(time.Hour), 10); err != nil || len(due) != 0 {
+			t.Errorf("dead message still due: %+v, %v", due, err)
+		}
+	})
+}
+
+func TestDigests(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		s := createSearch(t, store, u.ID, "golang")
+		if err := store.Users.SetDigestFrequency(ctx, u.ID, "daily"); err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		item := func(url string, age time.Duration) models.DigestItem {
+			return models.DigestItem{UserID: u.ID, SearchID: s.ID, JobURL: url, Job: "{}", CreatedAt: now.Add(-age)}
+		}
+		items := []models.DigestItem{item("https://jobs.example/1", 2*time.Hour), item("https://jobs.example/2", time.Hour), item("https://jobs.example/3", time.Minute)}
+		if err := store.Digests.Add(ctx, items); err != nil {
+			t.Fatal(err)
+		}
+		// Held jobs are ignored when found again
+		if err := store.Digests.Add(ctx, items[:1]); err != nil {
+			t.Fatal(err)
+		}
+		if seen, err := store.SentJobs.SeenURLs(ctx, s.ID); err != nil || len(seen) != 3 {
+			t.Errorf("held jobs not seen: %v, %v", seen, err)
+		}
+
+		users, err := store.Digests.ListUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].ID != u.ID || users[0].Email != u.Email || users[0].Frequency != "daily" || users[0].LastDigestAt != nil {
+			t.Fatalf("ListUsers = %+v", users)
+		}
+
+		entries, err := store.Digests.ListItems(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 3 || entries[0].JobURL != "https://jobs.example/1" || entries[2].JobURL != "https://jobs.example/3" || entries[0].Keyword != "golang" || entries[0].Location != "Berlin" {
+			t.Fatalf("ListItems = %+v", entries)
+		}
+
+		if err := store.Digests.Delete(ctx, []int{entries[2].ID}); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := &models.OutboxMessage{UserID: u.ID, Kind: "digest", ToEmail: u.Email, Payload: "{}", NextAttemptAt: now}
+		ids := []int{entries[0].ID, entries[1].ID}
+		if err := store.Digests.Flush(ctx, u.ID, ids, msg, now); err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID == 0 {
+			t.Error("Flush didn't queue the message")
+		}
+		if users, err := store.Digests.ListUsers(ctx); err != nil || len(users) != 0 {
+			t.Errorf("ListUsers after flushing = %+v, %v", users, err)
+		}
+
+		// A second flush of the same items queues nothing
+		again := &models.OutboxMessage{UserID: u.ID, Kind: "digest", ToEmail: u.Email, Payload: "{}", NextAttemptAt: now}
+		if err := store.Digests.Flush(ctx, u.ID, ids, again, now); !errors.Is(err, ErrDigestTaken) {
+			t.Errorf("second flush: got %v, want ErrDigestTaken", err)
+		}
+		if due, err := store.Outbox.ListDue(ctx, now, 10); err != nil || len(due) != 1 {
+			t.Errorf("ListDue = %+v, %v, want only the first digest", due, err)
+		}
+
+		if err := store.Digests.Add(ctx, []models.DigestItem{item("https://jobs.example/4", 0)}); err != nil {
+			t.Fatal(err)
+		}
+		users, err = store.Digests.ListUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].LastDigestAt == nil || !users[0].LastDigestAt.Equal(now) {
+			t.Errorf("last digest not recorded: %+v", users)
+		}
+	})
+}
+
+func TestUsage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		now := time.Now().UTC().Truncate(time.Second)
+		since := now.Add(-time.Hour)
+
+		for i := 0; i < 2; i++ {
+			at := now.Add(time.Duration(i-2) * time.Minute)
+			if ok, err := store.Usage.Consume(ctx, u.ID, "search", at, since, 2); err != nil || !ok {
+				t.Fatalf("use %d: Consume = %v, %v", i, ok, err)
+			}
+		}
+		if ok, err := store.Usage.Consume(ctx, u.ID, "search", now, since, 2); err != nil || ok {
+			t.Errorf("use over the limit: Consume = %v, %v", ok, err)
+		}
+		// Other features have their own quota
+		if ok, err := store.Usage.Consume(ctx, u.ID, "cv", now, since, 1); err != nil || !ok {
+			t.Errorf("other feature: Consume = %v, %v", ok, err)
+		}
+
+		used, oldest, err := store.Usage.Window(ctx, u.ID, "search", since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != 2 || !oldest.Equal(now.Add(-2*time.Minute)) {
+			t.Errorf("Window = %d, %v", used, oldest)
+		}
+
+		if err := store.Usage.Refund(ctx, u.ID, "search"); err != nil {
+			t.Fatal(err)
+		}
+		if used, oldest, err := store.Usage.Window(ctx, u.ID, "search", since); err != nil || used != 1 || !oldest.Equal(now.Add(-2*time.Minute)) {
+			t.Errorf("after a refund Window = %d, %v, %v, want the latest use gone", used, oldest, err)
+		}
+		if ok, err := store.Usage.Consume(ctx, u.ID, "search", now, since, 2); err != nil || !ok {
+			t.Errorf("refunded use: Consume = %v, %v", ok, err)
+		}
+
+		n, err := store.Usage.Prune(ctx, now.Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("Prune deleted %d, want 1", n)
+		}
+		if used, _, err := store.Usage.Window(ctx, u.ID, "search", time.Time{}); err != nil || used != 1 {
+			t.Errorf("after pruning Window = %d, %v", used, err)
+		}
+	})
+}
+
+func TestSubscriptions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		now := time.Now().UTC().Truncate(time.Second)
+
+		sub := models.Subscription{ID: "sub_1", UserID: u.ID, CustomerID: "cus_1", Plan: "basic", Status: "active", CurrentPeriodEnd: now.Add(30 * 24 * time.Hour), EventAt: now}
+		if ok, err := store.Subscriptions.Save(ctx, sub); err != nil || !ok {
+			t.Fatalf("Save = %v, %v", ok, err)
+		}
+		// Replaying the event is allowed
+		if ok, err := store.Subscriptions.Save(ctx, sub); err != nil || !ok {
+			t.Errorf("replay: Save = %v, %v", ok, err)
+		}
+
+		newer := sub
+		newer.Plan, newer.CancelAtPeriodEnd, newer.EventAt = "pro", true, now.Add(time.Minute)
+		if ok, err := store.Subscriptions.Save(ctx, newer); err != nil || !ok {
+			t.Fatalf("newer event: Save = %v, %v", ok, err)
+		}
+		older := sub
+		older.Status = "canceled"
+		if ok, err := store.Subscriptions.Save(ctx, older); err != nil || ok {
+			t.Errorf("older event: Save = %v, %v, want it ignored", ok, err)
+		}
+
+		got, err := store.Subscriptions.Get(ctx, "sub_1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Plan != "pro" || got.Status != "active" || !got.CancelAtPeriodEnd || !got.CurrentPeriodEnd.Equal(sub.CurrentPeriodEnd) {
+			t.Errorf("Get = %+v", got)
+		}
+		if _, err := store.Subscriptions.Get(ctx, "sub_2"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("unknown subscription: got %v, want ErrNotFound", err)
+		}
+		if subs, err := store.Subscriptions.ListByUser(ctx, u.ID); err != nil || len(subs) != 1 {
+			t.Errorf("ListByUser = %+v, %v", subs, err)
+		}
+	})
+}
+
+func TestRevocations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		now := time.Now()
+
+		if err := store.Revocations.Revoke(ctx, "expired", u.ID, now.Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Revocations.Revoke(ctx, "live", u.ID, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := store.Revocations.IsRevoked(ctx, "live"); err != nil || !ok {
+			t.Errorf("IsRevoked(live) = %v, %v", ok, err)
+		}
+		if ok, err := store.Revocations.IsRevoked(ctx, "other"); err != nil || ok {
+			t.Errorf("IsRevoked(other) = %v, %v", ok, err)
+		}
+		if n, err := store.Revocations.Prune(ctx, now); err != nil || n != 1 {
+			t.Errorf("Prune = %d, %v, want 1", n, err)
+		}
+		if ok, err := store.Revocations.IsRevoked(ctx, "live"); err != nil || !ok {
+			t.Errorf("live token pruned: %v, %v", ok, err)
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		now := time.Now().UTC().Truncate(time.Second)
+		newSession := func(hash string, lastUsed time.Time) *models.Session {
+			s := &models.Session{UserID: u.ID, TokenHash: hash, Device: "laptop", CreatedAt: now, LastUsedAt: lastUsed, ExpiresAt: now.Add(time.Hour)}
+			if err := store.Sessions.Create(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+		older := newSession("a1", now.Add(-time.Minute))
+		newer := newSession("b1", now)
+
+		if s, err := store.Sessions.GetByTokenHash(ctx, "a1"); err != nil || s.ID != older.ID || s.Device != "laptop" {
+			t.Errorf("GetByTokenHash = %+v, %v", s, err)
+		}
+		if ok, err := store.Sessions.Rotate(ctx, older.ID, "a1", "a2", now, now.Add(2*time.Hour)); err != nil || !ok {
+			t.Fatalf("Rotate = %v, %v", ok, err)
+		}
+		if ok, err := store.Sessions.Rotate(ctx, older.ID, "a1", "a3", now, now.Add(2*time.Hour)); err != nil || ok {
+			t.Errorf("rotating a rotated-out token: Rotate = %v, %v", ok, err)
+		}
+		if _, err := store.Sessions.GetByTokenHash(ctx, "a1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("rotated-out token still current: %v", err)
+		}
+		if id, err := store.Sessions.FindRotated(ctx, "a1"); err != nil || id != older.ID {
+			t.Errorf("FindRotated = %d, %v", id, err)
+		}
+		if _, err := store.Sessions.FindRotated(ctx, "a2"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("current token found as rotated: %v", err)
+		}
+
+		active, err := store.Sessions.ListActive(ctx, u.ID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(active) != 2 || active[0].ID != older.ID {
+			t.Errorf("ListActive = %+v, want the rotated session first", active)
+		}
+
+		if err := store.Sessions.Revoke(ctx, u.ID+1, newer.ID, "logout", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revoking another user's session: got %v, want ErrNotFound", err)
+		}
+		if err := store.Sessions.Revoke(ctx, u.ID, newer.ID, "logout", now); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Sessions.Revoke(ctx, u.ID, newer.ID, "logout", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revoking twice: got %v, want ErrNotFound", err)
+		}
+		if s, err := store.Sessions.Get(ctx, newer.ID); err != nil || s.RevokedAt == nil || s.RevokedReason != "logout" {
+			t.Errorf("revoked session = %+v, %v", s, err)
+		}
+		if ok, err := store.Sessions.Rotate(ctx, newer.ID, "b1", "b2", now, now.Add(time.Hour)); err != nil || ok {
+			t.Errorf("rotating a revoked session: Rotate = %v, %v", ok, err)
+		}
+
+		third := newSession("c1", now)
+		if n, err := store.Sessions.RevokeAll(ctx, u.ID, third.ID, "password_changed", now); err != nil || n != 1 {
+			t.Errorf("RevokeAll = %d, %v, want 1", n, err)
+		}
+		if active, err := store.Sessions.ListActive(ctx, u.ID, now); err != nil || len(active) != 1 || active[0].ID != third.ID {
+			t.Errorf("ListActive after RevokeAll = %+v, %v", active, err)
+		}
+
+		if n, err := store.Sessions.Prune(ctx, now.Add(time.Second)); err != nil || n != 2 {
+			t.Errorf("Prune = %d, %v, want the 2 revoked sessions", n, err)
+		}
+		if _, err := store.Sessions.FindRotated(ctx, "a1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("rotated token of a pruned session kept: %v", err)
+		}
+	})
+}
+
+func TestUserTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		now := time.Now().UTC().Truncate(time.Second)
+		issue := func(id, purpose string, created time.Time, ttl time.Duration) {
+			tok := &models.UserToken{ID: id, UserID: u.ID, Purpose: purpose, CreatedAt: created, ExpiresAt: created.Add(ttl)}
+			if err := store.UserTokens.Create(ctx, tok); err != nil {
+				t.Fatal(err)
+			}
+		}
+		issue("t1", "verify_email", now.Add(-2*time.Hour), time.Hour)
+		issue("t2", "verify_email", now.Add(-time.Minute), time.Hour)
+		issue("t3", "verify_email", now, time.Hour)
+		issue("r1", "reset_password", now, time.Hour)
+
+		if _, err := store.UserTokens.Consume(ctx, "t1", "verify_email", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expired token: got %v, want ErrNotFound", err)
+		}
+		if _, err := store.UserTokens.Consume(ctx, "r1", "verify_email", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("token for another purpose: got %v, want ErrNotFound", err)
+		}
+		if id, err := store.UserTokens.Consume(ctx, "t2", "verify_email", now); err != nil || id != u.ID {
+			t.Errorf("Consume = %d, %v", id, err)
+		}
+		if _, err := store.UserTokens.Consume(ctx, "t2", "verify_email", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("used token: got %v, want ErrNotFound", err)
+		}
+
+		if err := store.UserTokens.Invalidate(ctx, u.ID, "verify_email", now); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.UserTokens.Consume(ctx, "t3", "verify_email", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalidated token: got %v, want ErrNotFound", err)
+		}
+		if _, err := store.UserTokens.Consume(ctx, "r1", "reset_password", now); err != nil {
+			t.Errorf("token for another purpose invalidated: %v", err)
+		}
+
+		issued, err := store.UserTokens.IssuedSince(ctx, u.ID, "verify_email", now.Add(-time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issued) != 2 || !issued[0].Equal(now.Add(-time.Minute)) || !issued[1].Equal(now) {
+			t.Errorf("IssuedSince = %v", issued)
+		}
+
+		if n, err := store.UserTokens.Prune(ctx, now); err != nil || n != 1 {
+			t.Errorf("Prune = %d, %v, want 1", n, err)
+		}
+	})
+}
+
+func TestLoginAttempts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		now := time.Now().UTC().Truncate(time.Second)
+		window := 15 * time.Minute
+
+		if _, err := store.LoginAttempts.Get(ctx, "ip", "192.0.2.1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("no failures: got %v, want ErrNotFound", err)
+		}
+		for i := 1; i <= 3; i++ {
+			f, err := store.LoginAttempts.RecordFailure(ctx, "ip", "192.0.2.1", now, now.Add(-window))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Failures != i {
+				t.Errorf("failure %d counted as %d", i, f.Failures)
+			}
+		}
+		// Failures outside the window are forgotten
+		later := now.Add(window + time.Minute)
+		if f, err := store.LoginAttempts.RecordFailure(ctx, "ip", "192.0.2.1", later, later.Add(-window)); err != nil || f.Failures != 1 {
+			t.Errorf("after the window RecordFailure = %+v, %v, want a fresh count", f, err)
+		}
+
+		until := later.Add(time.Hour)
+		if ok, err := store.LoginAttempts.Lock(ctx, "ip", "192.0.2.1", later, until); err != nil || !ok {
+			t.Fatalf("Lock = %v, %v", ok, err)
+		}
+		if ok, err := store.LoginAttempts.Lock(ctx, "ip", "192.0.2.1", later, until.Add(time.Hour)); err != nil || ok {
+			t.Errorf("locking while locked: Lock = %v, %v", ok, err)
+		}
+		if f, err := store.LoginAttempts.Get(ctx, "ip", "192.0.2.1"); err != nil || f.LockedUntil == nil || !f.LockedUntil.Equal(until) {
+			t.Errorf("Get = %+v, %v", f, err)
+		}
+
+		l := &models.Lockout{Scope: "ip", Subject: "192.0.2.1", IP: "192.0.2.1", Failures: 1, LockedAt: later, LockedUntil: until}
+		if err := store.LoginAttempts.RecordLockout(ctx, l); err != nil || l.ID == 0 {
+			t.Errorf("RecordLockout = %v, ID %d", err, l.ID)
+		}
+		if err := store.LoginAttempts.MarkUnlocked(ctx, "ip", "192.0.2.1", "support", later); err != nil {
+			t.Error(err)
+		}
+
+		// Counts are pruned only once their lock has ended too
+		if n, err := store.LoginAttempts.Prune(ctx, later.Add(time.Minute)); err != nil || n != 0 {
+			t.Errorf("Prune during the lock = %d, %v, want 0", n, err)
+		}
+		if n, err := store.LoginAttempts.Prune(ctx, until.Add(time.Minute)); err != nil || n != 1 {
+			t.Errorf("Prune after the lock = %d, %v, want 1", n, err)
+		}
+
+		if _, err := store.LoginAttempts.RecordFailure(ctx, "account", "alice@example.com", now, now.Add(-window)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.LoginAttempts.Clear(ctx, "account", "alice@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.LoginAttempts.Get(ctx, "account", "alice@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("after Clear: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestMFA(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		now := time.Now().UTC().Truncate(time.Second)
+
+		if _, err := store.MFA.Get(ctx, u.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("not enrolled: got %v, want ErrNotFound", err)
+		}
+		if err := store.MFA.SavePending(ctx, u.ID, "FIRST", now); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.MFA.SavePending(ctx, u.ID, "SECOND", now); err != nil {
+			t.Fatal(err)
+		}
+		m, err := store.MFA.Get(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Secret != "SECOND" || m.EnabledAt != nil {
+			t.Errorf("pending enrollment = %+v", m)
+		}
+
+		if err := store.MFA.Enable(ctx, u.ID, 100, []string{"h1", "h2"}, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.MFA.SavePending(ctx, u.ID, "THIRD", now); !errors.Is(err, ErrMFAEnabled) {
+			t.Errorf("re-enrolling: got %v, want ErrMFAEnabled", err)
+		}
+		if m, err := store.MFA.Get(ctx, u.ID); err != nil || m.EnabledAt == nil || m.LastCounter != 100 {
+			t.Errorf("enabled enrollment = %+v, %v", m, err)
+		}
+
+		if ok, err := store.MFA.UseCounter(ctx, u.ID, 100); err != nil || ok {
+			t.Errorf("replayed step: UseCounter = %v, %v", ok, err)
+		}
+		if ok, err := store.MFA.UseCounter(ctx, u.ID, 101); err != nil || !ok {
+			t.Errorf("next step: UseCounter = %v, %v", ok, err)
+		}
+
+		if ok, err := store.MFA.UseRecoveryCode(ctx, u.ID, "h1", now); err != nil || !ok {
+			t.Errorf("UseRecoveryCode = %v, %v", ok, err)
+		}
+		if ok, err := store.MFA.UseRecoveryCode(ctx, u.ID, "h1", now); err != nil || ok {
+			t.Errorf("used recovery code: UseRecoveryCode = %v, %v", ok, err)
+		}
+		if n, err := store.MFA.RecoveryCodesLeft(ctx, u.ID); err != nil || n != 1 {
+			t.Errorf("RecoveryCodesLeft = %d, %v, want 1", n, err)
+		}
+
+		if err := store.MFA.Delete(ctx, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.MFA.Get(ctx, u.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("after Delete: got %v, want ErrNotFound", err)
+		}
+		if n, err := store.MFA.RecoveryCodesLeft(ctx, u.ID); err != nil || n != 0 {
+			t.Errorf("recovery codes left after Delete: %d, %v", n, err)
+		}
+	})
+}
+
+func TestIdentities(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		now := time.Now().UTC().Truncate(time.Second)
+
+		i := &models.Identity{UserID: u.ID, Provider: "google", Subject: "123", Email: u.Email, CreatedAt: now, LastLoginAt: now}
+		if err := store.Identities.Create(ctx, i); err != nil || i.ID == 0 {
+			t.Fatalf("Create = %v, ID %d", err, i.ID)
+		}
+		if _, err := store.Identities.GetBySubject(ctx, "microsoft", "123"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("same subject at another provider: got %v, want ErrNotFound", err)
+		}
+
+		later := now.Add(time.Hour)
+		if err := store.Identities.RecordLogin(ctx, i.ID, "alice@new.example.com", later); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Identities.GetBySubject(ctx, "google", "123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UserID != u.ID || got.Email != "alice@new.example.com" || !got.LastLoginAt.Equal(later) {
+			t.Errorf("GetBySubject = %+v", got)
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		u := createUser(t, store, "alice@example.com")
+		now := time.Now().UTC().Truncate(time.Second)
+
+		if keys, err := store.APIKeys.ListActive(ctx, u.ID); err != nil || len(keys) != 0 {
+			t.Errorf("ListActive with no keys = %+v, %v", keys, err)
+		}
+		older := &models.APIKey{UserID: u.ID, Name: "cron", Prefix: "js_aaaa", Hash: "h1", Scopes: []string{"search:read", "alerts:read"}, CreatedAt: now.Add(-time.Hour)}
+		newer := &models.APIKey{UserID: u.ID, Name: "ci", Prefix: "js_bbbb", Hash: "h2", Scopes: []string{"cv:analyze"}, CreatedAt: now}
+		for _, k := range []*models.APIKey{older, newer} {
+			if err := store.APIKeys.Create(ctx, k); err != nil || k.ID == 0 {
+				t.Fatalf("Create = %v, ID %d", err, k.ID)
+			}
+		}
+
+		got, err := store.APIKeys.GetByPrefix(ctx, "js_aaaa")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != older.ID || got.Hash != "h1" || len(got.Scopes) != 2 || got.Scopes[1] != "alerts:read" || got.LastUsedAt != nil {
+			t.Errorf("GetByPrefix = %+v", got)
+		}
+		if keys, err := store.APIKeys.ListActive(ctx, u.ID); err != nil || len(keys) != 2 || keys[0].ID != newer.ID {
+			t.Errorf("ListActive = %+v, %v, want newest first", keys, err)
+		}
+
+		// Uses within the interval aren't recorded again
+		if err := store.APIKeys.Touch(ctx, older.ID, now, now.Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.APIKeys.Touch(ctx, older.ID, now.Add(time.Second), now.Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := store.APIKeys.GetByPrefix(ctx, "js_aaaa"); err != nil || got.LastUsedAt == nil || !got.LastUsedAt.Equal(now) {
+			t.Errorf("last used = %+v, %v, want %v", got.LastUsedAt, err, now)
+		}
+
+		if err := store.APIKeys.Revoke(ctx, u.ID+1, older.ID, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revoking another user's key: got %v, want ErrNotFound", err)
+		}
+		if err := store.APIKeys.Revoke(ctx, u.ID, older.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.APIKeys.Revoke(ctx, u.ID, older.ID, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revoking twice: got %v, want ErrNotFound", err)
+		}
+		if got, err := store.APIKeys.GetByPrefix(ctx, "js_aaaa"); err != nil || got.RevokedAt == nil {
+			t.Errorf("revoked key = %+v, %v", got, err)
+		}
+		if keys, err := store.APIKeys.ListActive(ctx, u.ID); err != nil || len(keys) != 1 || keys[0].ID != newer.ID {
+			t.Errorf("ListActive after revoking = %+v, %v", keys, err)
+		}
+
+		other := createUser(t, store, "bob@example.com")
+		bobs := &models.APIKey{UserID: other.ID, Name: "bob", Prefix: "js_cccc", Hash: "h3", Scopes: []string{"search:read"}, CreatedAt: now}
+		if err := store.APIKeys.Create(ctx, bobs); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := store.APIKeys.RevokeAll(ctx, u.ID, now); err != nil || n != 1 {
+			t.Errorf("RevokeAll = %d, %v, want only the active key revoked", n, err)
+		}
+		if keys, err := store.APIKeys.ListActive(ctx, u.ID); err != nil || len(keys) != 0 {
+			t.Errorf("ListActive after RevokeAll = %+v, %v", keys, err)
+		}
+		if keys, err := store.APIKeys.ListActive(ctx, other.ID); err != nil || len(keys) != 1 {
+			t.Errorf("RevokeAll revoked another user's keys: %+v, %v", keys, err)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"jobseek-web-be/internal/email"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/outbox"
+	"jobseek-web-be/internal/repository"
+)
+
+// DigestOff disables digests; new jobs are emailed per alert as they're found.
+const DigestOff = "off"
+
+// DigestPeriods maps the supported digest frequencies to their window.
+var DigestPeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// queueDigestItems holds new jobs for the user's next digest instead of
+// emailing them right away. Jobs already queued for the alert are ignored.
+func (s *JobScheduler) queueDigestItems(ctx context.Context, t SearchTask, jobs []models.Job) error {
+	items := make([]models.DigestItem, 0, len(jobs))
+	for _, job := range jobs {
+		payload, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		items = append(items, models.DigestItem{UserID: t.UserID, SearchID: t.ID, JobURL: job.JobURL, Job: string(payload)})
+	}
+	return s.digests.Add(ctx, items)
+}
+
+type digestItem struct {
+	ID       int
+	SearchID int
+	Title    string
+	Job      models.Job
+	Created  time.Time
+}
+
+// RunDigestTask sends a digest to every user whose window has elapsed since
+// their last one. Users who switched digests off get their pending items
+// flushed immediately.
+func (s *JobScheduler) RunDigestTask(ctx context.Context) {
+	users, err := s.digests.ListUsers(ctx)
+	if err != nil {
+		log.Printf("[Digest] Error fetching users: %v", err)
+		return
+	}
+
+	queued := 0
+	for _, u := range users {
+		if ctx.Err() != nil {
+			log.Printf("[Digest] Run cancelled: %v", ctx.Err())
+			return
+		}
+
+		items, err := s.loadDigestItems(ctx, u.ID)
+		if err != nil {
+			log.Printf("[Digest] Error loading items for user %d: %v", u.ID, err)
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		period := u.Frequency
+		window, ok := DigestPeriods[period]
+		if ok {
+			// The first digest covers the window since the oldest queued job
+			windowStart := items[0].Created
+			if u.LastDigestAt != nil {
+				windowStart = *u.LastDigestAt
+			}
+			if time.Since(windowStart) < window {
+				continue
+			}
+		} else {
+			period = "pending"
+		}
+
+		if err := s.queueDigest(ctx, u.ID, u.Email, u.Name, period, items); err != nil {
+			if errors.Is(err, repository.ErrDigestTaken) {
+				continue
+			}
+			log.Printf("[Digest] Failed to queue digest for %s: %v", u.Email, err)
+			continue
+		}
+		queued++
+	}
+	log.Printf("[Digest] Run finished: %d digests queued", queued)
+}
+
+func (s *JobScheduler) loadDigestItems(ctx context.Context, userID int) ([]digestItem, error) {
+	entries, err := s.digests.ListItems(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []digestItem
+	var corrupt []int
+	for _, e := range entries {
+		item := digestItem{ID: e.ID, SearchID: e.SearchID, Created: e.CreatedAt}
+		if err := json.Unmarshal([]byte(e.Job), &item.Job); err != nil {
+			log.Printf("[Digest] Dropping corrupt digest item %d: %v", item.ID, err)
+			corrupt = append(corrupt, item.ID)
+			continue
+		}
+		item.Title = alertTitle(e.Keyword, e.Location, e.Country)
+		items = append(items, item)
+	}
+
+	// They can never be sent, and kept they'd bring the user back every run
+	if len(corrupt) > 0 {
+		if err := s.digests.Delete(ctx, corrupt); err != nil {
+			log.Printf("[Digest] Failed to delete corrupt items of user %d: %v", userID, err)
+		}
+	}
+	return items, nil
+}
+
+func alertTitle(keyword, location, country string) string {
+	if location != "" {
+		return fmt.Sprintf("%s in %s, %s", keyword, location, country)
+	}
+	return fmt.Sprintf("%s in %s", keyword, country)
+}
+
+// queueDigest groups items by alert, listing a job matched by several alerts
+// only under the first one, and queues the digest for delivery.
+func (s *JobScheduler) queueDigest(ctx context.Context, userID int, toEmail, userName, period string, items []digestItem) error {
+	var groups []email.DigestGroup
+	groupIndex := make(map[int]int)
+	seen := make(map[string]bool)
+
+	for _, item := range items {
+		if seen[item.Job.JobURL] {
+			continue
+		}
+		seen[item.Job.JobURL] = true
+
+		idx, ok := groupIndex[item.SearchID]
+		if !ok {
+			idx = len(groups)
+			groupIndex[item.SearchID] = idx
+			groups = append(groups, email.DigestGroup{SearchID: item.SearchID, Title: item.Title})
+		}
+		groups[idx].Jobs = append(groups[idx].Jobs, item.Job)
+	}
+
+	// Every alert that matched a job counts it as sent, not just the group
+	// it was listed under
+	matches := make([]outbox.Match, 0, len(items))
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		matches = append(matches, outbox.Match{SearchID: item.SearchID, JobURL: item.Job.JobURL})
+		ids = append(ids, item.ID)
+	}
+
+	msg, err := outbox.Digest(userID, toEmail, userName, period, groups, matches).Record()
+	if err != nil {
+		return err
+	}
+	return s.digests.Flush(ctx, userID, ids, msg, time.Now().UTC())
+}
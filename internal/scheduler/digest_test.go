@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/outbox"
+	"jobseek-web-be/internal/repository"
+)
+
+// holdJobs adds digest items for the alert, created at the given time.
+func holdJobs(t *testing.T, store *repository.Store, s models.UserSearch, created time.Time, urls ...string) {
+	t.Helper()
+	var items []models.DigestItem
+	for _, job := range jobs(urls...) {
+		payload, err := json.Marshal(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, models.DigestItem{UserID: s.UserID, SearchID: s.ID, JobURL: job.JobURL, Job: string(payload), CreatedAt: created})
+	}
+	if err := store.Digests.Add(context.Background(), items); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunDigestTaskSendsDueDigests(t *testing.T) {
+	store := repository.NewMemoryStore()
+	s := NewScheduler(store)
+	u := addUser(t, store, "alice@example.com", "daily", true)
+	first := addSearch(t, store, u.ID, "")
+	second := addSearch(t, store, u.ID, "")
+	dayAgo := time.Now().Add(-25 * time.Hour)
+	holdJobs(t, store, first, dayAgo, "https://jobs.example/1", "https://jobs.example/2")
+	holdJobs(t, store, second, dayAgo, "https://jobs.example/2", "https://jobs.example/3")
+
+	s.RunDigestTask(context.Background())
+
+	msgs := messages(store)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.Kind != outbox.KindDigest || msg.SearchID != 0 || msg.ToEmail != u.Email {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	var payload outbox.Payload
+	if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Period != "daily" {
+		t.Errorf("period = %q, want daily", payload.Period)
+	}
+	// A job matched by both alerts is listed once, under the first
+	if len(payload.Groups) != 2 || len(payload.Groups[0].Jobs) != 2 || len(payload.Groups[1].Jobs) != 1 {
+		t.Fatalf("unexpected groups %+v", payload.Groups)
+	}
+	if payload.Groups[0].Title != "golang in Berlin, Germany" {
+		t.Errorf("group title = %q", payload.Groups[0].Title)
+	}
+	// but counts as sent for both
+	if len(msg.Matches) != 4 {
+		t.Errorf("got %d matches, want 4", len(msg.Matches))
+	}
+
+	items, err := store.Digests.ListItems(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("%d items still held after the digest was queued", len(items))
+	}
+
+	// The next digest waits for a new window
+	holdJobs(t, store, first, time.Now(), "https://jobs.example/4")
+	s.RunDigestTask(context.Background())
+	if n := len(messages(store)); n != 1 {
+		t.Errorf("got %d messages, want 1", n)
+	}
+}
+
+func TestRunDigestTaskWaitsForWindow(t *testing.T) {
+	store := repository.NewMemoryStore()
+	s := NewScheduler(store)
+	u := addUser(t, store, "bob@example.com", "weekly", true)
+	alert := addSearch(t, store, u.ID, "")
+	holdJobs(t, store, alert, time.Now().Add(-48*time.Hour), "https://jobs.example/1")
+
+	s.RunDigestTask(context.Background())
+
+	if n := len(messages(store)); n != 0 {
+		t.Errorf("got %d messages, want 0 before the week is up", n)
+	}
+}
+
+func TestRunDigestTaskFlushesWhenDigestsOff(t *testing.T) {
+	store := repository.NewMemoryStore()
+	s := NewScheduler(store)
+	u := addUser(t, store, "carol@example.com", DigestOff, true)
+	alert := addSearch(t, store, u.ID, "")
+	holdJobs(t, store, alert, time.Now(), "https://jobs.example/1")
+
+	s.RunDigestTask(context.Background())
+
+	msgs := messages(store)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	var payload outbox.Payload
+	if err := json.Unmarshal([]byte(msgs[0].Payload), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Period != "pending" {
+		t.Errorf("period = %q, want pending", payload.Period)
+	}
+}
+
+func TestRunDigestTaskDropsCorruptItems(t *testing.T) {
+	store := repository.NewMemoryStore()
+	s := NewScheduler(store)
+	ctx := context.Background()
+	u := addUser(t, store, "dave@example.com", "daily", true)
+	alert := addSearch(t, store, u.ID, "")
+	dayAgo := time.Now().Add(-25 * time.Hour)
+	corrupt := models.DigestItem{UserID: u.ID, SearchID: alert.ID, JobURL: "https://jobs.example/bad", Job: `{"title": `, CreatedAt: dayAgo}
+	if err := store.Digests.Add(ctx, []models.DigestItem{corrupt}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.RunDigestTask(ctx)
+
+	if n := len(messages(store)); n != 0 {
+		t.Errorf("got %d messages, want 0", n)
+	}
+	users, err := store.Digests.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("user with only corrupt items is still picked up: %+v", users)
+	}
+
+	// Good items alongside a corrupt one are still sent
+	holdJobs(t, store, alert, dayAgo, "https://jobs.example/1")
+	if err := store.Digests.Add(ctx, []models.DigestItem{corrupt}); err != nil {
+		t.Fatal(err)
+	}
+	s.RunDigestTask(ctx)
+	if n := len(messages(store)); n != 1 {
+		t.Errorf("got %d messages, want 1", n)
+	}
+	if users, _ := store.Digests.ListUsers(ctx); len(users) != 0 {
+		t.Errorf("items left behind: %+v", users)
+	}
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // containers may ship without a zoneinfo database
+
+	"github.com/robfig/cron/v3"
+)
+
+// DefaultFrequency and DefaultTimezone apply to alerts created without them.
+const (
+	DefaultFrequency = "hourly"
+	DefaultTimezone  = "UTC"
+)
+
+// FrequencyPresets maps the named alert frequencies to cron expressions,
+// evaluated in the alert's time zone. Any other frequency must be a standard
+// five-field cron expression or descriptor such as "@daily".
+var FrequencyPresets = map[string]string{
+	"hourly":   "0 * * * *",
+	"daily":    "0 8 * * *",
+	"weekdays": "0 8 * * 1-5",
+	"weekly":   "0 8 * * 1",
+}
+
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseSchedule resolves an alert's frequency and IANA time zone into a
+// schedule. Empty values fall back to DefaultFrequency and DefaultTimezone.
+func ParseSchedule(frequency, timezone string) (cron.Schedule, error) {
+	frequency = strings.TrimSpace(frequency)
+	if frequency == "" {
+		frequency = DefaultFrequency
+	}
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", timezone)
+	}
+
+	spec, ok := FrequencyPresets[strings.ToLower(frequency)]
+	if !ok {
+		spec = frequency
+	}
+
+	sched, err := scheduleParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frequency %q: must be one of hourly, daily, weekdays, weekly or a cron expression", frequency)
+	}
+
+	// Descriptors like @every have no notion of a zone; everything else does
+	if spec, ok := sched.(*cron.SpecSchedule); ok {
+		spec.Location = loc
+	}
+	return sched, nil
+}
+
+// NextRun returns when an alert with the given frequency and time zone is next
+// due after t, in UTC.
+func NextRun(frequency, timezone string, t time.Time) (time.Time, error) {
+	sched, err := ParseSchedule(frequency, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sched.Next(t).UTC().Truncate(time.Second), nil
+}
+
+// MinInterval returns the shortest gap between two runs of the frequency,
+// sampled over the next couple of weeks. It's computed in UTC so daylight
+// saving shifts don't make a daily schedule look shorter than a day.
+func MinInterval(frequency string) (time.Duration, error) {
+	sched, err := ParseSchedule(frequency, "UTC")
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now().UTC().Truncate(time.Minute)
+	end := start.Add(15 * 24 * time.Hour)
+	prev := sched.Next(start)
+	min := time.Duration(0)
+	for i := 0; i < 1000 && prev.Before(end); i++ {
+		next := sched.Next(prev)
+		if gap := next.Sub(prev); min == 0 || gap < min {
+			min = gap
+		}
+		prev = next
+	}
+	return min, nil
+}
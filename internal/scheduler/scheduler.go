@@ -1,25 +1,61 @@
 package scheduler
 
 import (
-	"database/sql"
+	"context"
 	"log"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"jobseek-web-be/internal/db"
-	"jobseek-web-be/internal/email"
+	"jobseek-web-be/internal/auth"
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/outbox"
+	"jobseek-web-be/internal/repository"
 	"jobseek-web-be/internal/search"
+	"jobseek-web-be/internal/usage"
 
 	"github.com/robfig/cron/v3"
 )
 
 type JobScheduler struct {
-	cron *cron.Cron
+	cron       *cron.Cron
+	dispatcher *outbox.Dispatcher
+	searches   repository.SearchRepository
+	sentJobs   repository.SentJobRepository
+	outbox     repository.OutboxRepository
+	digests    repository.DigestRepository
+	meter      *usage.Meter
+	revoked    repository.TokenRevocationRepository
+	sessions   repository.SessionRepository
+	userTokens repository.UserTokenRepository
+	logins     repository.LoginAttemptRepository
+
+	// ctx is cancelled by Stop so in-flight searches are killed on shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewScheduler() *JobScheduler {
+func NewScheduler(store *repository.Store) *JobScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &JobScheduler{
-		cron: cron.New(),
+		// A run that outlasts its interval makes the next tick a no-op
+		// instead of starting a second, overlapping run.
+		cron:       cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.PrintfLogger(log.Default())))),
+		dispatcher: outbox.NewDispatcher(store.Outbox),
+		searches:   store.Searches,
+		sentJobs:   store.SentJobs,
+		outbox:     store.Outbox,
+		digests:    store.Digests,
+		meter:      usage.NewMeter(store.Usage),
+		revoked:    store.Revocations,
+		sessions:   store.Sessions,
+		userTokens: store.UserTokens,
+		logins:     store.LoginAttempts,
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
@@ -33,217 +69,363 @@ func (s *JobScheduler) Start() {
 
 	_, err := s.cron.AddFunc(freq, func() {
 		log.Printf("[Scheduler] Starting job search task (Schedule: %s)...", freq)
-		RunJobSearchTask()
+		s.RunJobSearchTask(s.ctx)
 	})
 
 	if err != nil {
 		log.Fatalf("Error scheduling job: %v", err)
 	}
 
+	// Queued emails are delivered (and retried) independently of searches
+	outboxFreq := os.Getenv("OUTBOX_POLL_FREQUENCY")
+	if outboxFreq == "" {
+		outboxFreq = "@every 30s"
+	}
+
+	_, err = s.cron.AddFunc(outboxFreq, func() {
+		s.dispatcher.DispatchDue(s.ctx)
+	})
+
+	if err != nil {
+		log.Fatalf("Error scheduling outbox dispatcher: %v", err)
+	}
+
+	// Digests are checked separately so their timing doesn't depend on alerts
+	digestFreq := os.Getenv("SCHEDULER_DIGEST_FREQUENCY")
+	if digestFreq == "" {
+		digestFreq = "@hourly"
+	}
+
+	_, err = s.cron.AddFunc(digestFreq, func() {
+		log.Printf("[Scheduler] Starting digest task (Schedule: %s)...", digestFreq)
+		s.RunDigestTask(s.ctx)
+	})
+
+	if err != nil {
+		log.Fatalf("Error scheduling digest job: %v", err)
+	}
+
+	_, err = s.cron.AddFunc("@daily", func() {
+		s.pruneExpired(s.ctx)
+	})
+
+	if err != nil {
+		log.Fatalf("Error scheduling pruning: %v", err)
+	}
+
 	s.cron.Start()
 	log.Printf("Scheduler started. Jobs running with frequency: %s", freq)
 }
 
 func (s *JobScheduler) Stop() {
-	s.cron.Stop()
-}
-
-func RunJobSearchTask() {
-	// 1. Fetch all active searches into memory to avoid locking the DB during long processing
-	type SearchTask struct {
-		ID            int
-		UserID        int
-		Keyword       string
-		Country       string
-		Location      string
-		Language      string
-		UserEmail     string
-		UserName      string
-		Frequency     string
-		HoursOld      sql.NullInt64
-		Exclude       sql.NullString
-		ResultsWanted sql.NullInt64
-		LastRun       sql.NullTime
-	}
-
-	var tasks []SearchTask
-
-	rows, err := db.DB.Query(`
-		SELECT us.id, us.user_id, us.keyword, us.country, us.location, us.language, u.email, u.name, us.frequency, us.hours_old, us.exclude, us.results_wanted, us.last_run
-		FROM user_searches us 
-		JOIN users u ON us.user_id = u.id
-	`)
-	if err != nil {
-		log.Printf("[Scheduler] Error fetching searches: %v", err)
-		return
-	}
-	defer rows.Close()
+	s.cancel()
+	<-s.cron.Stop().Done()
+}
 
-	for rows.Next() {
-		var t SearchTask
-		var loc, lang sql.NullString
+// DefaultConcurrency is the number of alerts processed in parallel unless
+// SCHEDULER_CONCURRENCY says otherwise.
+const DefaultConcurrency = 4
+
+// RunStats summarises a single scheduler run. Workers update it concurrently.
+type RunStats struct {
+	Processed atomic.Int64
+	Failed    atomic.Int64
+	TimedOut  atomic.Int64
+	Emailed   atomic.Int64 // queued for delivery
+	Queued    atomic.Int64 // held for a digest
+	Paused    atomic.Int64 // not allowed by the owner's plan
+}
 
-		if err := rows.Scan(&t.ID, &t.UserID, &t.Keyword, &t.Country, &loc, &lang, &t.UserEmail, &t.UserName, &t.Frequency, &t.HoursOld, &t.Exclude, &t.ResultsWanted, &t.LastRun); err != nil {
-			log.Printf("[Scheduler] Error scanning row: %v", err)
-			continue
-		}
+// SearchTask is a saved search joined with its owner, loaded up front so the
+// DB isn't held during long-running scrapes.
+type SearchTask = repository.DueSearch
 
-		if loc.Valid {
-			t.Location = loc.String
-		}
-		if lang.Valid {
-			t.Language = lang.String
+// runSearches lets alerts sharing the same parameters reuse a single scrape
+// within a run, regardless of the result cache configuration.
+type runSearches struct {
+	mu      sync.Mutex
+	results map[string]*runSearch
+}
+
+type runSearch struct {
+	once sync.Once
+	jobs []models.Job
+	err  error
+}
+
+func (r *runSearches) execute(ctx context.Context, params search.SearchParams) ([]models.Job, error) {
+	key := search.CacheKey(params)
+
+	r.mu.Lock()
+	rs, ok := r.results[key]
+	if !ok {
+		rs = &runSearch{}
+		r.results[key] = rs
+	}
+	r.mu.Unlock()
+
+	rs.once.Do(func() {
+		rs.jobs, rs.err = search.ExecuteSearch(ctx, params)
+	})
+	return rs.jobs, rs.err
+}
+
+func concurrency() int {
+	if v := os.Getenv("SCHEDULER_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
 		}
+		log.Printf("[Scheduler] Ignoring invalid SCHEDULER_CONCURRENCY=%q", v)
+	}
+	return DefaultConcurrency
+}
 
-		tasks = append(tasks, t)
+func (s *JobScheduler) RunJobSearchTask(ctx context.Context) {
+	// 1. Fetch all due searches into memory to avoid locking the DB during long processing
+	tasks, err := s.searches.ListDue(ctx, time.Now().UTC())
+	if err != nil {
+		log.Printf("[Scheduler] Error fetching searches: %v", err)
+		return
 	}
-	rows.Close() // Explicitly close before processing
 
-	// 2. Process tasks
-	for _, t := range tasks {
-		// Check frequency
-		if t.LastRun.Valid {
-			nextRun := t.LastRun.Time
-			switch t.Frequency {
-			case "hourly":
-				nextRun = nextRun.Add(1 * time.Hour)
-			case "daily":
-				nextRun = nextRun.Add(24 * time.Hour)
-			default:
-				nextRun = nextRun.Add(1 * time.Hour)
+	// 2. Process tasks with a bounded worker pool
+	stats := &RunStats{}
+	runs := &runSearches{results: make(map[string]*runSearch)}
+	queue := make(chan SearchTask)
+
+	workers := concurrency()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				s.processTask(ctx, t, runs, stats)
 			}
+		}()
+	}
 
-			if time.Now().Before(nextRun) {
-				continue
-			}
+feed:
+	for _, t := range tasks {
+		select {
+		case queue <- t:
+		case <-ctx.Done():
+			log.Printf("[Scheduler] Run cancelled: %v", ctx.Err())
+			break feed
 		}
+	}
+	close(queue)
+	wg.Wait()
 
-		log.Printf("[Scheduler] Processing alert for user %s: %s in %s", t.UserEmail, t.Keyword, t.Country)
+	log.Printf("[Scheduler] Run finished: %d processed, %d emailed, %d queued for digest, %d failed, %d timed out, %d paused (%d workers)",
+		stats.Processed.Load(), stats.Emailed.Load(), stats.Queued.Load(), stats.Failed.Load(), stats.TimedOut.Load(), stats.Paused.Load(), workers)
+}
 
-		// Create SearchParams from task
-		hoursOld := 24 // Default
-		if t.HoursOld.Valid {
-			hoursOld = int(t.HoursOld.Int64)
+// processTask runs a single alert. Failures, including panics, are contained
+// so they never affect the other alerts in the run.
+func (s *JobScheduler) processTask(ctx context.Context, t SearchTask, runs *runSearches, stats *RunStats) {
+	defer func() {
+		if r := recover(); r != nil {
+			stats.Failed.Add(1)
+			log.Printf("[Scheduler] Panic while processing search %d: %v", t.ID, r)
 		}
+	}()
 
-		exclude := ""
-		if t.Exclude.Valid {
-			exclude = t.Exclude.String
-		}
+	// Bookkeeping must still happen if the run is cancelled mid-search
+	bg := context.WithoutCancel(ctx)
 
-		resultsWanted := 10 // Default
-		if t.ResultsWanted.Valid {
-			resultsWanted = int(t.ResultsWanted.Int64)
-		}
+	claimed, err := s.claimTask(bg, t)
+	if err != nil {
+		stats.Failed.Add(1)
+		log.Printf("[Scheduler] Failed to claim search %d: %v", t.ID, err)
+		return
+	}
+	if !claimed {
+		// Another instance sharing the database is already running it
+		return
+	}
 
-		// Execute Search
-		params := search.SearchParams{
-			Keyword:       t.Keyword,
-			Country:       t.Country,
-			Location:      t.Location,
-			LocalLanguage: t.Language,
-			ResultsWanted: resultsWanted,
-			HoursOld:      hoursOld,
-			Exclude:       exclude,
-		}
+	// Alerts beyond the plan's limit (e.g. after a downgrade or an expired
+	// trial) are skipped until their next slot rather than deleted, and so
+	// are alerts of unverified accounts, so nothing is sent to an address
+	// its owner hasn't confirmed. A skipped slot doesn't count as a run.
+	ent := entitlements.For(t.Plan, t.Paid, auth.TrialEnd(t.UserCreatedAt))
+	if t.Position >= ent.MaxAlerts || !t.UserVerified {
+		stats.Paused.Add(1)
+		s.skipToNextRun(bg, t, ent)
+		return
+	}
 
-		results, err := search.ExecuteSearch(params)
-		if err != nil {
-			log.Printf("[Scheduler] Search failed for %d: %v", t.ID, err)
-			continue
-		}
+	log.Printf("[Scheduler] Processing alert for user %s: %s in %s", t.UserEmail, t.Keyword, t.Country)
+	stats.Processed.Add(1)
 
-		if len(results) == 0 {
-			log.Printf("[Scheduler] No results found for %d", t.ID)
-			continue
-		}
+	resultsWanted := t.ResultsWanted
+	if resultsWanted <= 0 {
+		resultsWanted = search.DefaultResultsWanted
+	}
 
-		// FILTER DUPLICATES
-		results = filterNewJobs(t.ID, results)
-		if len(results) == 0 {
-			log.Printf("[Scheduler] All results were already sent for search %d", t.ID)
-			continue
-		}
+	// Execute Search
+	params := search.SearchParams{
+		Keyword:       t.Keyword,
+		Country:       t.Country,
+		Location:      t.Location,
+		LocalLanguage: t.Language,
+		ResultsWanted: ent.CapResults(resultsWanted),
+		HoursOld:      t.HoursOld,
+		Exclude:       t.Exclude,
+		Provider:      t.Provider,
+	}
 
-		// Send Email
-		if err := email.SendJobAlert(t.UserEmail, t.UserName, t.UserID, t.ID, results); err != nil {
-			log.Printf("[Scheduler] Failed to send email to %s: %v", t.UserEmail, err)
+	results, err := runs.execute(ctx, params)
+	if err != nil {
+		if search.IsCanceled(err) {
+			stats.TimedOut.Add(1)
+			log.Printf("[Scheduler] Search timed out for %d: %v", t.ID, err)
 		} else {
-			// Mark as sent only if email succeeded
-			markJobsAsSent(t.ID, results)
+			stats.Failed.Add(1)
+			log.Printf("[Scheduler] Search failed for %d: %v", t.ID, err)
 		}
+		s.releaseTask(bg, t)
+		return
+	}
+
+	// The search itself succeeded, so the alert is done until its next slot
+	// even if nothing new turned up. Failed searches are retried next tick.
+	defer s.scheduleNextRun(bg, t, ent)
 
-		// Update Last Run
-		_, err = db.DB.Exec("UPDATE user_searches SET last_run = ? WHERE id = ?", time.Now(), t.ID)
-		if err != nil {
-			log.Printf("[Scheduler] Failed to update last_run for %d: %v", t.ID, err)
+	if len(results) == 0 {
+		log.Printf("[Scheduler] No results found for %d", t.ID)
+		return
+	}
+
+	// FILTER DUPLICATES
+	results = s.filterNewJobs(ctx, t.ID, results)
+	if len(results) == 0 {
+		log.Printf("[Scheduler] All results were already sent for search %d", t.ID)
+		return
+	}
+
+	// Digest users get everything in one email later
+	if _, ok := DigestPeriods[t.Digest]; ok {
+		if err := s.queueDigestItems(bg, t, results); err != nil {
+			stats.Failed.Add(1)
+			log.Printf("[Scheduler] Failed to queue digest items for search %d: %v", t.ID, err)
+			return
 		}
+		stats.Queued.Add(1)
+		return
 	}
+
+	// Queue the email; the outbox dispatcher delivers it and marks the jobs
+	// as sent once delivery succeeds
+	if err := outbox.Enqueue(bg, s.outbox, outbox.Alert(t.UserID, t.ID, t.UserEmail, t.UserName, results)); err != nil {
+		stats.Failed.Add(1)
+		log.Printf("[Scheduler] Failed to queue email to %s: %v", t.UserEmail, err)
+		return
+	}
+	stats.Emailed.Add(1)
 }
 
-func filterNewJobs(searchID int, results []interface{}) []interface{} {
-	rows, err := db.DB.Query("SELECT job_url FROM sent_jobs WHERE search_id = ?", searchID)
-	if err != nil {
-		log.Printf("[Scheduler] Error fetching history for search %d: %v", searchID, err)
-		return results // Fail open? Or closed? Open ensures delivery but risks duplicate.
+// claimLease keeps other instances off an alert while one of them runs it.
+// If the instance dies mid-run the alert becomes due again once it expires.
+const claimLease = 30 * time.Minute
+
+// claimTask takes the alert for this run by pushing next_run_at past the
+// lease, unless someone else did first.
+func (s *JobScheduler) claimTask(ctx context.Context, t SearchTask) (bool, error) {
+	now := time.Now().UTC()
+	return s.searches.Claim(ctx, t.ID, now, now.Add(claimLease))
+}
+
+// releaseTask gives up the claim so a failed search is retried next tick.
+func (s *JobScheduler) releaseTask(ctx context.Context, t SearchTask) {
+	if err := s.searches.SetNextRun(ctx, t.ID, time.Now().UTC()); err != nil {
+		log.Printf("[Scheduler] Failed to release search %d: %v", t.ID, err)
 	}
-	defer rows.Close()
+}
 
-	sentMap := make(map[string]bool)
-	for rows.Next() {
-		var url string
-		if err := rows.Scan(&url); err == nil {
-			sentMap[url] = true
-		}
+// pruneExpired drops bookkeeping rows that can no longer matter: usage
+// older than the longest quota window, revocations of expired tokens,
+// sessions that ended over a week ago, expired emailed tokens and login
+// failure counts outside the failure window. Ended sessions are kept for a
+// week so a refresh token reuse can still be investigated.
+func (s *JobScheduler) pruneExpired(ctx context.Context) {
+	if n, err := s.meter.Prune(ctx); err != nil {
+		log.Printf("[Scheduler] Failed to prune usage events: %v", err)
+	} else {
+		log.Printf("[Scheduler] Pruned %d usage events", n)
+	}
+	if n, err := s.revoked.Prune(ctx, time.Now()); err != nil {
+		log.Printf("[Scheduler] Failed to prune revoked tokens: %v", err)
+	} else {
+		log.Printf("[Scheduler] Pruned %d revoked tokens", n)
+	}
+	if n, err := s.sessions.Prune(ctx, time.Now().AddDate(0, 0, -7)); err != nil {
+		log.Printf("[Scheduler] Failed to prune sessions: %v", err)
+	} else {
+		log.Printf("[Scheduler] Pruned %d sessions", n)
+	}
+	if n, err := s.userTokens.Prune(ctx, time.Now()); err != nil {
+		log.Printf("[Scheduler] Failed to prune user tokens: %v", err)
+	} else {
+		log.Printf("[Scheduler] Pruned %d user tokens", n)
 	}
+	if n, err := s.logins.Prune(ctx, time.Now().Add(-auth.FailureWindow)); err != nil {
+		log.Printf("[Scheduler] Failed to prune login failures: %v", err)
+	} else {
+		log.Printf("[Scheduler] Pruned %d login failure counts", n)
+	}
+}
 
-	var newResults []interface{}
-	for _, item := range results {
-		job, ok := item.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		url, ok := job["job_url"].(string)
-		if !ok || url == "" {
-			continue
-		}
+// scheduleNextRun records the run and schedules the next one.
+func (s *JobScheduler) scheduleNextRun(ctx context.Context, t SearchTask, ent entitlements.Entitlements) {
+	now := time.Now()
+	if err := s.searches.RecordRun(ctx, t.ID, now, nextRunAt(t, ent, now)); err != nil {
+		log.Printf("[Scheduler] Failed to update last_run for %d: %v", t.ID, err)
+	}
+}
 
-		if !sentMap[url] {
-			newResults = append(newResults, item)
-		}
+// skipToNextRun schedules the next run of an alert that was skipped, leaving
+// last_run as it was.
+func (s *JobScheduler) skipToNextRun(ctx context.Context, t SearchTask, ent entitlements.Entitlements) {
+	if err := s.searches.SetNextRun(ctx, t.ID, nextRunAt(t, ent, time.Now())); err != nil {
+		log.Printf("[Scheduler] Failed to reschedule search %d: %v", t.ID, err)
 	}
-	return newResults
 }
 
-func markJobsAsSent(searchID int, results []interface{}) {
-	tx, err := db.DB.Begin()
-	if err != nil {
-		log.Printf("[Scheduler] Error starting transaction: %v", err)
-		return
+// nextRunAt computes next_run_at from the alert's schedule. Alerts with an
+// unparseable schedule fall back to hourly, and ones scheduled more often
+// than the owner's plan allows skip slots to comply.
+func nextRunAt(t SearchTask, ent entitlements.Entitlements, now time.Time) time.Time {
+	frequency, timezone := t.Frequency, t.Timezone
+	if _, err := ParseSchedule(frequency, timezone); err != nil {
+		log.Printf("[Scheduler] Invalid schedule for search %d, using hourly: %v", t.ID, err)
+		frequency, timezone = DefaultFrequency, DefaultTimezone
 	}
-	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT OR IGNORE INTO sent_jobs (search_id, job_url) VALUES (?, ?)")
+	from := now
+	if interval, _ := MinInterval(frequency); interval < ent.MinAlertInterval {
+		from = now.Add(ent.MinAlertInterval - interval)
+	}
+	nextRun, _ := NextRun(frequency, timezone, from)
+	return nextRun
+}
+
+// filterNewJobs drops jobs already delivered for the search, or already
+// waiting in the outbox or a pending digest.
+func (s *JobScheduler) filterNewJobs(ctx context.Context, searchID int, results []models.Job) []models.Job {
+	sentMap, err := s.sentJobs.SeenURLs(ctx, searchID)
 	if err != nil {
-		log.Printf("[Scheduler] Error preparing statement: %v", err)
-		return
+		log.Printf("[Scheduler] Error fetching history for search %d: %v", searchID, err)
+		return results // Fail open? Or closed? Open ensures delivery but risks duplicate.
 	}
-	defer stmt.Close()
 
-	for _, item := range results {
-		job, ok := item.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		url, ok := job["job_url"].(string)
-		if !ok || url == "" {
-			continue
+	var newResults []models.Job
+	for _, job := range results {
+		if !sentMap[job.JobURL] {
+			newResults = append(newResults, job)
 		}
-		if _, err := stmt.Exec(searchID, url); err != nil {
-			log.Printf("[Scheduler] Error inserting job history: %v", err)
-		}
-	}
-	if err := tx.Commit(); err != nil {
-		log.Printf("[Scheduler] Error committing transaction: %v", err)
 	}
+	return newResults
 }
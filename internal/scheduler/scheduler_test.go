@@ -0,0 +1,219 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/models"
+	"jobseek-web-be/internal/outbox"
+	"jobseek-web-be/internal/repository"
+	"jobseek-web-be/internal/search"
+)
+
+// fakeProvider returns canned jobs, or err, and counts its calls.
+type fakeProvider struct {
+	name  string
+	jobs  []models.Job
+	err   error
+	calls atomic.Int64
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Search(ctx context.Context, params search.SearchParams) ([]models.Job, error) {
+	p.calls.Add(1)
+	return p.jobs, p.err
+}
+
+// registerProvider installs a fake provider under a name unique to the test,
+// so searches from other tests are neither coalesced with nor cached for it.
+func registerProvider(t *testing.T, jobs []models.Job, err error) *fakeProvider {
+	t.Helper()
+	p := &fakeProvider{name: "fake-" + t.Name(), jobs: jobs, err: err}
+	search.RegisterProvider(p)
+	return p
+}
+
+func jobs(urls ...string) []models.Job {
+	var list []models.Job
+	for _, url := range urls {
+		list = append(list, models.Job{Title: "Job " + url, Company: "Acme", JobURL: url})
+	}
+	return list
+}
+
+// addUser creates a verified trial user with the digest frequency.
+func addUser(t *testing.T, store *repository.Store, email, digest string, verified bool) models.User {
+	t.Helper()
+	ctx := context.Background()
+	u := models.User{Name: "Test User", Email: email, Password: "hash"}
+	if err := store.Users.Create(ctx, &u); err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err := store.Users.MarkEmailVerified(ctx, u.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if digest != "" {
+		if err := store.Users.SetDigestFrequency(ctx, u.ID, digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return u
+}
+
+// addSearch creates a saved search that is due right away.
+func addSearch(t *testing.T, store *repository.Store, userID int, provider string) models.UserSearch {
+	t.Helper()
+	s := models.UserSearch{
+		UserID:    userID,
+		Keyword:   "golang",
+		Country:   "Germany",
+		Location:  "Berlin",
+		Frequency: DefaultFrequency,
+		Timezone:  DefaultTimezone,
+		HoursOld:  24,
+		Provider:  provider,
+	}
+	if err := store.Searches.Create(context.Background(), &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func messages(store *repository.Store) []models.OutboxMessage {
+	return store.Outbox.(*repository.MemoryOutboxRepository).Messages()
+}
+
+func getSearch(t *testing.T, store *repository.Store, userID, searchID int) models.UserSearch {
+	t.Helper()
+	searches, err := store.Searches.ListByUser(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range searches {
+		if s.ID == searchID {
+			return s
+		}
+	}
+	t.Fatalf("search %d not found", searchID)
+	return models.UserSearch{}
+}
+
+func TestRunJobSearchTaskQueuesNewJobs(t *testing.T) {
+	store := repository.NewMemoryStore()
+	s := NewScheduler(store)
+	p := registerProvider(t, jobs("https://jobs.example/1", "https://jobs.example/2", "https://jobs.example/3"), nil)
+	u := addUser(t, store, "alice@example.com", "", true)
+	alert := addSearch(t, store, u.ID, p.name)
+	store.SentJobs.(*repository.MemorySentJobRepository).MarkSeen(alert.ID, "https://jobs.example/1")
+
+	s.RunJobSearchTask(context.Background())
+
+	msgs := messages(store)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.Kind != outbox.KindAlert || msg.UserID != u.ID || msg.SearchID != alert.ID || msg.ToEmail != u.Email {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	var payload outbox.Payload
+	if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Jobs) != 2 || payload.Jobs[0].JobURL != "https://jobs.example/2" || payload.Jobs[1].JobURL != "https://jobs.example/3" {
+		t.Errorf("payload has jobs %+v, want only the unsent ones", payload.Jobs)
+	}
+	if len(msg.Matches) != 2 {
+		t.Errorf("got %d matches, want 2", len(msg.Matches))
+	}
+
+	got := getSearch(t, store, u.ID, alert.ID)
+	if got.LastRun.IsZero() || !got.NextRunAt.After(time.Now()) {
+		t.Errorf("search not rescheduled: last run %v, next run %v", got.LastRun, got.NextRunAt)
+	}
+
+	// Jobs waiting in the outbox aren't queued again on the next run
+	if err := store.Searches.SetNextRun(context.Background(), alert.ID, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	s.RunJobSearchTask(context.Background())
+	if n := len(messages(store)); n != 1 {
+		t.Errorf("got %d messages after the second run, want 1", n)
+	}
+	if n := p.calls.Load(); n != 2 {
+		t.Errorf("provider called %d times, want 2", n)
+	}
+}
+
+func TestRunJobSearchTaskHoldsJobsForDigest(t *testing.T) {
+	store := repository.NewMemoryStore()
+	s := NewScheduler(store)
+	p := registerProvider(t, jobs("https://jobs.example/1", "https://jobs.example/2"), nil)
+	u := addUser(t, store, "bob@example.com", "daily", true)
+	addSearch(t, store, u.ID, p.name)
+
+	s.RunJobSearchTask(context.Background())
+
+	if n := len(messages(store)); n != 0 {
+		t.Errorf("got %d messages, want none for a digest user", n)
+	}
+	items, err := store.Digests.ListItems(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Errorf("got %d digest items, want 2", len(items))
+	}
+}
+
+func TestRunJobSearchTaskPausesUnverifiedUsers(t *testing.T) {
+	store := repository.NewMemoryStore()
+	s := NewScheduler(store)
+	p := registerProvider(t, jobs("https://jobs.example/1"), nil)
+	u := addUser(t, store, "carol@example.com", "", false)
+	alert := addSearch(t, store, u.ID, p.name)
+
+	s.RunJobSearchTask(context.Background())
+
+	if n := p.calls.Load(); n != 0 {
+		t.Errorf("provider called %d times, want 0", n)
+	}
+	if n := len(messages(store)); n != 0 {
+		t.Errorf("got %d messages, want 0", n)
+	}
+	got := getSearch(t, store, u.ID, alert.ID)
+	if !got.NextRunAt.After(time.Now()) {
+		t.Errorf("paused search should wait for its next slot, next run %v", got.NextRunAt)
+	}
+	if !got.LastRun.IsZero() {
+		t.Errorf("paused search recorded a run at %v", got.LastRun)
+	}
+}
+
+func TestRunJobSearchTaskRetriesFailedSearches(t *testing.T) {
+	store := repository.NewMemoryStore()
+	s := NewScheduler(store)
+	p := registerProvider(t, nil, errors.New("scraper crashed"))
+	u := addUser(t, store, "dave@example.com", "", true)
+	alert := addSearch(t, store, u.ID, p.name)
+
+	s.RunJobSearchTask(context.Background())
+
+	got := getSearch(t, store, u.ID, alert.ID)
+	if got.NextRunAt.After(time.Now()) {
+		t.Errorf("failed search should be due again, next run %v", got.NextRunAt)
+	}
+	if !got.LastRun.IsZero() {
+		t.Errorf("failed search recorded a run at %v", got.LastRun)
+	}
+	if n := len(messages(store)); n != 0 {
+		t.Errorf("got %d messages, want 0", n)
+	}
+}
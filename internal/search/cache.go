@@ -0,0 +1,190 @@
+package search
+
+import (
+	"container/list"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"jobseek-web-be/internal/models"
+)
+
+const (
+	DefaultCacheTTL  = 15 * time.Minute
+	DefaultCacheSize = 256
+)
+
+// Cache stores search results keyed by CacheKey. Implementations handle
+// expiry themselves; Get must not return stale entries.
+type Cache interface {
+	Get(key string) ([]models.Job, bool)
+	Set(key string, jobs []models.Job)
+}
+
+var (
+	cacheMu     sync.RWMutex
+	resultCache Cache
+)
+
+// SetCache installs the cache consulted by ExecuteSearch. nil disables caching.
+func SetCache(c Cache) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	resultCache = c
+}
+
+func currentCache() Cache {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
+	return resultCache
+}
+
+// ConfigureCacheFromEnv sets up the result cache from SEARCH_CACHE
+// ("memory", "sql" or "off"), SEARCH_CACHE_TTL and SEARCH_CACHE_SIZE.
+// The sql backend ("sqlite" is accepted as an alias) requires db.InitDB to
+// have run.
+func ConfigureCacheFromEnv() {
+	ttl := DefaultCacheTTL
+	if v := os.Getenv("SEARCH_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("[Search] Ignoring invalid SEARCH_CACHE_TTL=%q: %v", v, err)
+		} else {
+			ttl = d
+		}
+	}
+
+	size := DefaultCacheSize
+	if v := os.Getenv("SEARCH_CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Printf("[Search] Ignoring invalid SEARCH_CACHE_SIZE=%q", v)
+		} else {
+			size = n
+		}
+	}
+
+	backend := os.Getenv("SEARCH_CACHE")
+	if backend == "" {
+		backend = "memory"
+	}
+	if ttl <= 0 {
+		backend = "off"
+	}
+
+	switch backend {
+	case "memory":
+		SetCache(NewMemoryCache(size, ttl))
+	case "sql", "sqlite":
+		SetCache(NewSQLCache(ttl))
+	case "off":
+		SetCache(nil)
+	default:
+		log.Printf("[Search] Unknown SEARCH_CACHE=%q, caching disabled", backend)
+		SetCache(nil)
+		return
+	}
+	log.Printf("[Search] Result cache: %s (ttl %s)", backend, ttl)
+}
+
+// CacheKey normalizes params so that searches differing only in case,
+// surrounding whitespace or the order of excluded terms share a cache entry.
+// Call it after defaults have been applied.
+func CacheKey(params SearchParams) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+
+	var exclude []string
+	seen := map[string]bool{}
+	for _, term := range strings.Split(params.Exclude, ",") {
+		term = norm(term)
+		if term != "" && !seen[term] {
+			seen[term] = true
+			exclude = append(exclude, term)
+		}
+	}
+	sort.Strings(exclude)
+
+	key, _ := json.Marshal([]interface{}{
+		norm(params.Provider),
+		norm(params.Keyword),
+		norm(params.Country),
+		norm(params.Location),
+		norm(params.LocalLanguage),
+		params.ResultsWanted,
+		params.HoursOld,
+		exclude,
+	})
+	return string(key)
+}
+
+// MemoryCache is an in-process LRU cache with a fixed TTL per entry.
+type MemoryCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key       string
+	jobs      []models.Job
+	expiresAt time.Time
+}
+
+func NewMemoryCache(size int, ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]models.Job, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*memoryEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return append([]models.Job(nil), entry.jobs...), true
+}
+
+func (c *MemoryCache) Set(key string, jobs []models.Job) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoryEntry{
+		key:       key,
+		jobs:      append([]models.Job(nil), jobs...),
+		expiresAt: time.Now().Add(c.ttl),
+	}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
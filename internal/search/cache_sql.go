@@ -0,0 +1,65 @@
+package search
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"jobseek-web-be/internal/db"
+	"jobseek-web-be/internal/models"
+)
+
+// SQLCache persists results in the search_cache table so they survive
+// restarts and can be shared by processes using the same database.
+type SQLCache struct {
+	ttl time.Duration
+}
+
+func NewSQLCache(ttl time.Duration) *SQLCache {
+	return &SQLCache{ttl: ttl}
+}
+
+func (c *SQLCache) Get(key string) ([]models.Job, bool) {
+	var payload string
+	err := db.DB.QueryRow(
+		"SELECT results FROM search_cache WHERE cache_key = ? AND expires_at > ?",
+		key, time.Now().UTC(),
+	).Scan(&payload)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[Search] Cache lookup failed: %v", err)
+		}
+		return nil, false
+	}
+
+	var jobs []models.Job
+	if err := json.Unmarshal([]byte(payload), &jobs); err != nil {
+		log.Printf("[Search] Corrupt cache entry, ignoring: %v", err)
+		return nil, false
+	}
+	return jobs, true
+}
+
+func (c *SQLCache) Set(key string, jobs []models.Job) {
+	payload, err := json.Marshal(jobs)
+	if err != nil {
+		log.Printf("[Search] Failed to encode cache entry: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	_, err = db.DB.Exec(`
+		INSERT INTO search_cache (cache_key, results, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(cache_key) DO UPDATE SET results = excluded.results, expires_at = excluded.expires_at
+	`, key, string(payload), now.Add(c.ttl))
+	if err != nil {
+		log.Printf("[Search] Failed to store cache entry: %v", err)
+		return
+	}
+
+	// Expired rows are never read again; drop them while we're here
+	if _, err := db.DB.Exec("DELETE FROM search_cache WHERE expires_at <= ?", now); err != nil {
+		log.Printf("[Search] Failed to prune cache: %v", err)
+	}
+}
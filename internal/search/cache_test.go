@@ -0,0 +1,261 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/db"
+	"jobseek-web-be/internal/models"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := SearchParams{
+		Provider:      "static",
+		Keyword:       "Go Developer",
+		Country:       "Germany",
+		Location:      "Berlin",
+		LocalLanguage: "German",
+		ResultsWanted: 10,
+		HoursOld:      24,
+		Exclude:       "senior,lead",
+	}
+	for _, tc := range []struct {
+		name string
+		edit func(p *SearchParams)
+		same bool
+	}{
+		{"identical", func(p *SearchParams) {}, true},
+		{"keyword case", func(p *SearchParams) { p.Keyword = "go DEVELOPER" }, true},
+		{"surrounding whitespace", func(p *SearchParams) { p.Keyword = "  Go Developer\t"; p.Country = " Germany " }, true},
+		{"provider case", func(p *SearchParams) { p.Provider = "Static" }, true},
+		{"exclude order", func(p *SearchParams) { p.Exclude = "lead,senior" }, true},
+		{"exclude spacing and case", func(p *SearchParams) { p.Exclude = " Lead , SENIOR " }, true},
+		{"exclude duplicates and blanks", func(p *SearchParams) { p.Exclude = "senior,,lead,senior" }, true},
+		{"keyword", func(p *SearchParams) { p.Keyword = "Rust Developer" }, false},
+		{"inner whitespace", func(p *SearchParams) { p.Keyword = "GoDeveloper" }, false},
+		{"country", func(p *SearchParams) { p.Country = "France" }, false},
+		{"location", func(p *SearchParams) { p.Location = "" }, false},
+		{"language", func(p *SearchParams) { p.LocalLanguage = "French" }, false},
+		{"provider", func(p *SearchParams) { p.Provider = "jobseek-expat" }, false},
+		{"results wanted", func(p *SearchParams) { p.ResultsWanted = 20 }, false},
+		{"hours old", func(p *SearchParams) { p.HoursOld = 48 }, false},
+		{"exclude", func(p *SearchParams) { p.Exclude = "senior" }, false},
+		{"fields don't run together", func(p *SearchParams) { p.Keyword = "Go Developer Germany"; p.Country = "" }, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := base
+			tc.edit(&p)
+			if same := CacheKey(p) == CacheKey(base); same != tc.same {
+				t.Errorf("CacheKey(%+v) == CacheKey(base) is %v, want %v", p, same, tc.same)
+			}
+		})
+	}
+}
+
+func jobs(titles ...string) []models.Job {
+	var list []models.Job
+	for _, title := range titles {
+		list = append(list, models.Job{Title: title, JobURL: "https://jobs.example/" + title})
+	}
+	return list
+}
+
+// cacheContents returns which of keys are cached.
+func cacheContents(c Cache, keys ...string) map[string]bool {
+	got := make(map[string]bool)
+	for _, key := range keys {
+		_, got[key] = c.Get(key)
+	}
+	return got
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ops  func(c *MemoryCache)
+		want map[string]bool
+	}{
+		{
+			name: "evicts the oldest",
+			ops: func(c *MemoryCache) {
+				c.Set("a", jobs("a"))
+				c.Set("b", jobs("b"))
+				c.Set("c", jobs("c"))
+			},
+			want: map[string]bool{"a": false, "b": true, "c": true},
+		},
+		{
+			name: "reads count as use",
+			ops: func(c *MemoryCache) {
+				c.Set("a", jobs("a"))
+				c.Set("b", jobs("b"))
+				c.Get("a")
+				c.Set("c", jobs("c"))
+			},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "overwrites count as use",
+			ops: func(c *MemoryCache) {
+				c.Set("a", jobs("a"))
+				c.Set("b", jobs("b"))
+				c.Set("a", jobs("a2"))
+				c.Set("c", jobs("c"))
+			},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "misses don't",
+			ops: func(c *MemoryCache) {
+				c.Set("a", jobs("a"))
+				c.Set("b", jobs("b"))
+				c.Get("z")
+				c.Set("c", jobs("c"))
+			},
+			want: map[string]bool{"a": false, "b": true, "c": true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewMemoryCache(2, time.Hour)
+			tc.ops(c)
+			// Check in reverse insertion order so the reads don't reorder
+			// entries that are still to be checked
+			got := cacheContents(c, "c", "b", "a")
+			for key, want := range tc.want {
+				if got[key] != want {
+					t.Errorf("%q cached = %v, want %v", key, got[key], want)
+				}
+			}
+			if n := c.order.Len(); n != 2 || len(c.entries) != 2 {
+				t.Errorf("cache holds %d entries (%d indexed), want 2", n, len(c.entries))
+			}
+		})
+	}
+}
+
+func TestMemoryCacheReturnsCopies(t *testing.T) {
+	c := NewMemoryCache(2, time.Hour)
+	stored := jobs("a")
+	c.Set("a", stored)
+	stored[0].Title = "changed"
+
+	got, ok := c.Get("a")
+	if !ok || got[0].Title != "a" {
+		t.Fatalf("Get = %+v, %v, want the jobs as stored", got, ok)
+	}
+	got[0].Title = "changed"
+	if again, _ := c.Get("a"); again[0].Title != "a" {
+		t.Errorf("modifying a result changed the cache: %+v", again)
+	}
+}
+
+// testCacheTTL checks that entries are served until they expire. Expiry is
+// tested with a negative TTL, so no entry is ever fresh.
+func testCacheTTL(t *testing.T, newCache func(ttl time.Duration) Cache) {
+	for _, tc := range []struct {
+		name string
+		ttl  time.Duration
+		hit  bool
+	}{
+		{"fresh", time.Hour, true},
+		{"expired", -time.Second, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCache(tc.ttl)
+			c.Set("key", jobs("a", "b"))
+			got, ok := c.Get("key")
+			if ok != tc.hit {
+				t.Fatalf("Get hit = %v, want %v", ok, tc.hit)
+			}
+			if ok && (len(got) != 2 || got[0].Title != "a" || got[1].JobURL != "https://jobs.example/b") {
+				t.Errorf("Get = %+v", got)
+			}
+			if _, ok := c.Get("other"); ok {
+				t.Error("Get hit a key that was never set")
+			}
+		})
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	testCacheTTL(t, func(ttl time.Duration) Cache { return NewMemoryCache(DefaultCacheSize, ttl) })
+
+	// Expired entries are dropped when read
+	c := NewMemoryCache(DefaultCacheSize, -time.Second)
+	c.Set("key", jobs("a"))
+	c.Get("key")
+	if len(c.entries) != 0 || c.order.Len() != 0 {
+		t.Errorf("expired entry kept: %d entries", len(c.entries))
+	}
+}
+
+// useTestDB points db.DB at a migrated SQLite :memory: database for the
+// test. The SQL cache works on db.DB, so these tests can't run in parallel.
+func useTestDB(t *testing.T) *db.Conn {
+	t.Helper()
+	conn, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = prev
+		conn.Close()
+	})
+	if _, err := db.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestSQLCacheTTL(t *testing.T) {
+	useTestDB(t)
+	testCacheTTL(t, func(ttl time.Duration) Cache { return NewSQLCache(ttl) })
+}
+
+func TestSQLCache(t *testing.T) {
+	conn := useTestDB(t)
+	c := NewSQLCache(time.Hour)
+
+	// Setting a key again replaces its results
+	c.Set("key", jobs("a"))
+	c.Set("key", jobs("b", "c"))
+	if got, ok := c.Get("key"); !ok || len(got) != 2 || got[0].Title != "b" {
+		t.Errorf("Get after overwrite = %+v, %v", got, ok)
+	}
+
+	// Entries are shared by every cache on the database
+	if got, ok := NewSQLCache(time.Minute).Get("key"); !ok || len(got) != 2 {
+		t.Errorf("another cache got %+v, %v", got, ok)
+	}
+
+	// Expired rows are pruned on the next write
+	NewSQLCache(-time.Second).Set("stale", jobs("a"))
+	c.Set("other", jobs("d"))
+	var keys []string
+	rows, err := conn.Query("SELECT cache_key FROM search_cache ORDER BY cache_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	if fmt.Sprint(keys) != "[key other]" {
+		t.Errorf("cached keys = %v, want the stale one pruned", keys)
+	}
+
+	// Rows that don't decode are misses
+	if _, err := conn.Exec("UPDATE search_cache SET results = ? WHERE cache_key = ?", "{not json", "key"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.Get("key"); ok {
+		t.Errorf("corrupt entry served: %+v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"jobseek-web-be/internal/models"
+)
+
+const CLIProviderName = "jobseek-expat"
+
+// CLIProvider runs searches by shelling out to the jobseek-expat Python CLI.
+type CLIProvider struct {
+	Sites []string
+}
+
+func NewCLIProvider(sites ...string) *CLIProvider {
+	return &CLIProvider{Sites: sites}
+}
+
+func (p *CLIProvider) Name() string {
+	return CLIProviderName
+}
+
+func (p *CLIProvider) Search(ctx context.Context, params SearchParams) ([]models.Job, error) {
+	resultsWanted := fmt.Sprintf("%d", DefaultResultsWanted)
+	if params.ResultsWanted > 0 {
+		resultsWanted = fmt.Sprintf("%d", params.ResultsWanted)
+	}
+
+	args := []string{"search", params.Keyword, "--country", params.Country, "--output", "json", "--results-wanted", resultsWanted}
+
+	// Explicitly select sites (e.g. excluding Glassdoor)
+	for _, site := range p.Sites {
+		args = append(args, "--site", site)
+	}
+
+	if params.Location != "" {
+		args = append(args, "--location", params.Location)
+	}
+	if params.LocalLanguage != "" {
+		args = append(args, "--local-language", params.LocalLanguage)
+	}
+	if params.HoursOld > 0 {
+		args = append(args, "--hours-old", fmt.Sprintf("%d", params.HoursOld))
+	}
+	if params.Exclude != "" {
+		args = append(args, "--exclude", params.Exclude)
+	}
+
+	log.Printf("Running search (CLI): jobseek-expat %v", args)
+
+	// Execute CLI
+	cmdPath := GetJobSeekPath()
+	cmd := exec.CommandContext(ctx, cmdPath, args...)
+	configureProcessGroup(cmd)
+	// Don't wait forever on pipes held open by orphaned grandchildren
+	cmd.WaitDelay = 5 * time.Second
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error executing search: %s (stderr: %s)", err, stderr.String())
+	}
+
+	// The output is expected to be a JSON array
+	return decodeResults(p.Name(), output)
+}
+
+func GetJobSeekPath() string {
+	path, err := exec.LookPath("jobseek-expat")
+	if err == nil {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+
+	// Check common user bin paths
+	paths := []string{
+		filepath.Join(home, "Library/Python/3.14/bin/jobseek-expat"),
+		filepath.Join(home, "Library/Python/3.12/bin/jobseek-expat"),
+		filepath.Join(home, ".local/bin/jobseek-expat"),
+	}
+
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+
+	return "jobseek-expat"
+}
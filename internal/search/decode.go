@@ -0,0 +1,160 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"jobseek-web-be/internal/models"
+)
+
+// RecordError describes a single search result that could not be decoded.
+type RecordError struct {
+	Index int
+	Err   error
+}
+
+func (e RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Index, e.Err)
+}
+
+// DecodeJobs maps the CLI's JSON array onto models.Job. Malformed records are
+// skipped and returned as RecordErrors; err is only set if the payload itself
+// is not a JSON array.
+func DecodeJobs(data []byte) ([]models.Job, []RecordError, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse search results: %v", err)
+	}
+
+	jobs := make([]models.Job, 0, len(raw))
+	var invalid []RecordError
+	for i, item := range raw {
+		job, err := decodeJob(item)
+		if err == nil {
+			err = job.Validate()
+		}
+		if err != nil {
+			invalid = append(invalid, RecordError{Index: i, Err: err})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, invalid, nil
+}
+
+// decodeResults decodes provider output and logs every malformed record so
+// bad scraper output is visible instead of silently shrinking the result set.
+func decodeResults(provider string, data []byte) ([]models.Job, error) {
+	jobs, invalid, err := DecodeJobs(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range invalid {
+		log.Printf("[Search] %s returned malformed result, skipping %v", provider, rec)
+	}
+	if len(invalid) > 0 {
+		log.Printf("[Search] %s: skipped %d of %d results", provider, len(invalid), len(invalid)+len(jobs))
+	}
+	return jobs, nil
+}
+
+func decodeJob(data json.RawMessage) (models.Job, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return models.Job{}, fmt.Errorf("not an object: %v", err)
+	}
+
+	var job models.Job
+	targets := []struct {
+		key string
+		dst *string
+	}{
+		{"site", &job.Site},
+		{"title", &job.Title},
+		{"company", &job.Company},
+		{"location", &job.Location},
+		{"date_posted", &job.DatePosted},
+		{"job_url", &job.JobURL},
+		{"job_level", &job.JobLevel},
+		{"description", &job.Description},
+	}
+	for _, t := range targets {
+		v, err := stringField(fields, t.key)
+		if err != nil {
+			return models.Job{}, err
+		}
+		*t.dst = v
+	}
+
+	salary, err := salaryField(fields)
+	if err != nil {
+		return models.Job{}, err
+	}
+	job.Salary = salary
+
+	return job, nil
+}
+
+// stringField reads an optional text field. Numbers are accepted since the
+// scrapers occasionally emit e.g. dates as epoch values.
+func stringField(fields map[string]interface{}, key string) (string, error) {
+	switch v := fields[key].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("field %s has unexpected type %T", key, v)
+	}
+}
+
+// salaryField accepts either a preformatted "salary" value or the
+// min_amount/max_amount/currency/interval columns emitted by the scraper.
+func salaryField(fields map[string]interface{}) (string, error) {
+	if _, ok := fields["salary"]; ok {
+		return stringField(fields, "salary")
+	}
+
+	min, err := stringField(fields, "min_amount")
+	if err != nil {
+		return "", err
+	}
+	max, err := stringField(fields, "max_amount")
+	if err != nil {
+		return "", err
+	}
+	currency, err := stringField(fields, "currency")
+	if err != nil {
+		return "", err
+	}
+	interval, err := stringField(fields, "interval")
+	if err != nil {
+		return "", err
+	}
+
+	var amount string
+	switch {
+	case min != "" && max != "" && min != max:
+		amount = min + "-" + max
+	case min != "":
+		amount = min
+	case max != "":
+		amount = max
+	default:
+		return "", nil
+	}
+
+	salary := amount
+	if currency != "" {
+		salary += " " + currency
+	}
+	if interval != "" {
+		salary += " / " + interval
+	}
+	return salary, nil
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+// record builds a scraper record with a valid job URL and the given extra
+// JSON fields.
+func record(fields string) string {
+	if fields != "" {
+		fields = ", " + fields
+	}
+	return `{"title": "Go Developer", "job_url": "https://jobs.example/1"` + fields + `}`
+}
+
+func TestDecodeJobsSalary(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fields string
+		want   string
+	}{
+		{"none", ``, ""},
+		{"preformatted", `"salary": "50k-60k EUR"`, "50k-60k EUR"},
+		{"preformatted number", `"salary": 55000`, "55000"},
+		{"preformatted null", `"salary": null`, ""},
+		{"preformatted wins", `"salary": "negotiable", "min_amount": 1`, "negotiable"},
+		{"numeric range", `"min_amount": 50000, "max_amount": 60000, "currency": "EUR", "interval": "yearly"`, "50000-60000 EUR / yearly"},
+		{"string range", `"min_amount": "50000", "max_amount": "60000", "currency": "EUR"`, "50000-60000 EUR"},
+		{"mixed range", `"min_amount": 50000, "max_amount": "60000"`, "50000-60000"},
+		{"fractional", `"min_amount": 25.5, "interval": "hourly"`, "25.5 / hourly"},
+		{"large numbers aren't exponents", `"min_amount": 1200000`, "1200000"},
+		{"equal bounds", `"min_amount": 50000, "max_amount": 50000, "currency": "EUR"`, "50000 EUR"},
+		{"only min", `"min_amount": 50000, "max_amount": null, "currency": "EUR"`, "50000 EUR"},
+		{"only max", `"min_amount": null, "max_amount": 60000`, "60000"},
+		{"null amounts", `"min_amount": null, "max_amount": null, "currency": "EUR", "interval": "yearly"`, ""},
+		{"blank amounts", `"min_amount": " ", "max_amount": ""`, ""},
+		{"whitespace trimmed", `"min_amount": " 50000 ", "currency": " EUR "`, "50000 EUR"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			jobs, invalid, err := DecodeJobs([]byte("[" + record(tc.fields) + "]"))
+			if err != nil || len(invalid) != 0 || len(jobs) != 1 {
+				t.Fatalf("DecodeJobs = %+v, %v, %v", jobs, invalid, err)
+			}
+			if jobs[0].Salary != tc.want {
+				t.Errorf("salary = %q, want %q", jobs[0].Salary, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeJobsFields(t *testing.T) {
+	data := `[{
+		"site": "linkedin",
+		"title": "  Backend Engineer  ",
+		"company": "Acme",
+		"location": "Berlin, Germany",
+		"date_posted": 1767225600,
+		"job_url": "https://jobs.example/42",
+		"job_level": null,
+		"description": "Write Go.",
+		"unknown_column": {"ignored": true}
+	}]`
+	jobs, invalid, err := DecodeJobs([]byte(data))
+	if err != nil || len(invalid) != 0 || len(jobs) != 1 {
+		t.Fatalf("DecodeJobs = %+v, %v, %v", jobs, invalid, err)
+	}
+	j := jobs[0]
+	if j.Site != "linkedin" || j.Title != "Backend Engineer" || j.Company != "Acme" || j.Location != "Berlin, Germany" ||
+		j.DatePosted != "1767225600" || j.JobURL != "https://jobs.example/42" || j.JobLevel != "" || j.Description != "Write Go." {
+		t.Errorf("unexpected job %+v", j)
+	}
+}
+
+func TestDecodeJobsSkipsMalformedRecords(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		record string
+		err    string
+	}{
+		{"not an object", `"Go Developer"`, "not an object"},
+		{"array", `[1, 2]`, "not an object"},
+		{"null", `null`, "missing job_url"},
+		{"missing job_url", `{"title": "Go Developer"}`, "missing job_url"},
+		{"relative job_url", `{"job_url": "/jobs/1"}`, "invalid job_url"},
+		{"non-http job_url", `{"job_url": "javascript:alert(1)"}`, "invalid job_url"},
+		{"object company", record(`"company": {"name": "Acme"}`), "field company has unexpected type"},
+		{"boolean salary", record(`"salary": true`), "field salary has unexpected type"},
+		{"list min_amount", record(`"min_amount": [50000]`), "field min_amount has unexpected type"},
+		{"object currency", record(`"min_amount": 1, "currency": {}`), "field currency has unexpected type"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := "[" + record("") + ", " + tc.record + ", " + strings.Replace(record(""), "/1", "/2", 1) + "]"
+			jobs, invalid, err := DecodeJobs([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) != 2 || jobs[0].JobURL != "https://jobs.example/1" || jobs[1].JobURL != "https://jobs.example/2" {
+				t.Errorf("valid records around the malformed one: %+v", jobs)
+			}
+			if len(invalid) != 1 || invalid[0].Index != 1 || !strings.Contains(invalid[0].Error(), tc.err) {
+				t.Errorf("invalid = %v, want record 1: %s", invalid, tc.err)
+			}
+		})
+	}
+}
+
+func TestDecodeJobsRejectsNonArrays(t *testing.T) {
+	for _, data := range []string{``, `{}`, `{"jobs": []}`, `"results"`, `[{"title": "cut off`, `Traceback (most recent call last):`} {
+		if jobs, _, err := DecodeJobs([]byte(data)); err == nil {
+			t.Errorf("DecodeJobs(%q) = %+v, want an error", data, jobs)
+		}
+	}
+	for _, data := range []string{`[]`, `null`} {
+		if jobs, invalid, err := DecodeJobs([]byte(data)); err != nil || len(jobs) != 0 || len(invalid) != 0 {
+			t.Errorf("DecodeJobs(%q) = %+v, %v, %v, want no jobs", data, jobs, invalid, err)
+		}
+	}
+}
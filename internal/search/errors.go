@@ -0,0 +1,37 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CanceledError is returned when a search is aborted because its context was
+// cancelled or its provider timeout elapsed.
+type CanceledError struct {
+	Provider string
+	Err      error // context.DeadlineExceeded or context.Canceled
+}
+
+func (e *CanceledError) Error() string {
+	if e.Timeout() {
+		return fmt.Sprintf("search via %s timed out", e.Provider)
+	}
+	return fmt.Sprintf("search via %s was cancelled", e.Provider)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the search hit its deadline rather than being
+// cancelled by the caller.
+func (e *CanceledError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// IsCanceled reports whether err (or any error it wraps) is a CanceledError.
+func IsCanceled(err error) bool {
+	var ce *CanceledError
+	return errors.As(err, &ce)
+}
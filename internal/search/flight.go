@@ -0,0 +1,106 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"jobseek-web-be/internal/models"
+)
+
+// flightGroup deduplicates concurrent searches with the same key, in the
+// style of x/sync/singleflight. Unlike singleflight, the shared call runs on
+// its own context that is only cancelled once every waiter has gone away, so
+// one client disconnecting doesn't fail the others.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	jobs    []models.Job
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Metrics counts how searches were served since the process started.
+type Metrics struct {
+	Requests   int64 `json:"requests"`   // calls to ExecuteSearch
+	CacheHits  int64 `json:"cache_hits"` // served from the result cache
+	Executions int64 `json:"executions"` // provider calls actually made
+	Coalesced  int64 `json:"coalesced"`  // joined an identical in-flight search
+	InFlight   int64 `json:"in_flight"`  // provider calls currently running
+}
+
+var (
+	flights = &flightGroup{calls: make(map[string]*flightCall)}
+
+	requestCount   atomic.Int64
+	cacheHitCount  atomic.Int64
+	executionCount atomic.Int64
+	coalescedCount atomic.Int64
+	inFlightCount  atomic.Int64
+)
+
+// Stats returns a snapshot of the search metrics.
+func Stats() Metrics {
+	return Metrics{
+		Requests:   requestCount.Load(),
+		CacheHits:  cacheHitCount.Load(),
+		Executions: executionCount.Load(),
+		Coalesced:  coalescedCount.Load(),
+		InFlight:   inFlightCount.Load(),
+	}
+}
+
+// do runs fn once per key among concurrent callers. It returns early with
+// ctx.Err() if the caller's ctx ends before the shared call completes.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) ([]models.Job, error)) ([]models.Job, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if ok {
+		c.waiters++
+		g.mu.Unlock()
+		coalescedCount.Add(1)
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &flightCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.calls[key] = c
+		g.mu.Unlock()
+
+		executionCount.Add(1)
+		go func() {
+			inFlightCount.Add(1)
+			defer inFlightCount.Add(-1)
+
+			c.jobs, c.err = fn(callCtx)
+			cancel()
+
+			g.mu.Lock()
+			// If this call was abandoned, the key may belong to a newer one
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+
+	select {
+	case <-c.done:
+		return c.jobs, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody is interested anymore, stop the provider. New callers
+			// must start a fresh call rather than join the cancelled one.
+			c.cancel()
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
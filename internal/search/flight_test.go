@@ -0,0 +1,213 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jobseek-web-be/internal/models"
+)
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// waitForWaiters blocks until n callers wait on the key's call.
+func waitForWaiters(t *testing.T, g *flightGroup, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g.mu.Lock()
+		c := g.calls[key]
+		waiting := c != nil && c.waiters == n
+		g.mu.Unlock()
+		if waiting {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d callers on %q", n, key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+type flightResult struct {
+	jobs []models.Job
+	err  error
+}
+
+func TestFlightCoalescesCallers(t *testing.T) {
+	g := newFlightGroup()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) ([]models.Job, error) {
+		calls.Add(1)
+		<-release
+		return []models.Job{{Title: "Go Developer"}}, nil
+	}
+
+	const callers = 5
+	results := make(chan flightResult, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			jobs, err := g.do(context.Background(), "key", fn)
+			results <- flightResult{jobs, err}
+		}()
+	}
+	waitForWaiters(t, g, "key", callers)
+	close(release)
+
+	for i := 0; i < callers; i++ {
+		r := <-results
+		if r.err != nil || len(r.jobs) != 1 || r.jobs[0].Title != "Go Developer" {
+			t.Errorf("caller got %+v, %v", r.jobs, r.err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fn ran %d times, want once", n)
+	}
+
+	// Finished calls aren't reused
+	if _, err := g.do(context.Background(), "key", fn); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fn ran %d times after a later call, want 2", n)
+	}
+}
+
+func TestFlightSeparatesKeys(t *testing.T) {
+	g := newFlightGroup()
+	var calls atomic.Int32
+	fn := func(ctx context.Context) ([]models.Job, error) {
+		calls.Add(1)
+		return nil, nil
+	}
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.do(context.Background(), key, fn)
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 3 {
+		t.Errorf("fn ran %d times for 3 keys", n)
+	}
+}
+
+func TestFlightCancelsWhenLastWaiterLeaves(t *testing.T) {
+	g := newFlightGroup()
+	started := make(chan context.Context, 1)
+	stopped := make(chan struct{})
+	fn := func(ctx context.Context) ([]models.Job, error) {
+		started <- ctx
+		<-ctx.Done()
+		close(stopped)
+		return nil, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	results := make(chan error, 2)
+	go func() {
+		_, err := g.do(first, "key", fn)
+		results <- err
+	}()
+	callCtx := <-started
+	go func() {
+		_, err := g.do(second, "key", fn)
+		results <- err
+	}()
+	waitForWaiters(t, g, "key", 2)
+
+	// One caller leaving returns it early but keeps the call going for the
+	// other
+	cancelFirst()
+	if err := <-results; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+	waitForWaiters(t, g, "key", 1)
+	if err := callCtx.Err(); err != nil {
+		t.Fatalf("shared call cancelled while a caller still waits: %v", err)
+	}
+
+	cancelSecond()
+	if err := <-results; !errors.Is(err, context.Canceled) {
+		t.Errorf("last caller got %v, want context.Canceled", err)
+	}
+	waitFor(t, stopped, "the shared call to be cancelled")
+}
+
+func TestFlightNewCallerAfterAbandonment(t *testing.T) {
+	g := newFlightGroup()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) ([]models.Job, error) {
+		if calls.Add(1) == 1 {
+			// The abandoned call outlives its cancellation, like a provider
+			// that's slow to stop
+			<-release
+			return nil, ctx.Err()
+		}
+		return []models.Job{{Title: "Fresh"}}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, "key", fn)
+		done <- err
+	}()
+	waitForWaiters(t, g, "key", 1)
+	g.mu.Lock()
+	abandoned := g.calls["key"]
+	g.mu.Unlock()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("abandoning caller got %v, want context.Canceled", err)
+	}
+
+	jobs, err := g.do(context.Background(), "key", fn)
+	if err != nil || len(jobs) != 1 || jobs[0].Title != "Fresh" {
+		t.Errorf("new caller got %+v, %v, want a fresh call's results", jobs, err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fn ran %d times, want 2", n)
+	}
+
+	// The abandoned call finishing doesn't remove a newer call's key
+	block := make(chan struct{})
+	newer := make(chan struct{})
+	go func() {
+		g.do(context.Background(), "key", func(ctx context.Context) ([]models.Job, error) {
+			close(newer)
+			<-block
+			return nil, nil
+		})
+	}()
+	waitFor(t, newer, "the newer call to start")
+	close(release)
+	waitFor(t, abandoned.done, "the abandoned call to finish")
+	g.mu.Lock()
+	c := g.calls["key"]
+	g.mu.Unlock()
+	if c == nil || c == abandoned {
+		t.Error("the abandoned call removed the newer call's key")
+	}
+	close(block)
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package search
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessGroup starts the command in its own process group and
+// makes context cancellation kill the whole group, so helper processes
+// spawned by the scraper (e.g. headless browsers) don't outlive it.
+func configureProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,178 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"jobseek-web-be/internal/models"
+)
+
+// JobProvider is a source of job postings. Implementations must be safe for
+// concurrent use since the scheduler and HTTP handlers share them.
+type JobProvider interface {
+	// Name is the identifier used to select the provider per search.
+	Name() string
+	// Search must return promptly once ctx is done.
+	Search(ctx context.Context, params SearchParams) ([]models.Job, error)
+}
+
+// DefaultTimeout bounds a single provider call unless overridden with
+// SEARCH_TIMEOUT or SEARCH_TIMEOUT_<PROVIDER> (e.g. SEARCH_TIMEOUT_JOBSEEK_EXPAT).
+const DefaultTimeout = 3 * time.Minute
+
+var (
+	registryMu      sync.RWMutex
+	providers       = map[string]JobProvider{}
+	timeouts        = map[string]time.Duration{}
+	limits          = map[string]chan struct{}{}
+	defaultProvider = CLIProviderName
+)
+
+func init() {
+	RegisterProvider(NewCLIProvider("linkedin", "indeed"))
+
+	// A static JSON file can stand in for the scraper during local development
+	if path := os.Getenv("SEARCH_STATIC_FILE"); path != "" {
+		RegisterProvider(NewStaticProvider(path))
+	}
+}
+
+// RegisterProvider adds a provider to the registry, replacing any provider
+// previously registered under the same name.
+func RegisterProvider(p JobProvider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	providers[p.Name()] = p
+	timeouts[p.Name()] = timeoutFromEnv(p.Name())
+	limits[p.Name()] = semaphore(concurrencyFromEnv(p.Name()))
+}
+
+// SetProviderTimeout overrides how long a single search may run on the named
+// provider. A zero duration disables the timeout.
+func SetProviderTimeout(name string, d time.Duration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	timeouts[name] = d
+}
+
+func providerTimeout(name string) time.Duration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return timeouts[name]
+}
+
+// SetProviderConcurrency caps how many searches may run on the named provider
+// at once, across the scheduler and HTTP handlers. Zero means unlimited.
+func SetProviderConcurrency(name string, n int) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	limits[name] = semaphore(n)
+}
+
+func semaphore(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// acquireProvider blocks until the named provider has a free slot or ctx is
+// done. The returned func releases the slot.
+func acquireProvider(ctx context.Context, name string) (func(), error) {
+	registryMu.RLock()
+	sem := limits[name]
+	registryMu.RUnlock()
+	if sem == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// providerEnvKeys returns the per-provider and global variable names for a
+// setting, e.g. SEARCH_TIMEOUT_JOBSEEK_EXPAT and SEARCH_TIMEOUT.
+func providerEnvKeys(prefix, name string) []string {
+	suffix := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	return []string{prefix + "_" + suffix, prefix}
+}
+
+func concurrencyFromEnv(name string) int {
+	for _, k := range providerEnvKeys("SEARCH_CONCURRENCY", name) {
+		v := os.Getenv(k)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Printf("[Search] Ignoring invalid %s=%q", k, v)
+			continue
+		}
+		return n
+	}
+	return 0
+}
+
+func timeoutFromEnv(name string) time.Duration {
+	for _, k := range providerEnvKeys("SEARCH_TIMEOUT", name) {
+		v := os.Getenv(k)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("[Search] Ignoring invalid %s=%q: %v", k, v, err)
+			continue
+		}
+		return d
+	}
+	return DefaultTimeout
+}
+
+// SetDefaultProvider selects the provider used when a search does not name one.
+func SetDefaultProvider(name string) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := providers[name]; !ok {
+		return fmt.Errorf("unknown search provider %q", name)
+	}
+	defaultProvider = name
+	return nil
+}
+
+// GetProvider looks up a provider by name. An empty name returns the default.
+func GetProvider(name string) (JobProvider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if name == "" {
+		name = defaultProvider
+	}
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown search provider %q", name)
+	}
+	return p, nil
+}
+
+// Providers returns the names of all registered providers, sorted.
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
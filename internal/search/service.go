@@ -1,15 +1,15 @@
 package search
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
 	"log"
-	"os"
-	"os/exec"
-	"path/filepath"
+
+	"jobseek-web-be/internal/models"
 )
 
+// DefaultResultsWanted is used when a search doesn't ask for a number of results.
+const DefaultResultsWanted = 30
+
 type SearchParams struct {
 	Keyword       string
 	Country       string
@@ -18,78 +18,73 @@ type SearchParams struct {
 	ResultsWanted int
 	HoursOld      int
 	Exclude       string
+	Provider      string // optional, empty selects the default provider
 }
 
-func ExecuteSearch(params SearchParams) ([]interface{}, error) {
+// ExecuteSearch runs the search against the provider selected in params,
+// falling back to the registry's default provider. Results come from the
+// cache when possible, and concurrent identical searches share one provider
+// call. The search is bounded by ctx and the provider's timeout; if either
+// ends it first a *CanceledError is returned.
+func ExecuteSearch(ctx context.Context, params SearchParams) ([]models.Job, error) {
+	requestCount.Add(1)
+
 	// Default values
 	if params.Country == "" {
 		params.Country = "Germany"
 	}
-	resultsWanted := "30"
-	if params.ResultsWanted > 0 {
-		resultsWanted = fmt.Sprintf("%d", params.ResultsWanted)
-	}
-
-	args := []string{"search", params.Keyword, "--country", params.Country, "--output", "json", "--results-wanted", resultsWanted}
 
-	// Explicitly select sites (excluding Glassdoor)
-	args = append(args, "--site", "linkedin", "--site", "indeed")
-
-	if params.Location != "" {
-		args = append(args, "--location", params.Location)
-	}
-	if params.LocalLanguage != "" {
-		args = append(args, "--local-language", params.LocalLanguage)
-	}
-	if params.HoursOld > 0 {
-		args = append(args, "--hours-old", fmt.Sprintf("%d", params.HoursOld))
-	}
-	if params.Exclude != "" {
-		args = append(args, "--exclude", params.Exclude)
+	provider, err := GetProvider(params.Provider)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf("Running search (Service): jobseek-expat %v", args)
+	params.Provider = provider.Name()
 
-	// Execute CLI
-	cmdPath := GetJobSeekPath()
-	cmd := exec.Command(cmdPath, args...)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("error executing search: %s (stderr: %s)", err, stderr.String())
+	cache := currentCache()
+	key := CacheKey(params)
+	if cache != nil {
+		if jobs, ok := cache.Get(key); ok {
+			cacheHitCount.Add(1)
+			log.Printf("Search cache hit via %s: %q in %s", provider.Name(), params.Keyword, params.Country)
+			return jobs, nil
+		}
 	}
 
-	var results []interface{}
-	// The output is expected to be a JSON array
-	if err := json.Unmarshal(output, &results); err != nil {
-		return nil, fmt.Errorf("failed to parse search results: %v", err)
+	jobs, err := flights.do(ctx, key, func(ctx context.Context) ([]models.Job, error) {
+		jobs, err := runProvider(ctx, provider, params)
+		if err == nil && cache != nil {
+			cache.Set(key, jobs)
+		}
+		return jobs, err
+	})
+	if err != nil && ctx.Err() != nil {
+		return nil, &CanceledError{Provider: provider.Name(), Err: ctx.Err()}
 	}
-
-	return results, nil
+	return jobs, err
 }
 
-func GetJobSeekPath() string {
-	path, err := exec.LookPath("jobseek-expat")
-	if err == nil {
-		return path
+func runProvider(ctx context.Context, provider JobProvider, params SearchParams) ([]models.Job, error) {
+	// Waiting for a slot doesn't count against the provider timeout
+	release, err := acquireProvider(ctx, provider.Name())
+	if err != nil {
+		return nil, &CanceledError{Provider: provider.Name(), Err: err}
 	}
-	home, _ := os.UserHomeDir()
+	defer release()
 
-	// Check common user bin paths
-	paths := []string{
-		filepath.Join(home, "Library/Python/3.14/bin/jobseek-expat"),
-		filepath.Join(home, "Library/Python/3.12/bin/jobseek-expat"),
-		filepath.Join(home, ".local/bin/jobseek-expat"),
+	if timeout := providerTimeout(provider.Name()); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	for _, p := range paths {
-		if _, err := os.Stat(p); err == nil {
-			return p
+	log.Printf("Running search (Service) via %s: %q in %s", provider.Name(), params.Keyword, params.Country)
+	jobs, err := provider.Search(ctx, params)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, &CanceledError{Provider: provider.Name(), Err: ctx.Err()}
 		}
+		return nil, err
 	}
-
-	return "jobseek-expat"
+	return jobs, nil
 }
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"jobseek-web-be/internal/models"
+)
+
+const StaticProviderName = "static"
+
+// StaticProvider serves results from a JSON file in the same format the CLI
+// prints. It ignores the search parameters apart from ResultsWanted.
+type StaticProvider struct {
+	Path string
+}
+
+func NewStaticProvider(path string) *StaticProvider {
+	return &StaticProvider{Path: path}
+}
+
+func (p *StaticProvider) Name() string {
+	return StaticProviderName
+}
+
+func (p *StaticProvider) Search(ctx context.Context, params SearchParams) ([]models.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading static results: %v", err)
+	}
+
+	results, err := decodeResults(p.Name(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.ResultsWanted > 0 && len(results) > params.ResultsWanted {
+		results = results[:params.ResultsWanted]
+	}
+	return results, nil
+}
@@ -0,0 +1,108 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890",
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8 digit codes; 6 digit ones are their last 6 digits
+	for _, tc := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		got, err := Code(rfcSecret, Counter(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tc.want[len(tc.want)-Digits:]; got != want {
+			t.Errorf("Code at %d = %s, want %s", tc.unix, got, want)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseSecrets(t *testing.T) {
+	got, err := Code(strings.ToLower(rfcSecret), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "287082" {
+		t.Errorf("Code = %s, want 287082", got)
+	}
+}
+
+func TestCodeRejectsInvalidSecrets(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Counter(now)
+	for _, tc := range []struct {
+		offset int64
+		ok     bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	} {
+		code, err := Code(rfcSecret, current+tc.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter, ok := Validate(rfcSecret, code, now)
+		if ok != tc.ok {
+			t.Errorf("code %+d steps away: ok = %v, want %v", tc.offset, ok, tc.ok)
+		}
+		if ok && counter != current+tc.offset {
+			t.Errorf("code %+d steps away matched step %d, want %d", tc.offset, counter, current+tc.offset)
+		}
+	}
+}
+
+func TestValidateNormalizesInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"287082", " 287082 ", "287 082"} {
+		if _, ok := Validate(rfcSecret, code, now); !ok {
+			t.Errorf("Validate(%q) rejected a valid code", code)
+		}
+	}
+	for _, code := range []string{"", "28708", "2870820", "94287082", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("Validate(%q) accepted an invalid code", code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("generated secret %q isn't usable: %v", a, err)
+	}
+}
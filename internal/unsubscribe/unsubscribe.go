@@ -0,0 +1,137 @@
+// Package unsubscribe signs the unsubscribe links in alert emails, so only
+// the recipient of an email can turn off the alerts it was sent for. Tokens
+// don't expire, since links in old emails should keep working.
+package unsubscribe
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MinSecretLength is the shortest accepted signing secret, in bytes.
+const MinSecretLength = 32
+
+var (
+	ErrInvalidToken  = errors.New("invalid unsubscribe token")
+	ErrNotConfigured = errors.New("unsubscribe secrets are not configured")
+)
+
+var (
+	mu      sync.Mutex
+	secrets [][]byte // the first one signs, all of them verify
+)
+
+// ConfigureFromEnv loads the signing secrets from UNSUBSCRIBE_SECRET,
+// separated by commas so a secret can be rotated: the first one signs new
+// links and the others keep old links working. Without it a random secret
+// is used, which is fine for development but breaks the links in emails sent
+// before a restart.
+func ConfigureFromEnv() error {
+	spec := os.Getenv("UNSUBSCRIBE_SECRET")
+	if spec == "" {
+		log.Println("[Email] UNSUBSCRIBE_SECRET is not set; using a random secret. Unsubscribe links won't survive a restart.")
+		secret := make([]byte, MinSecretLength)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("generating an unsubscribe secret: %w", err)
+		}
+		mu.Lock()
+		secrets = [][]byte{secret}
+		mu.Unlock()
+		return nil
+	}
+	var list []string
+	for _, s := range strings.Split(spec, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return SetSecrets(list)
+}
+
+// SetSecrets replaces the signing secrets. The first one signs.
+func SetSecrets(list []string) error {
+	if len(list) == 0 {
+		return errors.New("no unsubscribe secrets")
+	}
+	keys := make([][]byte, len(list))
+	for i, s := range list {
+		if len(s) < MinSecretLength {
+			return fmt.Errorf("unsubscribe secret %d is shorter than %d bytes", i+1, MinSecretLength)
+		}
+		keys[i] = []byte(s)
+	}
+	mu.Lock()
+	secrets = keys
+	mu.Unlock()
+	return nil
+}
+
+// keys returns the configured secrets, none before ConfigureFromEnv or
+// SetSecrets.
+func keys() [][]byte {
+	mu.Lock()
+	defer mu.Unlock()
+	return secrets
+}
+
+// Token signs an unsubscribe from one of the user's alerts, or from all of
+// them if searchID is 0. It returns ErrNotConfigured before the secrets are
+// set up.
+func Token(userID, searchID int) (string, error) {
+	keys := keys()
+	if len(keys) == 0 {
+		return "", ErrNotConfigured
+	}
+	payload := strconv.Itoa(userID) + "." + strconv.Itoa(searchID)
+	return payload + "." + sign(keys[0], payload), nil
+}
+
+// Parse verifies a token from Token and returns the user and search it's
+// for.
+func Parse(token string) (int, int, error) {
+	payload, mac, ok := cutLast(token, ".")
+	if !ok {
+		return 0, 0, ErrInvalidToken
+	}
+	valid := false
+	for _, key := range keys() {
+		if hmac.Equal([]byte(mac), []byte(sign(key, payload))) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return 0, 0, ErrInvalidToken
+	}
+
+	uid, sid, _ := strings.Cut(payload, ".")
+	userID, err1 := strconv.Atoi(uid)
+	searchID, err2 := strconv.Atoi(sid)
+	if err1 != nil || err2 != nil || userID <= 0 || searchID < 0 {
+		return 0, 0, ErrInvalidToken
+	}
+	return userID, searchID, nil
+}
+
+func sign(key []byte, payload string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("unsubscribe:" + payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
@@ -0,0 +1,165 @@
+package unsubscribe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// withSecrets replaces the configured secrets for the test.
+func withSecrets(t *testing.T, keys [][]byte) {
+	t.Helper()
+	mu.Lock()
+	prev := secrets
+	secrets = keys
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		secrets = prev
+		mu.Unlock()
+	})
+}
+
+func TestTokenNotConfigured(t *testing.T) {
+	withSecrets(t, nil)
+	if _, err := Token(1, 2); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Token: got %v, want ErrNotConfigured", err)
+	}
+	if _, _, err := Parse("1.2.sig"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse: got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestConfigureFromEnvGeneratesSecret(t *testing.T) {
+	withSecrets(t, nil)
+	t.Setenv("UNSUBSCRIBE_SECRET", "")
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := Token(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, sid, err := Parse(token); err != nil || uid != 1 || sid != 2 {
+		t.Errorf("Parse = %d, %d, %v", uid, sid, err)
+	}
+}
+
+var (
+	oldSecret = strings.Repeat("o", MinSecretLength)
+	newSecret = strings.Repeat("n", MinSecretLength)
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	withSecrets(t, nil)
+	if err := SetSecrets([]string{newSecret}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ userID, searchID int }{{1, 2}, {42, 0}, {7, 123456}} {
+		token, err := Token(tc.userID, tc.searchID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uid, sid, err := Parse(token)
+		if err != nil || uid != tc.userID || sid != tc.searchID {
+			t.Errorf("Parse(Token(%d, %d)) = %d, %d, %v", tc.userID, tc.searchID, uid, sid, err)
+		}
+	}
+}
+
+func TestParseRejectsTamperedTokens(t *testing.T) {
+	withSecrets(t, nil)
+	if err := SetSecrets([]string{newSecret}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := Token(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, mac, _ := cutLast(token, ".")
+	flipped := []byte(mac)
+	flipped[0] ^= 1
+
+	for name, tampered := range map[string]string{
+		"other user":      "2.2." + mac,
+		"other search":    "1.3." + mac,
+		"all searches":    "1.0." + mac,
+		"changed mac":     "1.2." + string(flipped),
+		"truncated mac":   "1.2." + mac[:len(mac)-1],
+		"no mac":          "1.2.",
+		"signed by other": "1.2." + sign([]byte(oldSecret), "1.2"),
+	} {
+		if _, _, err := Parse(tampered); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestParseRejectsMalformedTokens(t *testing.T) {
+	withSecrets(t, nil)
+	if err := SetSecrets([]string{newSecret}); err != nil {
+		t.Fatal(err)
+	}
+	signed := func(payload string) string { return payload + "." + sign([]byte(newSecret), payload) }
+
+	for name, token := range map[string]string{
+		"empty":              "",
+		"no dots":            "12abc",
+		"one dot":            "1." + sign([]byte(newSecret), "1"),
+		"bad base64":         "1.2.!!not base64!!",
+		"signed, no search":  signed("1"),
+		"signed, not ints":   signed("a.b"),
+		"signed, user 0":     signed("0.2"),
+		"signed, negative":   signed("1.-2"),
+		"signed, extra part": signed("1.2.3"),
+	} {
+		if _, _, err := Parse(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s (%q): got %v, want ErrInvalidToken", name, token, err)
+		}
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	withSecrets(t, nil)
+	t.Setenv("UNSUBSCRIBE_SECRET", oldSecret)
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	old, err := Token(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new secret signs, the old one keeps earlier links working
+	t.Setenv("UNSUBSCRIBE_SECRET", newSecret+", "+oldSecret)
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if uid, sid, err := Parse(old); err != nil || uid != 1 || sid != 2 {
+		t.Errorf("token signed with the old secret: %d, %d, %v", uid, sid, err)
+	}
+	current, err := Token(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current == old || current != "1.2."+sign([]byte(newSecret), "1.2") {
+		t.Errorf("Token = %q, want it signed with the new secret", current)
+	}
+
+	// Dropping the old secret breaks its links
+	t.Setenv("UNSUBSCRIBE_SECRET", newSecret)
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Parse(old); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of a dropped secret: got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestConfigureFromEnvRejectsShortSecrets(t *testing.T) {
+	withSecrets(t, nil)
+	t.Setenv("UNSUBSCRIBE_SECRET", newSecret+",short")
+	if err := ConfigureFromEnv(); err == nil {
+		t.Error("ConfigureFromEnv accepted a secret shorter than MinSecretLength")
+	}
+}
@@ -0,0 +1,183 @@
+// Package usage meters the expensive features per user and enforces the
+// rolling quotas of their plan.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"jobseek-web-be/internal/entitlements"
+	"jobseek-web-be/internal/repository"
+)
+
+// Feature is a metered action.
+type Feature string
+
+const (
+	Search      Feature = "search"
+	AlertCreate Feature = "alert_create"
+	CVAnalysis  Feature = "cv_analysis"
+)
+
+// Features lists every metered feature, in the order usage is reported.
+var Features = []Feature{Search, AlertCreate, CVAnalysis}
+
+// Quota windows are rolling: a use counts until it's a full window old.
+const (
+	Day   = 24 * time.Hour
+	Month = 30 * Day
+)
+
+// Retention is how long usage events are kept, covering the longest window.
+const Retention = Month
+
+// Quota is the number of uses allowed within a rolling window.
+type Quota struct {
+	Limit  int
+	Window time.Duration
+}
+
+// QuotaFor returns the quota of a feature under the given entitlements.
+func QuotaFor(ent entitlements.Entitlements, f Feature) Quota {
+	switch f {
+	case Search:
+		return Quota{Limit: ent.SearchesPerDay, Window: Day}
+	case AlertCreate:
+		return Quota{Limit: ent.AlertsCreatedPerDay, Window: Day}
+	case CVAnalysis:
+		return Quota{Limit: ent.CVAnalysesPerMonth, Window: Month}
+	default:
+		return Quota{}
+	}
+}
+
+// ExceededError is returned by Meter.Consume when the quota is used up.
+type ExceededError struct {
+	Feature    Feature
+	Quota      Quota
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	period := "day"
+	if e.Quota.Window == Month {
+		period = "30 days"
+	}
+	return fmt.Sprintf("Usage limit reached: your plan allows %d %s per %s", e.Quota.Limit, e.Feature.noun(), period)
+}
+
+// NotIncludedError is returned by Meter.Consume when the user's plan doesn't
+// include the feature at all, so waiting won't help.
+type NotIncludedError struct {
+	Feature Feature
+}
+
+func (e *NotIncludedError) Error() string {
+	return fmt.Sprintf("Your plan doesn't include %s, upgrade to use them", e.Feature.noun())
+}
+
+func (f Feature) noun() string {
+	switch f {
+	case Search:
+		return "searches"
+	case AlertCreate:
+		return "new alerts"
+	case CVAnalysis:
+		return "CV analyses"
+	default:
+		return string(f)
+	}
+}
+
+// Report is a user's current usage of one feature.
+type Report struct {
+	Feature       Feature    `json:"feature"`
+	Used          int        `json:"used"`
+	Limit         int        `json:"limit"`
+	Remaining     int        `json:"remaining"`
+	WindowSeconds int64      `json:"window_seconds"`
+	ResetsAt      *time.Time `json:"resets_at,omitempty"` // when the oldest counted use expires
+}
+
+// Meter records usage events and checks them against quotas.
+type Meter struct {
+	events repository.UsageRepository
+	now    func() time.Time
+}
+
+func NewMeter(events repository.UsageRepository) *Meter {
+	return &Meter{events: events, now: time.Now}
+}
+
+// Consume records one use of the feature. It returns a *NotIncludedError if
+// the user's plan has no quota for it, or an *ExceededError if the quota is
+// used up.
+func (m *Meter) Consume(ctx context.Context, userID int, ent entitlements.Entitlements, f Feature) error {
+	q := QuotaFor(ent, f)
+	if q.Limit <= 0 {
+		return &NotIncludedError{Feature: f}
+	}
+	now := m.now().UTC()
+	since := now.Add(-q.Window)
+
+	ok, err := m.events.Consume(ctx, userID, string(f), now, since, q.Limit)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	// A slot frees up when the oldest use in the window expires
+	retryAfter := q.Window
+	if _, oldest, err := m.events.Window(ctx, userID, string(f), since); err == nil && !oldest.IsZero() {
+		retryAfter = oldest.Add(q.Window).Sub(now)
+	}
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return &ExceededError{Feature: f, Quota: q, RetryAfter: retryAfter}
+}
+
+// Refund takes back the user's latest use of the feature, for requests
+// that failed on our side after being metered.
+func (m *Meter) Refund(ctx context.Context, userID int, f Feature) error {
+	return m.events.Refund(ctx, userID, string(f))
+}
+
+// Usage reports the user's usage of every feature.
+func (m *Meter) Usage(ctx context.Context, userID int, ent entitlements.Entitlements) ([]Report, error) {
+	now := m.now().UTC()
+	reports := make([]Report, 0, len(Features))
+	for _, f := range Features {
+		q := QuotaFor(ent, f)
+		used, oldest, err := m.events.Window(ctx, userID, string(f), now.Add(-q.Window))
+		if err != nil {
+			return nil, err
+		}
+
+		r := Report{
+			Feature:       f,
+			Used:          used,
+			Limit:         q.Limit,
+			Remaining:     q.Limit - used,
+			WindowSeconds: int64(q.Window / time.Second),
+		}
+		// Usage from a bigger plan may exceed the current limit
+		if r.Remaining < 0 {
+			r.Remaining = 0
+		}
+		if !oldest.IsZero() {
+			resetsAt := oldest.Add(q.Window).UTC()
+			r.ResetsAt = &resetsAt
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// Prune deletes usage events too old to count towards any quota.
+func (m *Meter) Prune(ctx context.Context) (int64, error) {
+	return m.events.Prune(ctx, m.now().UTC().Add(-Retention))
+}
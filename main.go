@@ -8,9 +8,14 @@ import (
 
 	"github.com/joho/godotenv"
 
+	"jobseek-web-be/internal/auth"
 	"jobseek-web-be/internal/db"
 	"jobseek-web-be/internal/handlers"
+	"jobseek-web-be/internal/middleware"
+	"jobseek-web-be/internal/repository"
 	"jobseek-web-be/internal/scheduler"
+	"jobseek-web-be/internal/search"
+	"jobseek-web-be/internal/unsubscribe"
 )
 
 func main() {
@@ -18,34 +23,95 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "billing" {
+		runBilling(os.Args[2:])
+		return
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	// Initialize Database
+	// Initialize Database (applies pending migrations)
 	db.InitDB()
 
+	// Select the default job provider (defaults to the jobseek-expat CLI)
+	if provider := os.Getenv("SEARCH_PROVIDER"); provider != "" {
+		if err := search.SetDefaultProvider(provider); err != nil {
+			log.Fatal(err)
+		}
+	}
+	search.ConfigureCacheFromEnv()
+
+	// Secrets that sign unsubscribe links; see UNSUBSCRIBE_SECRET
+	if err := unsubscribe.ConfigureFromEnv(); err != nil {
+		log.Fatalf("Invalid unsubscribe configuration: %v", err)
+	}
+
+	// Token signing keys; see JWT_KEYS_FILE / JWT_SIGNING_KEYS
+	keys, err := auth.LoadKeys()
+	if err != nil {
+		log.Fatalf("Invalid JWT key configuration: %v", err)
+	}
+
+	store := repository.NewSQLStore(db.DB)
+	authService := auth.NewService(keys, store)
+	api := handlers.NewAPI(store, authService)
+
 	// API Routes
 	http.HandleFunc("/api/health", healthHandler)
 
 	// Public Auth Routes
-	http.HandleFunc("/api/auth/register", handlers.RegisterHandler)
-	http.HandleFunc("/api/auth/login", handlers.LoginHandler)
-
-	// Protected Routes (example usage)
-	// For now, we keep search public as the "Basic" plan functionality implies access.
-	// In strict mode, we would wrap it: http.HandleFunc("/api/search", middleware.AuthMiddleware(handlers.SearchHandler))
-	// Protected Routes
-	http.HandleFunc("/api/search", handlers.SearchHandler)
+	http.HandleFunc("/api/auth/register", api.RegisterHandler)
+	http.HandleFunc("/api/auth/login", api.LoginHandler)
+	http.HandleFunc("/api/auth/refresh", api.RefreshHandler)
+	http.HandleFunc("/api/auth/verify", api.VerifyEmailHandler)
+	http.HandleFunc("/api/auth/forgot-password", api.ForgotPasswordHandler)
+	http.HandleFunc("/api/auth/reset-password", api.ResetPasswordHandler)
+	http.HandleFunc("/api/auth/unlock", api.UnlockAccountHandler)
+	http.HandleFunc("/api/auth/mfa/verify", api.MFAVerifyHandler)
+	http.HandleFunc("/api/auth/oidc/providers", api.OIDCProvidersHandler)
+	http.HandleFunc("/api/auth/oidc/exchange", api.OIDCExchangeHandler)
+	http.HandleFunc("/api/auth/oidc/", api.OIDCHandler)
+
+	// Public Routes
 	http.HandleFunc("/api/redirect", handlers.RedirectHandler)
-	http.HandleFunc("/api/unsubscribe", handlers.UnsubscribeHandler)
-	http.Handle("/api/searches/", http.HandlerFunc(handlers.SaveSearchHandler))
-	http.HandleFunc("/api/searches", handlers.SaveSearchHandler)
-	http.HandleFunc("/api/cv/analyze", handlers.AnalyzeCVHandler) // Pro feature
+	http.HandleFunc("/api/unsubscribe", api.UnsubscribeHandler)        // verified by signature
+	http.HandleFunc("/api/billing/webhook", api.BillingWebhookHandler) // verified by signature
+
+	// Protected Routes: the middleware validates the token and loads the user
+	requireAuth := middleware.Auth(authService)
+	// Routes given a scope also accept API keys with that scope
+	http.HandleFunc("/api/search", requireAuth(api.SearchHandler, auth.ScopeSearchRead))
+	alerts := middleware.ReadWrite(
+		requireAuth(api.SaveSearchHandler, auth.ScopeAlertsRead),
+		requireAuth(api.SaveSearchHandler, auth.ScopeAlertsWrite),
+	)
+	http.HandleFunc("/api/searches/", alerts)
+	http.HandleFunc("/api/searches", alerts)
+	http.HandleFunc("/api/cv/analyze", requireAuth(api.AnalyzeCVHandler, auth.ScopeCVAnalyze))
+	http.HandleFunc("/api/settings/digest", requireAuth(api.DigestSettingsHandler))
+	http.HandleFunc("/api/auth/logout", requireAuth(api.LogoutHandler))
+	http.HandleFunc("/api/auth/verify/resend", requireAuth(api.ResendVerificationHandler))
+	http.HandleFunc("/api/auth/change-password", requireAuth(api.ChangePasswordHandler))
+	http.HandleFunc("/api/auth/mfa", requireAuth(api.MFAHandler))
+	http.HandleFunc("/api/auth/mfa/enroll", requireAuth(api.MFAEnrollHandler))
+	http.HandleFunc("/api/auth/mfa/activate", requireAuth(api.MFAActivateHandler))
+	http.HandleFunc("/api/auth/sessions/", requireAuth(api.SessionsHandler))
+	http.HandleFunc("/api/auth/sessions", requireAuth(api.SessionsHandler))
+	http.HandleFunc("/api/keys/", requireAuth(api.APIKeysHandler))
+	http.HandleFunc("/api/keys", requireAuth(api.APIKeysHandler))
+	http.HandleFunc("/api/me", requireAuth(api.MeHandler))
+	http.HandleFunc("/api/usage", requireAuth(api.UsageHandler))
+	http.HandleFunc("/api/billing/checkout", requireAuth(api.CheckoutHandler))
 
 	// Start Scheduler
-	scheduler := scheduler.NewScheduler()
+	scheduler := scheduler.NewScheduler(store)
 	scheduler.Start()
 	defer scheduler.Stop()
 
@@ -71,6 +137,19 @@ func main() {
 		frontendFS.ServeHTTP(w, r)
 	})
 
+	// Internal Routes: operational endpoints on a listener of their own that
+	// isn't exposed publicly; see INTERNAL_ADDR
+	if addr := os.Getenv("INTERNAL_ADDR"); addr != "" {
+		internal := http.NewServeMux()
+		internal.HandleFunc("/api/search/metrics", handlers.SearchMetricsHandler)
+		go func() {
+			log.Printf("Internal endpoints listening on %s", addr)
+			if err := http.ListenAndServe(addr, internal); err != nil {
+				log.Fatalf("Internal listener failed: %v", err)
+			}
+		}()
+	}
+
 	log.Printf("Server starting on port %s...", port)
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatal(err)
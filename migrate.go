@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"jobseek-web-be/internal/db"
+)
+
+const migrateUsage = `usage: expatter-server migrate <command>
+
+commands:
+  up [version]   apply pending migrations (up to version, default all)
+  down [steps]   revert the last applied migrations (default 1)
+  status         list migrations and whether they are applied`
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	n := 0
+	if len(args) > 1 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+	}
+
+	db.Open()
+	defer db.DB.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(n)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		reverted, err := db.MigrateDown(n)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		fmt.Printf("Reverted %d migration(s)\n", reverted)
+	case "status":
+		states, err := db.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-24s  %s  %s\n", s.Version, s.Name, s.Checksum[:12], applied)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}